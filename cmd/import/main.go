@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/x0k/effective-mobile-song-library-service/internal/app"
+)
+
+func main() {
+	var config_path string
+	args := app.ImportArgs{
+		Columns: make(map[string]string),
+	}
+	flag.StringVar(&config_path, "config", os.Getenv("CONFIG_PATH"), "Config path")
+	flag.StringVar(&args.DateLayout, "date-layout", "", "Layout of the release dates, e.g. 2006-01-02")
+	flag.BoolVar(&args.DryRun, "dry-run", false, "Validate rows without saving songs")
+	flag.StringVar(&args.Author, "author", "", "Author of the change")
+	flag.Func("column", "Column of the song field, e.g. song=Title (repeatable)", func(s string) error {
+		field, column, ok := strings.Cut(s, "=")
+		if !ok {
+			return fmt.Errorf("expected field=column, got %q", s)
+		}
+		args.Columns[field] = column
+		return nil
+	})
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <file.csv|->\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	args.Path = flag.Arg(0)
+	if config_path == "" {
+		config_path = ".env"
+	}
+	app.Import(config_path, args)
+}
@@ -19,6 +19,11 @@ func (sc *statusCapturer) WriteHeader(status int) {
 	sc.status = status
 }
 
+// Unwrap allows http.ResponseController to flush streamed responses
+func (sc *statusCapturer) Unwrap() http.ResponseWriter {
+	return sc.ResponseWriter
+}
+
 func Logging(log *logger.Logger, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		c := statusCapturer{
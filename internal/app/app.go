@@ -9,9 +9,10 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	http_adapters "github.com/x0k/effective-mobile-song-library-service/internal/adapters/http"
 	pgx_adapter "github.com/x0k/effective-mobile-song-library-service/internal/adapters/pgx"
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/logger"
 	"github.com/x0k/effective-mobile-song-library-service/internal/lib/logger/sl"
 	"github.com/x0k/effective-mobile-song-library-service/internal/lib/music_info"
 	"github.com/x0k/effective-mobile-song-library-service/internal/songs"
@@ -24,34 +25,41 @@ func Run(configPath string) {
 	log := mustNewLogger(&cfg.Logger)
 	ctx := context.Background()
 
-	if err := pgx_adapter.Migrate(
-		ctx,
-		log.Logger.With(slog.String("component", "pgx_migrate")),
-		cfg.Postgres.ConnectionURI,
-		cfg.Postgres.MigrationsURI,
-	); err != nil {
-		log.Error(ctx, "cannot migrate database", sl.Err(err))
-		os.Exit(1)
-	}
+	pool := mustConnectPostgres(ctx, log, &cfg.Postgres)
+	defer pool.Close()
 
-	pgx, err := pgx.Connect(ctx, cfg.Postgres.ConnectionURI)
+	musicInfoClient, err := music_info.NewClientWithResponses(cfg.MusicInfoService.Address)
 	if err != nil {
-		log.Error(ctx, "cannot connect to postgres", sl.Err(err))
+		log.Error(ctx, "cannot create music info client", sl.Err(err))
 		os.Exit(1)
 	}
-	defer pgx.Close(ctx)
 
-	musicInfoClient, err := music_info.NewClientWithResponses(cfg.MusicInfoService.Address)
+	filterMacros, err := loadFilterMacros(cfg.Filter.MacrosPath)
 	if err != nil {
-		log.Error(ctx, "cannot create music info client", sl.Err(err))
+		log.Error(ctx, "cannot load filter macros", sl.Err(err))
 		os.Exit(1)
 	}
 
-	router := songs.New(
+	router, err := songs.New(
+		ctx,
 		log,
-		pgx,
+		pool,
 		musicInfoClient,
+		filterMacros,
+		cfg.Songs.TrashRetention,
+		cfg.Songs.IdempotencyKeyTTL,
+		cfg.Songs.ImportDateLayout,
 	)
+	if err != nil {
+		log.Error(ctx, "cannot create songs module", sl.Err(err))
+		os.Exit(1)
+	}
+
+	jobsCtx, stopJobs := context.WithCancel(ctx)
+	defer stopJobs()
+	go purgeTrash(jobsCtx, log, pool, &cfg.Songs)
+	go purgeIdempotencyKeys(jobsCtx, log, pool, &cfg.Songs)
+	go recountLyricsStats(jobsCtx, log, pool)
 
 	sLog := log.With(slog.String("component", "http_server"))
 	srv := http.Server{
@@ -78,6 +86,7 @@ func Run(configPath string) {
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 	s := <-stop
 	log.Info(ctx, "signal received", slog.String("signal", s.String()))
+	stopJobs()
 
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
@@ -88,3 +97,22 @@ func Run(configPath string) {
 	}
 	log.Info(ctx, "graceful shutdown")
 }
+
+func mustConnectPostgres(ctx context.Context, log *logger.Logger, cfg *PgConfig) *pgxpool.Pool {
+	if err := pgx_adapter.Migrate(
+		ctx,
+		log.Logger.With(slog.String("component", "pgx_migrate")),
+		cfg.ConnectionURI,
+		cfg.MigrationsURI,
+	); err != nil {
+		log.Error(ctx, "cannot migrate database", sl.Err(err))
+		os.Exit(1)
+	}
+
+	pool, err := pgxpool.New(ctx, cfg.ConnectionURI)
+	if err != nil {
+		log.Error(ctx, "cannot connect to postgres", sl.Err(err))
+		os.Exit(1)
+	}
+	return pool
+}
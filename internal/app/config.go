@@ -3,6 +3,7 @@ package app
 import (
 	"log"
 	"os"
+	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
@@ -21,6 +22,23 @@ type PgConfig struct {
 	MigrationsURI string `env:"PG_MIGRATIONS_URI" env-default:"file://migrations"`
 }
 
+type FilterConfig struct {
+	MacrosPath string `env:"FILTER_MACROS_PATH"`
+}
+
+type SongsConfig struct {
+	// How long deleted songs are kept in the trash
+	TrashRetention time.Duration `env:"SONGS_TRASH_RETENTION" env-default:"720h"`
+	// How often expired songs are purged from the trash, zero disables the purge
+	TrashPurgeInterval time.Duration `env:"SONGS_TRASH_PURGE_INTERVAL" env-default:"1h"`
+	// How long responses of requests with the `Idempotency-Key` header are kept
+	IdempotencyKeyTTL time.Duration `env:"SONGS_IDEMPOTENCY_KEY_TTL" env-default:"24h"`
+	// How often expired idempotency keys are purged, zero disables the purge
+	IdempotencyKeyPurgeInterval time.Duration `env:"SONGS_IDEMPOTENCY_KEY_PURGE_INTERVAL" env-default:"1h"`
+	// Layout of the release dates in imported CSV, `02.01.2006` by default
+	ImportDateLayout string `env:"SONGS_IMPORT_DATE_LAYOUT"`
+}
+
 type ServerConfig struct {
 	Address string `env:"SERVER_ADDRESS" env-default:"0.0.0.0:8080"`
 }
@@ -30,6 +48,8 @@ type Config struct {
 	MusicInfoService MusicInfoServiceConfig
 	Postgres         PgConfig
 	Server           ServerConfig
+	Filter           FilterConfig
+	Songs            SongsConfig
 }
 
 func mustLoadConfig(configPath string) *Config {
@@ -0,0 +1,19 @@
+package app
+
+import (
+	"os"
+
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/filter"
+)
+
+func loadFilterMacros(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return filter.ParseMacros(f)
+}
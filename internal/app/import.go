@@ -0,0 +1,70 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/logger/sl"
+	"github.com/x0k/effective-mobile-song-library-service/internal/songs"
+)
+
+type ImportArgs struct {
+	// Path to the CSV file, `-` for the standard input
+	Path string
+	// Names of the CSV columns by the song fields
+	Columns    map[string]string
+	DateLayout string
+	DryRun     bool
+	Author     string
+}
+
+// Import creates songs from the CSV file, row errors are printed
+// to the standard error and nothing is saved if there are any
+func Import(configPath string, args ImportArgs) {
+	cfg := mustLoadConfig(configPath)
+	log := mustNewLogger(&cfg.Logger)
+	ctx := context.Background()
+
+	var r io.Reader = os.Stdin
+	if args.Path != "-" {
+		f, err := os.Open(args.Path)
+		if err != nil {
+			log.Error(ctx, "cannot open file", sl.Err(err))
+			os.Exit(1)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	pool := mustConnectPostgres(ctx, log, &cfg.Postgres)
+	defer pool.Close()
+
+	opts := songs.ImportOptions{
+		Columns:    make(map[songs.SongField]string, len(args.Columns)),
+		DateLayout: args.DateLayout,
+		DryRun:     args.DryRun,
+	}
+	for f, c := range args.Columns {
+		opts.Columns[songs.SongField(f)] = c
+	}
+	result, err := songs.Import(ctx, log, pool, r, opts, cfg.Songs.ImportDateLayout, args.Author)
+	if err != nil {
+		log.Error(ctx, "cannot import songs", sl.Err(err))
+		os.Exit(1)
+	}
+	for _, e := range result.Errors {
+		fmt.Fprintln(os.Stderr, e)
+	}
+	if len(result.Errors) > 0 {
+		log.Error(ctx, "invalid rows", slog.Int("count", len(result.Errors)))
+		os.Exit(1)
+	}
+	if args.DryRun {
+		log.Info(ctx, "rows are valid", slog.Int("count", len(result.Songs)))
+		return
+	}
+	log.Info(ctx, "songs are imported", slog.Int("count", len(result.Songs)))
+}
@@ -0,0 +1,21 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/logger"
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/logger/sl"
+	"github.com/x0k/effective-mobile-song-library-service/internal/songs"
+)
+
+// recountLyricsStats recounts statistics of the migrated songs in the background
+func recountLyricsStats(ctx context.Context, log *logger.Logger, pool *pgxpool.Pool) {
+	count, err := songs.RecountLyricsStats(ctx, log, pool)
+	if err != nil && ctx.Err() == nil {
+		log.Error(ctx, "cannot recount lyrics stats", sl.Err(err))
+	} else if count > 0 {
+		log.Info(ctx, "lyrics stats are recounted", slog.Int64("count", count))
+	}
+}
@@ -0,0 +1,56 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/logger"
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/logger/sl"
+	"github.com/x0k/effective-mobile-song-library-service/internal/songs"
+)
+
+// purgeTrash deletes expired songs from the trash on start
+// and then periodically until the context is canceled
+func purgeTrash(ctx context.Context, log *logger.Logger, pool *pgxpool.Pool, cfg *SongsConfig) {
+	purgePeriodically(ctx, log, "trash", cfg.TrashPurgeInterval, func(ctx context.Context) (int64, error) {
+		return songs.PurgeTrash(ctx, log, pool, cfg.TrashRetention)
+	})
+}
+
+// purgeIdempotencyKeys deletes expired idempotency keys on start
+// and then periodically until the context is canceled
+func purgeIdempotencyKeys(ctx context.Context, log *logger.Logger, pool *pgxpool.Pool, cfg *SongsConfig) {
+	purgePeriodically(ctx, log, "idempotency keys", cfg.IdempotencyKeyPurgeInterval, func(ctx context.Context) (int64, error) {
+		return songs.PurgeIdempotencyKeys(ctx, log, pool, cfg.IdempotencyKeyTTL)
+	})
+}
+
+func purgePeriodically(
+	ctx context.Context,
+	log *logger.Logger,
+	name string,
+	interval time.Duration,
+	purge func(context.Context) (int64, error),
+) {
+	if interval <= 0 {
+		log.Info(ctx, "periodic purge is disabled", slog.String("name", name))
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		count, err := purge(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Error(ctx, "cannot purge", slog.String("name", name), sl.Err(err))
+		} else if count > 0 {
+			log.Info(ctx, "purged", slog.String("name", name), slog.Int64("count", count))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package diff
+
+type Op int
+
+const (
+	Equal Op = iota
+	Insert
+	Delete
+)
+
+func (o Op) String() string {
+	switch o {
+	case Equal:
+		return "equal"
+	case Insert:
+		return "insert"
+	case Delete:
+		return "delete"
+	default:
+		return "unknown"
+	}
+}
+
+// Edit is a single step of the edit script, indexes are -1
+// if the value is absent in the corresponding sequence
+type Edit[T any] struct {
+	Op    Op
+	Old   int
+	New   int
+	Value T
+}
+
+// Slices returns the shortest edit script that transforms `a` into `b`,
+// based on the longest common subsequence. Deletions are placed
+// before insertions at the same position.
+func Slices[T comparable](a, b []T) []Edit[T] {
+	n, m := len(a), len(b)
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	edits := make([]Edit[T], 0, max(n, m))
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && a[i] == b[j]:
+			edits = append(edits, Edit[T]{Op: Equal, Old: i, New: j, Value: a[i]})
+			i++
+			j++
+		case i < n && (j == m || lcs[i+1][j] >= lcs[i][j+1]):
+			edits = append(edits, Edit[T]{Op: Delete, Old: i, New: -1, Value: a[i]})
+			i++
+		default:
+			edits = append(edits, Edit[T]{Op: Insert, Old: -1, New: j, Value: b[j]})
+			j++
+		}
+	}
+	return edits
+}
@@ -0,0 +1,86 @@
+package diff_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/diff"
+)
+
+func TestSlices(t *testing.T) {
+	tests := []struct {
+		name string
+		a    []string
+		b    []string
+		want []diff.Edit[string]
+	}{
+		{
+			name: "empty",
+			want: []diff.Edit[string]{},
+		},
+		{
+			name: "equal",
+			a:    []string{"a", "b"},
+			b:    []string{"a", "b"},
+			want: []diff.Edit[string]{
+				{Op: diff.Equal, Old: 0, New: 0, Value: "a"},
+				{Op: diff.Equal, Old: 1, New: 1, Value: "b"},
+			},
+		},
+		{
+			name: "insert",
+			a:    []string{"a", "c"},
+			b:    []string{"a", "b", "c"},
+			want: []diff.Edit[string]{
+				{Op: diff.Equal, Old: 0, New: 0, Value: "a"},
+				{Op: diff.Insert, Old: -1, New: 1, Value: "b"},
+				{Op: diff.Equal, Old: 1, New: 2, Value: "c"},
+			},
+		},
+		{
+			name: "delete",
+			a:    []string{"a", "b", "c"},
+			b:    []string{"b"},
+			want: []diff.Edit[string]{
+				{Op: diff.Delete, Old: 0, New: -1, Value: "a"},
+				{Op: diff.Equal, Old: 1, New: 0, Value: "b"},
+				{Op: diff.Delete, Old: 2, New: -1, Value: "c"},
+			},
+		},
+		{
+			name: "replace",
+			a:    []string{"a", "b", "c"},
+			b:    []string{"a", "x", "c"},
+			want: []diff.Edit[string]{
+				{Op: diff.Equal, Old: 0, New: 0, Value: "a"},
+				{Op: diff.Delete, Old: 1, New: -1, Value: "b"},
+				{Op: diff.Insert, Old: -1, New: 1, Value: "x"},
+				{Op: diff.Equal, Old: 2, New: 2, Value: "c"},
+			},
+		},
+		{
+			name: "move",
+			a:    []string{"a", "b"},
+			b:    []string{"b", "a"},
+			want: []diff.Edit[string]{
+				{Op: diff.Delete, Old: 0, New: -1, Value: "a"},
+				{Op: diff.Equal, Old: 1, New: 0, Value: "b"},
+				{Op: diff.Insert, Old: -1, New: 1, Value: "a"},
+			},
+		},
+		{
+			name: "from empty",
+			b:    []string{"a"},
+			want: []diff.Edit[string]{
+				{Op: diff.Insert, Old: -1, New: 0, Value: "a"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diff.Slices(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Slices() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
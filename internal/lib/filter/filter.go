@@ -53,15 +53,33 @@ var operators = []string{
 
 var operatorsTrie = lexer.OperatorsTrie(operators)
 
+var separatorsTable = lexer.NewSeparators(separators...)
+
 type ColumnConfig struct {
 	Name string
 	Type ValueType
+	// Table of the column, defaults to the filter table
+	Table string
+	// Lookup replaces equality comparisons and IN lists of the column
+	// with strings, LIKE still matches the column itself
+	Lookup *Lookup
+}
+
+// Lookup describes a predicate that is used instead of the equality
+// comparison, e.g. to match the value against a table of aliases.
+type Lookup struct {
+	// Normalize is applied to the compared value
+	Normalize func(string) string
+	// SQL template, the value is referenced as `$1`
+	SQL string
 }
 
 type Filter struct {
 	table       string
 	schema      map[string]ColumnConfig
 	dateFactory func(string) (any, error)
+	macros      map[string]Expr
+	predicates  map[string]PredicateConfig
 }
 
 func New(
@@ -69,6 +87,17 @@ func New(
 	schema map[string]ColumnConfig,
 	dateFactory func(string) (any, error),
 ) *Filter {
+	for name, col := range schema {
+		if col.Lookup == nil {
+			continue
+		}
+		if err := validatePredicateSQL(PredicateConfig{
+			Args: []ValueType{StringType},
+			SQL:  col.Lookup.SQL,
+		}); err != nil {
+			panic(fmt.Sprintf("invalid lookup of column %s: %s", name, err))
+		}
+	}
 	return &Filter{
 		table:       table,
 		schema:      schema,
@@ -76,9 +105,14 @@ func New(
 	}
 }
 
+// HasColumn reports whether the name is a column of the schema
+func (p *Filter) HasColumn(name string) bool {
+	_, ok := p.schema[name]
+	return ok
+}
+
 func (p *Filter) Parse(str string) (Expr, error) {
-	l := lexer.New(operatorsTrie, separators, str)
-	expr, err := p.parse(l)
+	expr, err := p.parseExpr(str)
 	if err != nil {
 		return nil, err
 	}
@@ -88,6 +122,21 @@ func (p *Filter) Parse(str string) (Expr, error) {
 	return expr, nil
 }
 
+func (p *Filter) parseExpr(str string) (Expr, error) {
+	l := lexer.New(operatorsTrie, separatorsTable, str)
+	expr, err := p.parse(l)
+	if err != nil {
+		return nil, err
+	}
+	if l.Next() {
+		return nil, fmt.Errorf("%w: unexpected token %v after expression", ErrInvalidExpression, l.Token())
+	}
+	if err := l.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidExpression, err)
+	}
+	return expr, nil
+}
+
 var ErrInvalidExpression = errors.New("invalid expression")
 
 type ValueType string
@@ -194,8 +243,10 @@ func (a Array) ToSQL(w *strings.Builder, args []any) []any {
 
 type Column struct {
 	node
-	t    ValueType
-	name string
+	t      ValueType
+	table  string
+	name   string
+	lookup *Lookup
 }
 
 func (c Column) Type() ValueType {
@@ -204,7 +255,7 @@ func (c Column) Type() ValueType {
 
 func (c Column) ToSQL(w *strings.Builder, args []any) []any {
 	w.WriteByte('"')
-	w.WriteString(c.p.table)
+	w.WriteString(c.table)
 	w.WriteString("\".\"")
 	w.WriteString(c.name)
 	w.WriteByte('"')
@@ -397,6 +448,60 @@ func (p *Filter) node(t lexer.Token) node {
 	}
 }
 
+func (p *Filter) column(n node, col ColumnConfig) Column {
+	table := col.Table
+	if table == "" {
+		table = p.table
+	}
+	return Column{
+		node:   n,
+		t:      col.Type,
+		table:  table,
+		name:   col.Name,
+		lookup: col.Lookup,
+	}
+}
+
+// equal replaces the comparison of a column with a string
+// by the column lookup
+func (p *Filter) equal(op binaryOp) Expr {
+	col, isCol := op.left.(Column)
+	val, isStr := op.right.(String)
+	if !isCol || !isStr {
+		col, isCol = op.right.(Column)
+		val, isStr = op.left.(String)
+	}
+	if !isCol || !isStr || col.lookup == nil {
+		return Equal(op)
+	}
+	if col.lookup.Normalize != nil {
+		val.val = col.lookup.Normalize(val.val)
+	}
+	return Predicate{
+		node: op.node,
+		sql:  col.lookup.SQL,
+		args: []Expr{val},
+	}
+}
+
+// in replaces the membership test of a column in a list of strings
+// by the column lookup of each string
+func (p *Filter) in(op binaryOp) Expr {
+	col, isCol := op.left.(Column)
+	arr, isArr := op.right.(Array)
+	if !isCol || !isArr || col.lookup == nil || len(arr.vals) == 0 {
+		return in(op)
+	}
+	args := make([]Expr, len(arr.vals))
+	for i, v := range arr.vals {
+		args[i] = p.equal(binaryOp{node: op.node, left: col, right: v})
+	}
+	if len(args) == 1 {
+		return args[0]
+	}
+	return Or{node: op.node, args: args}
+}
+
 func (p *Filter) parse(l *lexer.Lexer) (Expr, error) {
 	if !l.Next() {
 		return nil, fmt.Errorf("%w: unexpected end of expression", ErrInvalidExpression)
@@ -413,15 +518,21 @@ func (p *Filter) parse(l *lexer.Lexer) (Expr, error) {
 			val:  t.Value,
 		}, nil
 	case lexer.SymbolToken:
+		if strings.HasPrefix(t.Value, macroPrefix) {
+			m, ok := p.macros[t.Value]
+			if !ok {
+				return nil, fmt.Errorf("%w: unknown macro %v", ErrInvalidExpression, t)
+			}
+			return m, nil
+		}
+		if pc, ok := p.predicates[t.Value]; ok {
+			return p.parsePredicate(l, t, pc)
+		}
 		col, ok := p.schema[t.Value]
 		if !ok {
 			return nil, fmt.Errorf("%w: unknown symbol token %v", ErrInvalidExpression, t)
 		}
-		return Column{
-			node: p.node(t),
-			t:    col.Type,
-			name: col.Name,
-		}, nil
+		return p.column(p.node(t), col), nil
 	case lexer.SeparatorToken:
 		switch t.Value {
 		case commaSep, closeParenSep:
@@ -458,7 +569,7 @@ func (p *Filter) parse(l *lexer.Lexer) (Expr, error) {
 			if op.left.Type() != op.right.Type() {
 				return nil, fmt.Errorf("%w: type mismatch in %v", ErrInvalidExpression, t)
 			}
-			return Equal(op), nil
+			return p.equal(op), nil
 		case inOp:
 			op, err := p.parseBinary(l, t)
 			if err != nil {
@@ -467,7 +578,7 @@ func (p *Filter) parse(l *lexer.Lexer) (Expr, error) {
 			if !isArrayType(op.right.Type()) || op.left.Type() != arrayItemType(op.right.Type()) {
 				return nil, fmt.Errorf("%w: type mismatch in %v", ErrInvalidExpression, t)
 			}
-			return in(op), nil
+			return p.in(op), nil
 		case greaterOp:
 			op, err := p.parseBinary(l, t)
 			if err != nil {
@@ -552,7 +663,7 @@ func (p *Filter) parse(l *lexer.Lexer) (Expr, error) {
 			if err != nil {
 				return nil, err
 			}
-			if c, ok := op.left.(Column); !ok && c.Type() != ArrayOf(StringType) {
+			if c, ok := op.left.(Column); !ok || c.Type() != ArrayOf(StringType) {
 				return nil, fmt.Errorf("%w: unexpected type %v in %v", ErrInvalidExpression, op.left, t)
 			}
 			if _, ok := op.right.(String); !ok {
@@ -21,6 +21,11 @@ func TestFilter_Parse(t *testing.T) {
 			Name: "date_column",
 			Type: DateType,
 		},
+		"joined_column": {
+			Name:  "name",
+			Type:  StringType,
+			Table: "joined",
+		},
 	}, func(s string) (any, error) {
 		return s, nil
 	})
@@ -79,6 +84,17 @@ func TestFilter_Parse(t *testing.T) {
 				`%pattern%`,
 			},
 		},
+		{
+			name:     "joined column",
+			input:    `EQ(joined_column, "value")`,
+			wantSql:  `"joined"."name" = $1`,
+			wantArgs: []any{"value"},
+		},
+		{
+			name:  "alike with non array column",
+			input: `ALIKE(string_column, "%pattern%")`,
+			err:   ErrInvalidExpression,
+		},
 		{
 			name:    "date",
 			input:   `EQ(date_column, DATE("2022-01-01"))`,
@@ -109,3 +125,28 @@ func TestFilter_Parse(t *testing.T) {
 		})
 	}
 }
+
+func BenchmarkFilter_Parse(b *testing.B) {
+	filter := New("song", map[string]ColumnConfig{
+		"id":          {Name: "id", Type: NumberType},
+		"song":        {Name: "title", Type: StringType},
+		"group":       {Name: "artist", Type: StringType},
+		"releaseDate": {Name: "release_date", Type: DateType},
+		"text":        {Name: "lyrics", Type: ArrayOf(StringType)},
+	}, func(s string) (any, error) {
+		return s, nil
+	})
+	inputs := []string{
+		`EQ(group, "Muse")`,
+		`AND(EQ(group, "Muse"), ALIKE(text, "%can you hear me%"), EQ(releaseDate, DATE("16.07.2006")))`,
+		`OR(IN(id, (1, 2, 3, 4, 5)), AND(GTE(releaseDate, DATE("01.01.2000")), LIKE(song, "%\"love\"%")))`,
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, input := range inputs {
+			if _, err := filter.Parse(input); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
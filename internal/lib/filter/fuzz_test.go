@@ -0,0 +1,61 @@
+package filter
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var placeholderRegExp = regexp.MustCompile(`\$(\d+)`)
+
+func FuzzFilter_Parse(f *testing.F) {
+	f.Add("")
+	f.Add("EQ(1, 1)")
+	f.Add("IN(1, (2, 3, 4))")
+	f.Add(`IN("value", array_column)`)
+	f.Add(`OR(EQ(1, 1), EQ(2, 2), EQ(3, 3))`)
+	f.Add(`LIKE(string_column, "%pattern%")`)
+	f.Add(`ALIKE(array_column, "%pattern%")`)
+	f.Add(`AND(EQ(date_column, DATE("2022-01-01")), NOT(EQ(number_column, 1)))`)
+	filter := New("test", map[string]ColumnConfig{
+		"number_column": {
+			Name: "number_column",
+			Type: NumberType,
+		},
+		"string_column": {
+			Name: "string_column",
+			Type: StringType,
+		},
+		"array_column": {
+			Name: "array_column",
+			Type: ArrayOf(StringType),
+		},
+		"date_column": {
+			Name: "date_column",
+			Type: DateType,
+		},
+	}, func(s string) (any, error) {
+		return s, nil
+	})
+	f.Fuzz(func(t *testing.T, input string) {
+		expr, err := filter.Parse(input)
+		if err != nil {
+			return
+		}
+		if expr.Type() != BoolType {
+			t.Fatalf("Filter.Parse() returned expression of type %v", expr.Type())
+		}
+		b := strings.Builder{}
+		args := expr.ToSQL(&b, nil)
+		placeholders := placeholderRegExp.FindAllStringSubmatch(b.String(), -1)
+		if len(placeholders) != len(args) {
+			t.Fatalf("SQL %q has %d placeholders, want %d", b.String(), len(placeholders), len(args))
+		}
+		for i, p := range placeholders {
+			if n, _ := strconv.Atoi(p[1]); n != i+1 {
+				t.Fatalf("SQL %q has placeholder $%d at index %d", b.String(), n, i)
+			}
+		}
+	})
+}
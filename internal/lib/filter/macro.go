@@ -0,0 +1,121 @@
+package filter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/lexer"
+)
+
+const (
+	macroPrefix     = "@"
+	macroDefinition = ":="
+)
+
+// DefineMacros compiles named expressions that can be referenced in filters
+// as `@name`, e.g. `AND(@classic, EQ(group, "Kino"))`.
+// Macros may reference each other and previously defined macros.
+// It is not safe to call DefineMacros concurrently with Parse.
+func (p *Filter) DefineMacros(definitions map[string]string) error {
+	prev := p.macros
+	p.macros = maps.Clone(prev)
+	if p.macros == nil {
+		p.macros = make(map[string]Expr, len(definitions))
+	}
+	c := macroCompiler{
+		filter:      p,
+		definitions: definitions,
+		visiting:    make(map[string]bool, len(definitions)),
+	}
+	for _, name := range slices.Sorted(maps.Keys(definitions)) {
+		if err := c.compile(name); err != nil {
+			p.macros = prev
+			return err
+		}
+	}
+	return nil
+}
+
+type macroCompiler struct {
+	filter      *Filter
+	definitions map[string]string
+	visiting    map[string]bool
+}
+
+func (c *macroCompiler) compile(name string) error {
+	if visiting, ok := c.visiting[name]; ok {
+		if visiting {
+			return fmt.Errorf("%w: macro %s is defined recursively", ErrInvalidExpression, name)
+		}
+		return nil
+	}
+	if err := validateMacroName(name); err != nil {
+		return err
+	}
+	c.visiting[name] = true
+	definition := c.definitions[name]
+	l := lexer.New(operatorsTrie, separatorsTable, definition)
+	for l.Next() {
+		t, ok := l.Token().(lexer.SymbolToken)
+		if !ok || !strings.HasPrefix(t.Value, macroPrefix) {
+			continue
+		}
+		if _, ok := c.definitions[t.Value]; !ok {
+			continue
+		}
+		if err := c.compile(t.Value); err != nil {
+			return err
+		}
+	}
+	expr, err := c.filter.parseExpr(definition)
+	if err != nil {
+		return fmt.Errorf("failed to compile macro %s: %w", name, err)
+	}
+	c.filter.macros[name] = expr
+	c.visiting[name] = false
+	return nil
+}
+
+func validateMacroName(name string) error {
+	l := lexer.New(operatorsTrie, separatorsTable, name)
+	if !l.Next() {
+		return fmt.Errorf("%w: invalid macro name %q", ErrInvalidExpression, name)
+	}
+	t, ok := l.Token().(lexer.SymbolToken)
+	if !ok || t.Value != name || len(name) <= len(macroPrefix) || !strings.HasPrefix(name, macroPrefix) {
+		return fmt.Errorf("%w: invalid macro name %q", ErrInvalidExpression, name)
+	}
+	return nil
+}
+
+// ParseMacros reads macro definitions in the `@name := expression` form,
+// one per line. Empty lines and lines starting with `#` are ignored.
+func ParseMacros(r io.Reader) (map[string]string, error) {
+	definitions := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, definition, ok := strings.Cut(line, macroDefinition)
+		if !ok {
+			return nil, fmt.Errorf("%w: expected macro definition at line %d", ErrInvalidExpression, lineNumber)
+		}
+		name = strings.TrimSpace(name)
+		if _, ok := definitions[name]; ok {
+			return nil, fmt.Errorf("%w: macro %s is already defined at line %d", ErrInvalidExpression, name, lineNumber)
+		}
+		definitions[name] = strings.TrimSpace(definition)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return definitions, nil
+}
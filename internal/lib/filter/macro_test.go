@@ -0,0 +1,148 @@
+package filter
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFilter_DefineMacros(t *testing.T) {
+	newFilter := func() *Filter {
+		return New("test", map[string]ColumnConfig{
+			"string_column": {
+				Name: "string_column",
+				Type: StringType,
+			},
+			"date_column": {
+				Name: "date_column",
+				Type: DateType,
+			},
+		}, func(s string) (any, error) {
+			return s, nil
+		})
+	}
+	tests := []struct {
+		name     string
+		macros   map[string]string
+		input    string
+		wantSql  string
+		wantArgs []any
+		err      error
+	}{
+		{
+			name: "macro",
+			macros: map[string]string{
+				"@classic": `LT(date_column, DATE("1990-01-01"))`,
+			},
+			input:    `AND(@classic, EQ(string_column, "Kino"))`,
+			wantSql:  `("test"."date_column" < $1 AND "test"."string_column" = $2)`,
+			wantArgs: []any{"1990-01-01", "Kino"},
+		},
+		{
+			name: "nested macros",
+			macros: map[string]string{
+				"@russian_rock": `AND(@classic, @kino)`,
+				"@classic":      `LT(date_column, DATE("1990-01-01"))`,
+				"@kino":         `EQ(string_column, "Kino")`,
+			},
+			input:    `NOT(@russian_rock)`,
+			wantSql:  `NOT (("test"."date_column" < $1 AND "test"."string_column" = $2))`,
+			wantArgs: []any{"1990-01-01", "Kino"},
+		},
+		{
+			name: "value macro",
+			macros: map[string]string{
+				"@groups": `("Kino", "Aria")`,
+			},
+			input:    `IN(string_column, @groups)`,
+			wantSql:  `"test"."string_column" IN ($1, $2)`,
+			wantArgs: []any{"Kino", "Aria"},
+		},
+		{
+			name: "value macro type mismatch",
+			macros: map[string]string{
+				"@groups": `("Kino", "Aria")`,
+			},
+			input: `AND(@groups, EQ(string_column, "Kino"))`,
+			err:   ErrInvalidExpression,
+		},
+		{
+			name:  "unknown macro",
+			input: `NOT(@unknown)`,
+			err:   ErrInvalidExpression,
+		},
+		{
+			name: "recursive macros",
+			macros: map[string]string{
+				"@a": `NOT(@b)`,
+				"@b": `NOT(@a)`,
+			},
+			err: ErrInvalidExpression,
+		},
+		{
+			name: "invalid macro name",
+			macros: map[string]string{
+				"@a b": `EQ(1, 1)`,
+			},
+			err: ErrInvalidExpression,
+		},
+		{
+			name: "invalid macro definition",
+			macros: map[string]string{
+				"@a": `EQ(unknown_column, 1)`,
+			},
+			err: ErrInvalidExpression,
+		},
+		{
+			name: "trailing tokens in macro definition",
+			macros: map[string]string{
+				"@a": `EQ(1, 1) EQ(2, 2)`,
+			},
+			err: ErrInvalidExpression,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := newFilter()
+			err := filter.DefineMacros(tt.macros)
+			if err == nil {
+				var got Expr
+				if got, err = filter.Parse(tt.input); err == nil {
+					b := strings.Builder{}
+					args := got.ToSQL(&b, nil)
+					if sql := b.String(); sql != tt.wantSql {
+						t.Errorf("Filter.Parse() = %v, want sql %v", sql, tt.wantSql)
+					}
+					if !reflect.DeepEqual(args, tt.wantArgs) {
+						t.Errorf("Filter.Parse() = %v, want args %v", args, tt.wantArgs)
+					}
+				}
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestParseMacros(t *testing.T) {
+	got, err := ParseMacros(strings.NewReader(`
+# Russian rock classics
+@classic := LT(releaseDate, DATE("01.01.1990"))
+@kino    := EQ(group, "Kino")
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"@classic": `LT(releaseDate, DATE("01.01.1990"))`,
+		"@kino":    `EQ(group, "Kino")`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseMacros() = %v, want %v", got, want)
+	}
+	if _, err := ParseMacros(strings.NewReader(`@classic LT(releaseDate, DATE("01.01.1990"))`)); !errors.Is(err, ErrInvalidExpression) {
+		t.Errorf("ParseMacros() error = %v, want %v", err, ErrInvalidExpression)
+	}
+}
@@ -0,0 +1,121 @@
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/lexer"
+)
+
+type PredicateConfig struct {
+	// Types of the predicate arguments
+	Args []ValueType
+	// SQL template, arguments are referenced as `$1`, `$2`, etc.
+	SQL string
+}
+
+type Predicate struct {
+	node
+	sql  string
+	args []Expr
+}
+
+func (e Predicate) Type() ValueType {
+	return BoolType
+}
+
+func (e Predicate) ToSQL(w *strings.Builder, args []any) []any {
+	sql := e.sql
+	for {
+		i := strings.IndexByte(sql, '$')
+		if i < 0 {
+			break
+		}
+		w.WriteString(sql[:i])
+		j := i + 1
+		for j < len(sql) && sql[j] >= '0' && sql[j] <= '9' {
+			j++
+		}
+		// Placeholders are validated by DefinePredicate
+		n, _ := strconv.Atoi(sql[i+1 : j])
+		args = e.args[n-1].ToSQL(w, args)
+		sql = sql[j:]
+	}
+	w.WriteString(sql)
+	return args
+}
+
+// DefinePredicate registers a custom predicate that can be used in filters
+// as `NAME(arg1, arg2)`, e.g. to express conditions on related tables.
+// It is not safe to call DefinePredicate concurrently with Parse.
+func (p *Filter) DefinePredicate(name string, config PredicateConfig) error {
+	if err := p.validatePredicateName(name); err != nil {
+		return err
+	}
+	if err := validatePredicateSQL(config); err != nil {
+		return fmt.Errorf("invalid predicate %s: %w", name, err)
+	}
+	if p.predicates == nil {
+		p.predicates = make(map[string]PredicateConfig)
+	}
+	p.predicates[name] = config
+	return nil
+}
+
+func (p *Filter) validatePredicateName(name string) error {
+	l := lexer.New(operatorsTrie, separatorsTable, name)
+	if !l.Next() {
+		return fmt.Errorf("%w: invalid predicate name %q", ErrInvalidExpression, name)
+	}
+	t, ok := l.Token().(lexer.SymbolToken)
+	if !ok || t.Value != name || strings.HasPrefix(name, macroPrefix) {
+		return fmt.Errorf("%w: invalid predicate name %q", ErrInvalidExpression, name)
+	}
+	if _, ok := p.schema[name]; ok {
+		return fmt.Errorf("%w: predicate name %q conflicts with column", ErrInvalidExpression, name)
+	}
+	return nil
+}
+
+func validatePredicateSQL(config PredicateConfig) error {
+	sql := config.SQL
+	for {
+		i := strings.IndexByte(sql, '$')
+		if i < 0 {
+			return nil
+		}
+		j := i + 1
+		for j < len(sql) && sql[j] >= '0' && sql[j] <= '9' {
+			j++
+		}
+		n, err := strconv.Atoi(sql[i+1 : j])
+		if err != nil || n < 1 || n > len(config.Args) {
+			return fmt.Errorf("%w: invalid placeholder at position %d", ErrInvalidExpression, len(config.SQL)-len(sql)+i)
+		}
+		sql = sql[j:]
+	}
+}
+
+func (p *Filter) parsePredicate(l *lexer.Lexer, t lexer.SymbolToken, config PredicateConfig) (Expr, error) {
+	if err := p.consumeSeparator(l, openParenSep); err != nil {
+		return nil, err
+	}
+	expressions, err := p.parseList(l)
+	if err != nil {
+		return nil, err
+	}
+	if len(expressions) != len(config.Args) {
+		return nil, fmt.Errorf("%w: unexpected number of expressions in %v", ErrInvalidExpression, t)
+	}
+	for i, e := range expressions {
+		if e.Type() != config.Args[i] {
+			return nil, fmt.Errorf("%w: type mismatch in %v", ErrInvalidExpression, t)
+		}
+	}
+	return Predicate{
+		node: p.node(t),
+		sql:  config.SQL,
+		args: expressions,
+	}, nil
+}
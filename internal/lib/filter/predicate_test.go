@@ -0,0 +1,240 @@
+package filter
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFilter_DefinePredicate(t *testing.T) {
+	newFilter := func() *Filter {
+		return New("test", map[string]ColumnConfig{
+			"string_column": {
+				Name: "string_column",
+				Type: StringType,
+			},
+		}, func(s string) (any, error) {
+			return s, nil
+		})
+	}
+	credit := PredicateConfig{
+		Args: []ValueType{StringType, StringType},
+		SQL:  `EXISTS (SELECT 1 FROM credit WHERE credit.test_id = "test"."id" AND credit.role = $1 AND credit.name = $2)`,
+	}
+	tests := []struct {
+		name      string
+		predicate string
+		config    PredicateConfig
+		input     string
+		wantSql   string
+		wantArgs  []any
+		err       error
+	}{
+		{
+			name:      "predicate",
+			predicate: "CREDIT",
+			config:    credit,
+			input:     `AND(CREDIT("featured", "Muse"), EQ(string_column, "song"))`,
+			wantSql:   `(EXISTS (SELECT 1 FROM credit WHERE credit.test_id = "test"."id" AND credit.role = $1 AND credit.name = $2) AND "test"."string_column" = $3)`,
+			wantArgs:  []any{"featured", "Muse", "song"},
+		},
+		{
+			name:      "repeated placeholder",
+			predicate: "ROLE",
+			config: PredicateConfig{
+				Args: []ValueType{StringType},
+				SQL:  `($1 = 'primary' OR "test"."role" = $1)`,
+			},
+			input:    `NOT(ROLE("featured"))`,
+			wantSql:  `NOT (($1 = 'primary' OR "test"."role" = $2))`,
+			wantArgs: []any{"featured", "featured"},
+		},
+		{
+			name:      "column argument",
+			predicate: "CREDIT",
+			config:    credit,
+			input:     `CREDIT("featured", string_column)`,
+			wantSql:   `EXISTS (SELECT 1 FROM credit WHERE credit.test_id = "test"."id" AND credit.role = $1 AND credit.name = "test"."string_column")`,
+			wantArgs:  []any{"featured"},
+		},
+		{
+			name:      "wrong number of arguments",
+			predicate: "CREDIT",
+			config:    credit,
+			input:     `CREDIT("Muse")`,
+			err:       ErrInvalidExpression,
+		},
+		{
+			name:      "argument type mismatch",
+			predicate: "CREDIT",
+			config:    credit,
+			input:     `CREDIT("featured", 1)`,
+			err:       ErrInvalidExpression,
+		},
+		{
+			name:      "missing arguments list",
+			predicate: "CREDIT",
+			config:    credit,
+			input:     `CREDIT`,
+			err:       ErrInvalidExpression,
+		},
+		{
+			name:      "invalid placeholder",
+			predicate: "CREDIT",
+			config: PredicateConfig{
+				Args: []ValueType{StringType},
+				SQL:  `credit.name = $2`,
+			},
+			err: ErrInvalidExpression,
+		},
+		{
+			name:      "column name conflict",
+			predicate: "string_column",
+			config:    credit,
+			err:       ErrInvalidExpression,
+		},
+		{
+			name:      "operator name",
+			predicate: "AND",
+			config:    credit,
+			err:       ErrInvalidExpression,
+		},
+		{
+			name:      "macro name",
+			predicate: "@credit",
+			config:    credit,
+			err:       ErrInvalidExpression,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := newFilter()
+			err := filter.DefinePredicate(tt.predicate, tt.config)
+			if err == nil {
+				var got Expr
+				if got, err = filter.Parse(tt.input); err == nil {
+					b := strings.Builder{}
+					args := got.ToSQL(&b, nil)
+					if sql := b.String(); sql != tt.wantSql {
+						t.Errorf("Filter.Parse() = %v, want sql %v", sql, tt.wantSql)
+					}
+					if !reflect.DeepEqual(args, tt.wantArgs) {
+						t.Errorf("Filter.Parse() = %v, want args %v", args, tt.wantArgs)
+					}
+				}
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestFilter_Lookup(t *testing.T) {
+	filter := New("test", map[string]ColumnConfig{
+		"name": {
+			Name: "name",
+			Type: StringType,
+			Lookup: &Lookup{
+				Normalize: strings.ToLower,
+				SQL:       `"test"."id" IN (SELECT test_id FROM alias WHERE key = $1)`,
+			},
+		},
+		"string_column": {
+			Name: "string_column",
+			Type: StringType,
+		},
+	}, func(s string) (any, error) {
+		return s, nil
+	})
+	tests := []struct {
+		name     string
+		input    string
+		query    string
+		wantSql  string
+		wantArgs []any
+	}{
+		{
+			name:     "eq",
+			input:    `EQ(name, "Beatles")`,
+			wantSql:  `"test"."id" IN (SELECT test_id FROM alias WHERE key = $1)`,
+			wantArgs: []any{"beatles"},
+		},
+		{
+			name:     "eq with reversed arguments",
+			input:    `NOT(EQ("Beatles", name))`,
+			wantSql:  `NOT ("test"."id" IN (SELECT test_id FROM alias WHERE key = $1))`,
+			wantArgs: []any{"beatles"},
+		},
+		{
+			name:     "eq with column",
+			input:    `EQ(name, string_column)`,
+			wantSql:  `"test"."name" = "test"."string_column"`,
+			wantArgs: nil,
+		},
+		{
+			name:     "like",
+			input:    `LIKE(name, "Beat%")`,
+			wantSql:  `"test"."name" ILIKE $1`,
+			wantArgs: []any{"Beat%"},
+		},
+		{
+			name:     "in",
+			input:    `IN(name, ("The Beatles", "Kino"))`,
+			wantSql:  `("test"."id" IN (SELECT test_id FROM alias WHERE key = $1) OR "test"."id" IN (SELECT test_id FROM alias WHERE key = $2))`,
+			wantArgs: []any{"the beatles", "kino"},
+		},
+		{
+			name:     "query parameter",
+			query:    "name[ne]=Beatles",
+			wantSql:  `NOT ("test"."id" IN (SELECT test_id FROM alias WHERE key = $1))`,
+			wantArgs: []any{"beatles"},
+		},
+		{
+			name:     "in query parameter",
+			query:    "name[in]=The Beatles,beatles",
+			wantSql:  `("test"."id" IN (SELECT test_id FROM alias WHERE key = $1) OR "test"."id" IN (SELECT test_id FROM alias WHERE key = $2))`,
+			wantArgs: []any{"the beatles", "beatles"},
+		},
+		{
+			name:     "single item in query parameter",
+			query:    "name[in]=Beatles",
+			wantSql:  `"test"."id" IN (SELECT test_id FROM alias WHERE key = $1)`,
+			wantArgs: []any{"beatles"},
+		},
+		{
+			name:     "like query parameter",
+			query:    "name[like]=Beat%25",
+			wantSql:  `"test"."name" ILIKE $1`,
+			wantArgs: []any{"Beat%"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Expr
+			var err error
+			if tt.query != "" {
+				var q url.Values
+				if q, err = url.ParseQuery(tt.query); err != nil {
+					t.Fatal(err)
+				}
+				got, err = filter.ParseQuery(q)
+			} else {
+				got, err = filter.Parse(tt.input)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := strings.Builder{}
+			args := got.ToSQL(&b, nil)
+			if sql := b.String(); sql != tt.wantSql {
+				t.Errorf("Filter.Parse() = %v, want sql %v", sql, tt.wantSql)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("Filter.Parse() = %v, want args %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package filter
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	eqParam   = "eq"
+	neParam   = "ne"
+	gtParam   = "gt"
+	gteParam  = "gte"
+	ltParam   = "lt"
+	lteParam  = "lte"
+	likeParam = "like"
+	inParam   = "in"
+)
+
+// ParseQuery translates query parameters like `group=Muse` or
+// `releaseDate[gte]=01.01.2000` into a predicate expression.
+// Parameters that are not in the schema are rejected, so other
+// parameters (e.g. pagination) must be removed from the query.
+// Values of `[in]` are separated by commas, `\,` is a literal comma
+// and `\\` is a literal backslash.
+// Returns nil if the query has no filter parameters.
+func (p *Filter) ParseQuery(query url.Values) (Expr, error) {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	var exprs []Expr
+	for _, key := range keys {
+		name, op, bracketed := strings.Cut(key, "[")
+		if bracketed {
+			if !strings.HasSuffix(op, "]") {
+				return nil, fmt.Errorf("%w: invalid filter parameter %q", ErrInvalidExpression, key)
+			}
+			op = op[:len(op)-1]
+		} else {
+			op = eqParam
+		}
+		col, ok := p.schema[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown column in filter parameter %q", ErrInvalidExpression, key)
+		}
+		for _, v := range query[key] {
+			expr, err := p.parseParam(col, op, v)
+			if err != nil {
+				return nil, fmt.Errorf("%w, parameter %q", err, key)
+			}
+			exprs = append(exprs, expr)
+		}
+	}
+	return AllOf(exprs...), nil
+}
+
+// AllOf joins predicates with AND, nil predicates are skipped.
+// Returns nil if there are no predicates.
+func AllOf(exprs ...Expr) Expr {
+	args := make([]Expr, 0, len(exprs))
+	for _, e := range exprs {
+		if e != nil {
+			args = append(args, e)
+		}
+	}
+	switch len(args) {
+	case 0:
+		return nil
+	case 1:
+		return args[0]
+	default:
+		return And{args: args}
+	}
+}
+
+func (p *Filter) parseParam(col ColumnConfig, op string, value string) (Expr, error) {
+	n := node{p: p}
+	column := p.column(n, col)
+	if isArrayType(col.Type) {
+		itemType := arrayItemType(col.Type)
+		switch op {
+		case eqParam, neParam:
+			item, err := p.paramValue(itemType, value)
+			if err != nil {
+				return nil, err
+			}
+			var expr Expr = in{node: n, left: item, right: column}
+			if op == neParam {
+				expr = Not{node: n, arg: expr}
+			}
+			return expr, nil
+		case likeParam:
+			if itemType != StringType {
+				break
+			}
+			return ALike{node: n, left: column, right: String{node: n, val: value}}, nil
+		}
+		return nil, fmt.Errorf("%w: unsupported operator %q for type %s", ErrInvalidExpression, op, col.Type)
+	}
+	if op == inParam {
+		items := splitList(value)
+		vals := make([]Expr, len(items))
+		for i, item := range items {
+			v, err := p.paramValue(col.Type, item)
+			if err != nil {
+				return nil, err
+			}
+			vals[i] = v
+		}
+		return p.in(binaryOp{
+			node:  n,
+			left:  column,
+			right: Array{node: n, t: ArrayOf(col.Type), vals: vals},
+		}), nil
+	}
+	if op == likeParam {
+		if col.Type != StringType {
+			return nil, fmt.Errorf("%w: unsupported operator %q for type %s", ErrInvalidExpression, op, col.Type)
+		}
+		return Like{node: n, left: column, right: String{node: n, val: value}}, nil
+	}
+	v, err := p.paramValue(col.Type, value)
+	if err != nil {
+		return nil, err
+	}
+	bin := binaryOp{node: n, left: column, right: v}
+	switch op {
+	case eqParam:
+		return p.equal(bin), nil
+	case neParam:
+		return Not{node: n, arg: p.equal(bin)}, nil
+	case gtParam:
+		return Greater(bin), nil
+	case gteParam:
+		return GreaterOrEqual(bin), nil
+	case ltParam:
+		return Less(bin), nil
+	case lteParam:
+		return LessOrEqual(bin), nil
+	default:
+		return nil, fmt.Errorf("%w: unknown operator %q", ErrInvalidExpression, op)
+	}
+}
+
+func (p *Filter) paramValue(t ValueType, value string) (Expr, error) {
+	n := node{p: p}
+	switch t {
+	case NumberType:
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to parse number %q, %s", ErrInvalidExpression, value, err)
+		}
+		return Number{node: n, val: v}, nil
+	case StringType:
+		return String{node: n, val: value}, nil
+	case DateType:
+		d, err := p.dateFactory(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to parse date %q, %s", ErrInvalidExpression, value, err)
+		}
+		return Date{node: n, val: d}, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported type %s", ErrInvalidExpression, t)
+	}
+}
+
+// splitList splits the comma separated list, backslash escapes the next character
+func splitList(value string) []string {
+	var items []string
+	b := strings.Builder{}
+	escaped := false
+	for _, c := range value {
+		switch {
+		case escaped:
+			escaped = false
+			b.WriteRune(c)
+		case c == '\\':
+			escaped = true
+		case c == ',':
+			items = append(items, b.String())
+			b.Reset()
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return append(items, b.String())
+}
@@ -0,0 +1,162 @@
+package filter
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFilter_ParseQuery(t *testing.T) {
+	filter := New("test", map[string]ColumnConfig{
+		"number_column": {
+			Name: "number_column",
+			Type: NumberType,
+		},
+		"string_column": {
+			Name: "string_column",
+			Type: StringType,
+		},
+		"array_column": {
+			Name: "array_column",
+			Type: ArrayOf(StringType),
+		},
+		"date_column": {
+			Name: "date_column",
+			Type: DateType,
+		},
+	}, func(s string) (any, error) {
+		return s, nil
+	})
+	tests := []struct {
+		name     string
+		query    string
+		wantSql  string
+		wantArgs []any
+		err      error
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:  "unknown plain parameter",
+			query: "string_colunm=value",
+			err:   ErrInvalidExpression,
+		},
+		{
+			name:     "eq",
+			query:    "string_column=value",
+			wantSql:  `"test"."string_column" = $1`,
+			wantArgs: []any{"value"},
+		},
+		{
+			name:     "ne",
+			query:    "number_column[ne]=1",
+			wantSql:  `NOT ("test"."number_column" = $1)`,
+			wantArgs: []any{int64(1)},
+		},
+		{
+			name:     "comparison",
+			query:    "date_column[gte]=2000-01-01&date_column[lt]=2010-01-01",
+			wantSql:  `("test"."date_column" >= $1 AND "test"."date_column" < $2)`,
+			wantArgs: []any{"2000-01-01", "2010-01-01"},
+		},
+		{
+			name:     "in",
+			query:    "number_column[in]=1,2,3",
+			wantSql:  `"test"."number_column" IN ($1, $2, $3)`,
+			wantArgs: []any{int64(1), int64(2), int64(3)},
+		},
+		{
+			name:     "in with escaped commas",
+			query:    `string_column[in]=a\,b,c\\,`,
+			wantSql:  `"test"."string_column" IN ($1, $2, $3)`,
+			wantArgs: []any{"a,b", `c\`, ""},
+		},
+		{
+			name:     "like",
+			query:    "string_column[like]=%25pattern%25",
+			wantSql:  `"test"."string_column" ILIKE $1`,
+			wantArgs: []any{"%pattern%"},
+		},
+		{
+			name:     "array like",
+			query:    "array_column[like]=%25pattern%25",
+			wantSql:  `EXISTS (SELECT 1 FROM unnest("test"."array_column") AS element WHERE element ILIKE $1)`,
+			wantArgs: []any{"%pattern%"},
+		},
+		{
+			name:     "array contains",
+			query:    "array_column=value",
+			wantSql:  `$1 = ANY("test"."array_column")`,
+			wantArgs: []any{"value"},
+		},
+		{
+			name:     "multiple values",
+			query:    "array_column[like]=%25a%25&array_column[like]=%25b%25&string_column=value",
+			wantSql:  `(EXISTS (SELECT 1 FROM unnest("test"."array_column") AS element WHERE element ILIKE $1) AND EXISTS (SELECT 1 FROM unnest("test"."array_column") AS element WHERE element ILIKE $2) AND "test"."string_column" = $3)`,
+			wantArgs: []any{"%a%", "%b%", "value"},
+		},
+		{
+			name:  "unknown column",
+			query: "unknown[eq]=1",
+			err:   ErrInvalidExpression,
+		},
+		{
+			name:  "unknown operator",
+			query: "number_column[between]=1",
+			err:   ErrInvalidExpression,
+		},
+		{
+			name:  "unclosed bracket",
+			query: "number_column[eq=1",
+			err:   ErrInvalidExpression,
+		},
+		{
+			name:  "invalid number",
+			query: "number_column=abc",
+			err:   ErrInvalidExpression,
+		},
+		{
+			name:  "like with number column",
+			query: "number_column[like]=1",
+			err:   ErrInvalidExpression,
+		},
+		{
+			name:  "comparison with array column",
+			query: "array_column[gt]=value",
+			err:   ErrInvalidExpression,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := filter.ParseQuery(query)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Filter.ParseQuery() error = %v, wantErr %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if got == nil {
+				if tt.wantSql != "" {
+					t.Fatalf("Filter.ParseQuery() = nil, want sql %v", tt.wantSql)
+				}
+				return
+			}
+			b := strings.Builder{}
+			args := got.ToSQL(&b, nil)
+			sql := b.String()
+			if sql != tt.wantSql {
+				t.Errorf("Filter.ParseQuery() = %v, want sql %v", sql, tt.wantSql)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("Filter.ParseQuery() = %v, want args %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
@@ -22,19 +22,60 @@ func (mr *HttpError) Error() string {
 	return mr.Text
 }
 
+const (
+	JSONMediaType       = "application/json"
+	MergePatchMediaType = "application/merge-patch+json"
+	JSONPatchMediaType  = "application/json-patch+json"
+)
+
+// MediaType returns the lower cased media type of the request
+// without parameters, empty string is returned if there is no Content-Type header
+func MediaType(r *http.Request) string {
+	return strings.ToLower(strings.TrimSpace(strings.Split(r.Header.Get("Content-Type"), ";")[0]))
+}
+
 type JsonBodyDecoder struct {
 	MaxBytes              int64
 	DisallowUnknownFields bool
 }
 
 func (d *JsonBodyDecoder) DecodeJSONBody(w http.ResponseWriter, r *http.Request, dst any) error {
-	ct := r.Header.Get("Content-Type")
-	if ct != "" {
-		mediaType := strings.ToLower(strings.TrimSpace(strings.Split(ct, ";")[0]))
-		if mediaType != "application/json" {
-			msg := "Content-Type header is not application/json"
-			return &HttpError{Status: http.StatusUnsupportedMediaType, Text: msg}
-		}
+	return d.decode(w, r, dst, JSONMediaType, d.DisallowUnknownFields)
+}
+
+// DecodeMergePatch decodes the JSON Merge Patch (RFC 7396) body
+func (d *JsonBodyDecoder) DecodeMergePatch(w http.ResponseWriter, r *http.Request) (MergePatch, error) {
+	var patch any
+	if err := d.decode(w, r, &patch, MergePatchMediaType, false); err != nil {
+		return MergePatch{}, err
+	}
+	return MergePatch{Patch: patch}, nil
+}
+
+// DecodeJSONPatch decodes the JSON Patch (RFC 6902) body,
+// unknown members of operations are ignored
+func (d *JsonBodyDecoder) DecodeJSONPatch(w http.ResponseWriter, r *http.Request) (JSONPatch, error) {
+	var ops []patchOperationJSON
+	if err := d.decode(w, r, &ops, JSONPatchMediaType, false); err != nil {
+		return nil, err
+	}
+	patch, err := newJSONPatch(ops)
+	if err != nil {
+		return nil, &HttpError{Status: http.StatusBadRequest, Text: err.Error()}
+	}
+	return patch, nil
+}
+
+func (d *JsonBodyDecoder) decode(
+	w http.ResponseWriter,
+	r *http.Request,
+	dst any,
+	mediaType string,
+	disallowUnknownFields bool,
+) error {
+	if mt := MediaType(r); mt != "" && mt != mediaType {
+		msg := fmt.Sprintf("Content-Type header is not %s", mediaType)
+		return &HttpError{Status: http.StatusUnsupportedMediaType, Text: msg}
 	}
 
 	if d.MaxBytes > 0 {
@@ -43,7 +84,7 @@ func (d *JsonBodyDecoder) DecodeJSONBody(w http.ResponseWriter, r *http.Request,
 
 	dec := json.NewDecoder(r.Body)
 
-	if d.DisallowUnknownFields {
+	if disallowUnknownFields {
 		dec.DisallowUnknownFields()
 	}
 
@@ -100,14 +141,45 @@ func JSONBody[T any](
 ) (T, *HttpError) {
 	var dst T
 	if err := decoder.DecodeJSONBody(w, r, &dst); err != nil {
-		var mr *HttpError
-		if errors.As(err, &mr) {
-			return dst, mr
-		}
-		log.LogAttrs(r.Context(), slog.LevelError, "failed to decode request body", slog.String("error", err.Error()))
-		mr.Status = http.StatusInternalServerError
-		mr.Text = http.StatusText(http.StatusInternalServerError)
-		return dst, mr
+		return dst, bodyError(log, r, err)
 	}
 	return dst, nil
 }
+
+func MergePatchBody(
+	log *slog.Logger,
+	decoder *JsonBodyDecoder,
+	w http.ResponseWriter,
+	r *http.Request,
+) (MergePatch, *HttpError) {
+	patch, err := decoder.DecodeMergePatch(w, r)
+	if err != nil {
+		return patch, bodyError(log, r, err)
+	}
+	return patch, nil
+}
+
+func JSONPatchBody(
+	log *slog.Logger,
+	decoder *JsonBodyDecoder,
+	w http.ResponseWriter,
+	r *http.Request,
+) (JSONPatch, *HttpError) {
+	patch, err := decoder.DecodeJSONPatch(w, r)
+	if err != nil {
+		return patch, bodyError(log, r, err)
+	}
+	return patch, nil
+}
+
+func bodyError(log *slog.Logger, r *http.Request, err error) *HttpError {
+	var mr *HttpError
+	if errors.As(err, &mr) {
+		return mr
+	}
+	log.LogAttrs(r.Context(), slog.LevelError, "failed to decode request body", slog.String("error", err.Error()))
+	return &HttpError{
+		Status: http.StatusInternalServerError,
+		Text:   http.StatusText(http.StatusInternalServerError),
+	}
+}
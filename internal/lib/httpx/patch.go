@@ -0,0 +1,363 @@
+package httpx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidPatch = errors.New("invalid patch")
+var ErrPathNotFound = errors.New("path not found")
+var ErrTestFailed = errors.New("test failed")
+
+// Patch changes the JSON document decoded into `any`,
+// the document may be modified in place
+type Patch interface {
+	Apply(doc any) (any, error)
+}
+
+// MergePatch is the JSON Merge Patch (RFC 7396)
+type MergePatch struct {
+	Patch any
+}
+
+func (p MergePatch) Apply(doc any) (any, error) {
+	return mergePatch(doc, p.Patch), nil
+}
+
+func mergePatch(target any, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = make(map[string]any, len(p))
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+	return t
+}
+
+const (
+	AddOp     = "add"
+	RemoveOp  = "remove"
+	ReplaceOp = "replace"
+	MoveOp    = "move"
+	CopyOp    = "copy"
+	TestOp    = "test"
+)
+
+// PatchOperation is the operation of the JSON Patch
+// with parsed JSON Pointers
+type PatchOperation struct {
+	Op    string
+	Path  []string
+	From  []string
+	Value any
+}
+
+// JSONPatch is the JSON Patch (RFC 6902), operations are applied in order
+// and the patch fails on the first failed operation
+type JSONPatch []PatchOperation
+
+type patchOperationJSON struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+func newJSONPatch(ops []patchOperationJSON) (JSONPatch, error) {
+	patch := make(JSONPatch, len(ops))
+	for i, o := range ops {
+		op, err := newPatchOperation(o)
+		if err != nil {
+			return nil, fmt.Errorf("%w: operation %d: %w", ErrInvalidPatch, i, err)
+		}
+		patch[i] = op
+	}
+	return patch, nil
+}
+
+func newPatchOperation(o patchOperationJSON) (PatchOperation, error) {
+	op := PatchOperation{Op: o.Op}
+	switch o.Op {
+	case AddOp, RemoveOp, ReplaceOp, MoveOp, CopyOp, TestOp:
+	default:
+		return op, fmt.Errorf("unknown operation %q", o.Op)
+	}
+	if o.Path == nil {
+		return op, errors.New("missing path")
+	}
+	var err error
+	if op.Path, err = ParsePointer(*o.Path); err != nil {
+		return op, err
+	}
+	switch o.Op {
+	case AddOp, ReplaceOp, TestOp:
+		// An explicit null is a value
+		if o.Value == nil {
+			return op, errors.New("missing value")
+		}
+		if err := json.Unmarshal(o.Value, &op.Value); err != nil {
+			return op, err
+		}
+	case MoveOp, CopyOp:
+		if o.From == nil {
+			return op, errors.New("missing from")
+		}
+		if op.From, err = ParsePointer(*o.From); err != nil {
+			return op, err
+		}
+		if o.Op == MoveOp && len(op.From) < len(op.Path) && isPrefix(op.From, op.Path) {
+			return op, errors.New("value can't be moved into its child")
+		}
+	}
+	return op, nil
+}
+
+// ParsePointer splits the JSON Pointer (RFC 6901) into unescaped
+// reference tokens, the empty pointer references the whole document
+func ParsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, fmt.Errorf("pointer %q does not start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func isPrefix(prefix []string, path []string) bool {
+	for i, t := range prefix {
+		if path[i] != t {
+			return false
+		}
+	}
+	return true
+}
+
+func (p JSONPatch) Apply(doc any) (any, error) {
+	for i, op := range p {
+		var err error
+		if doc, err = op.apply(doc); err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, pointer(op.Path), err)
+		}
+	}
+	return doc, nil
+}
+
+func (o PatchOperation) apply(doc any) (any, error) {
+	switch o.Op {
+	case AddOp:
+		return add(doc, o.Path, copyValue(o.Value))
+	case RemoveOp:
+		doc, _, err := remove(doc, o.Path)
+		return doc, err
+	case ReplaceOp:
+		if len(o.Path) == 0 {
+			return copyValue(o.Value), nil
+		}
+		doc, _, err := remove(doc, o.Path)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, o.Path, copyValue(o.Value))
+	case MoveOp:
+		doc, v, err := remove(doc, o.From)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, o.Path, v)
+	case CopyOp:
+		v, err := get(doc, o.From)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, o.Path, copyValue(v))
+	case TestOp:
+		v, err := get(doc, o.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(v, o.Value) {
+			return nil, ErrTestFailed
+		}
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown operation %q", ErrInvalidPatch, o.Op)
+	}
+}
+
+func get(doc any, path []string) (any, error) {
+	for _, t := range path {
+		switch c := doc.(type) {
+		case map[string]any:
+			v, ok := c[t]
+			if !ok {
+				return nil, ErrPathNotFound
+			}
+			doc = v
+		case []any:
+			idx, err := arrayIndex(t, len(c)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = c[idx]
+		default:
+			return nil, ErrPathNotFound
+		}
+	}
+	return doc, nil
+}
+
+// change replaces the parent container of the path with the result of fn
+func change(doc any, path []string, fn func(parent any, token string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+	switch c := doc.(type) {
+	case map[string]any:
+		v, ok := c[path[0]]
+		if !ok {
+			return nil, ErrPathNotFound
+		}
+		v, err := change(v, path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		c[path[0]] = v
+		return c, nil
+	case []any:
+		idx, err := arrayIndex(path[0], len(c)-1)
+		if err != nil {
+			return nil, err
+		}
+		if c[idx], err = change(c[idx], path[1:], fn); err != nil {
+			return nil, err
+		}
+		return c, nil
+	default:
+		return nil, ErrPathNotFound
+	}
+}
+
+func add(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return change(doc, path, func(parent any, token string) (any, error) {
+		switch c := parent.(type) {
+		case map[string]any:
+			c[token] = value
+			return c, nil
+		case []any:
+			idx := len(c)
+			if token != "-" {
+				var err error
+				if idx, err = arrayIndex(token, len(c)); err != nil {
+					return nil, err
+				}
+			}
+			c = append(c, nil)
+			copy(c[idx+1:], c[idx:])
+			c[idx] = value
+			return c, nil
+		default:
+			return nil, ErrPathNotFound
+		}
+	})
+}
+
+// remove returns the document without the value at the path and the removed value
+func remove(doc any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("%w: the document can't be removed", ErrInvalidPatch)
+	}
+	var removed any
+	doc, err := change(doc, path, func(parent any, token string) (any, error) {
+		switch c := parent.(type) {
+		case map[string]any:
+			v, ok := c[token]
+			if !ok {
+				return nil, ErrPathNotFound
+			}
+			removed = v
+			delete(c, token)
+			return c, nil
+		case []any:
+			idx, err := arrayIndex(token, len(c)-1)
+			if err != nil {
+				return nil, err
+			}
+			removed = c[idx]
+			return append(c[:idx], c[idx+1:]...), nil
+		default:
+			return nil, ErrPathNotFound
+		}
+	})
+	return doc, removed, err
+}
+
+// arrayIndex parses the array index token, the index can't be greater than max
+func arrayIndex(token string, max int) (int, error) {
+	if token == "" || len(token) > 1 && token[0] == '0' {
+		return 0, ErrPathNotFound
+	}
+	for _, r := range token {
+		if r < '0' || r > '9' {
+			return 0, ErrPathNotFound
+		}
+	}
+	idx, err := strconv.Atoi(token)
+	if err != nil || idx > max {
+		return 0, ErrPathNotFound
+	}
+	return idx, nil
+}
+
+// copyValue deeply copies the decoded JSON value
+func copyValue(v any) any {
+	switch c := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(c))
+		for k, v := range c {
+			m[k] = copyValue(v)
+		}
+		return m
+	case []any:
+		s := make([]any, len(c))
+		for i, v := range c {
+			s[i] = copyValue(v)
+		}
+		return s
+	default:
+		return v
+	}
+}
+
+func pointer(path []string) string {
+	b := strings.Builder{}
+	for _, t := range path {
+		b.WriteByte('/')
+		b.WriteString(escape(t))
+	}
+	return b.String()
+}
+
+func escape(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,227 @@
+package httpx_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/httpx"
+)
+
+func decodePatch(t *testing.T, mediaType string, body string) (httpx.Patch, error) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", mediaType)
+	d := &httpx.JsonBodyDecoder{MaxBytes: 1024 * 1024}
+	if mediaType == httpx.MergePatchMediaType {
+		return d.DecodeMergePatch(httptest.NewRecorder(), r)
+	}
+	return d.DecodeJSONPatch(httptest.NewRecorder(), r)
+}
+
+func decodeJSON(t *testing.T, data string) any {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal([]byte(data), &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestJSONPatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		patch   string
+		want    string
+		wantErr error
+	}{
+		{
+			name:  "add object member",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz", "value": "qux"}]`,
+			want:  `{"baz": "qux", "foo": "bar"}`,
+		},
+		{
+			name:  "add array element",
+			doc:   `{"foo": ["bar", "baz"]}`,
+			patch: `[{"op": "add", "path": "/foo/1", "value": "qux"}]`,
+			want:  `{"foo": ["bar", "qux", "baz"]}`,
+		},
+		{
+			name:  "append array element",
+			doc:   `{"foo": ["bar"]}`,
+			patch: `[{"op": "add", "path": "/foo/-", "value": ["abc"]}]`,
+			want:  `{"foo": ["bar", ["abc"]]}`,
+		},
+		{
+			name:  "remove array element",
+			doc:   `{"foo": ["bar", "qux", "baz"]}`,
+			patch: `[{"op": "remove", "path": "/foo/1"}]`,
+			want:  `{"foo": ["bar", "baz"]}`,
+		},
+		{
+			name:  "replace null",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "replace", "path": "/foo", "value": null}]`,
+			want:  `{"foo": null}`,
+		},
+		{
+			name:  "move array element",
+			doc:   `{"foo": ["all", "grass", "cows", "eat"]}`,
+			patch: `[{"op": "move", "from": "/foo/1", "path": "/foo/3"}]`,
+			want:  `{"foo": ["all", "cows", "eat", "grass"]}`,
+		},
+		{
+			name:  "copy is independent",
+			doc:   `{"foo": ["bar"]}`,
+			patch: `[{"op": "copy", "from": "/foo", "path": "/baz"}, {"op": "add", "path": "/baz/-", "value": "qux"}]`,
+			want:  `{"foo": ["bar"], "baz": ["bar", "qux"]}`,
+		},
+		{
+			name:  "escaped pointer",
+			doc:   `{"a/b": 1, "m~n": 2}`,
+			patch: `[{"op": "remove", "path": "/a~1b"}, {"op": "test", "path": "/m~0n", "value": 2}]`,
+			want:  `{"m~n": 2}`,
+		},
+		{
+			name:  "test",
+			doc:   `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+			patch: `[{"op": "test", "path": "/baz", "value": "qux"}, {"op": "test", "path": "/foo/1", "value": 2}]`,
+			want:  `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+		},
+		{
+			name:    "failed test",
+			doc:     `{"baz": "qux"}`,
+			patch:   `[{"op": "test", "path": "/baz", "value": "bar"}]`,
+			wantErr: httpx.ErrTestFailed,
+		},
+		{
+			name:    "missing member",
+			doc:     `{"foo": "bar"}`,
+			patch:   `[{"op": "replace", "path": "/baz", "value": 1}]`,
+			wantErr: httpx.ErrPathNotFound,
+		},
+		{
+			name:    "out of bounds",
+			doc:     `{"foo": ["bar"]}`,
+			patch:   `[{"op": "add", "path": "/foo/2", "value": "qux"}]`,
+			wantErr: httpx.ErrPathNotFound,
+		},
+		{
+			name:    "leading zero",
+			doc:     `{"foo": ["bar", "baz"]}`,
+			patch:   `[{"op": "remove", "path": "/foo/01"}]`,
+			wantErr: httpx.ErrPathNotFound,
+		},
+		{
+			name:    "missing value",
+			doc:     `{}`,
+			patch:   `[{"op": "add", "path": "/foo"}]`,
+			wantErr: httpx.ErrInvalidPatch,
+		},
+		{
+			name:    "unknown operation",
+			doc:     `{}`,
+			patch:   `[{"op": "merge", "path": "/foo", "value": 1}]`,
+			wantErr: httpx.ErrInvalidPatch,
+		},
+		{
+			name:    "move into child",
+			doc:     `{"foo": {"bar": 1}}`,
+			patch:   `[{"op": "move", "from": "/foo", "path": "/foo/bar"}]`,
+			wantErr: httpx.ErrInvalidPatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := decodePatch(t, httpx.JSONPatchMediaType, tt.patch)
+			if err != nil {
+				if tt.wantErr != nil && strings.Contains(err.Error(), tt.wantErr.Error()) {
+					return
+				}
+				t.Fatalf("unexpected decode error: %v", err)
+			}
+			got, err := p.Apply(decodeJSON(t, tt.doc))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := decodeJSON(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("expected %v, got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{
+			name:  "replace",
+			doc:   `{"a": "b"}`,
+			patch: `{"a": "c"}`,
+			want:  `{"a": "c"}`,
+		},
+		{
+			name:  "remove",
+			doc:   `{"a": "b", "b": "c"}`,
+			patch: `{"a": null}`,
+			want:  `{"b": "c"}`,
+		},
+		{
+			name:  "replace array",
+			doc:   `{"a": ["b"]}`,
+			patch: `{"a": ["c", "d"]}`,
+			want:  `{"a": ["c", "d"]}`,
+		},
+		{
+			name:  "nested",
+			doc:   `{"e": null, "a": {"b": "c", "d": "e"}}`,
+			patch: `{"a": {"b": null, "f": "g"}}`,
+			want:  `{"e": null, "a": {"d": "e", "f": "g"}}`,
+		},
+		{
+			name:  "not an object",
+			doc:   `{"a": "b"}`,
+			patch: `["c"]`,
+			want:  `["c"]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := decodePatch(t, httpx.MergePatchMediaType, tt.patch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := p.Apply(decodeJSON(t, tt.doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := decodeJSON(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("expected %v, got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestPatchMediaType(t *testing.T) {
+	_, err := decodePatch(t, httpx.JSONMediaType, `[]`)
+	var httpErr *httpx.HttpError
+	if !errors.As(err, &httpErr) || httpErr.Status != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected unsupported media type, got %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package lexer
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// byteOffset returns the byte offset of the rune with the given index,
+// invalid bytes are counted as separate runes as the lexer does
+func byteOffset(str string, index int) int {
+	i := 0
+	for offset := range str {
+		if i == index {
+			return offset
+		}
+		i++
+	}
+	return len(str)
+}
+
+func FuzzLexer(f *testing.F) {
+	f.Add("")
+	f.Add("123 456")
+	f.Add(`"a\"\\b"`)
+	f.Add("1,2:: \",::\"")
+	f.Add("123 as 10 assert,as")
+	f.Add("ык a,\"ё\"")
+	f.Add("\xffы,a")
+	operators := OperatorsTrie([]string{"as", "assert", "!=="})
+	separators := NewSeparators(',', ':', '(', ')')
+	f.Fuzz(func(t *testing.T, str string) {
+		l := New(operators, separators, str)
+		runes := utf8.RuneCountInString(str)
+		prev := -1
+		for l.Next() {
+			tok := l.Token()
+			if tok == nil {
+				t.Fatalf("nil token after position %d", prev)
+			}
+			pos := tok.Position()
+			if pos < 0 || pos >= runes {
+				t.Fatalf("position %d is out of bounds [0, %d)", pos, runes)
+			}
+			offset := byteOffset(str, pos)
+			switch tok := tok.(type) {
+			case SeparatorToken:
+				if r, _ := utf8.DecodeRuneInString(str[offset:]); r != tok.Value {
+					t.Fatalf("separator %q at position %d, got %q", tok.Value, pos, r)
+				}
+			case SymbolToken:
+				if !strings.HasPrefix(str[offset:], tok.Value) {
+					t.Fatalf("symbol %q is not at position %d", tok.Value, pos)
+				}
+			}
+			if pos <= prev {
+				t.Fatalf("position %d is not greater than previous position %d", pos, prev)
+			}
+			prev = pos
+		}
+		if l.Next() {
+			t.Fatalf("lexer continues after completion, error %v", l.Err())
+		}
+	})
+}
@@ -3,8 +3,10 @@ package lexer
 import (
 	"errors"
 	"fmt"
+	"slices"
 	"strconv"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/x0k/effective-mobile-song-library-service/internal/lib/trie"
 )
@@ -25,6 +27,7 @@ const (
 )
 
 type Token interface {
+	// Position is the offset of the token in runes
 	Position() int
 }
 
@@ -98,26 +101,63 @@ const (
 	symbolToken
 )
 
+// Separators is a precomputed lookup table of separator runes
+// that can be shared between lexers.
+type Separators struct {
+	ascii [utf8.RuneSelf]bool
+	other []rune
+}
+
+func NewSeparators(separators ...rune) *Separators {
+	s := &Separators{}
+	for _, sep := range separators {
+		if sep >= 0 && sep < utf8.RuneSelf {
+			s.ascii[sep] = true
+		} else if !slices.Contains(s.other, sep) {
+			s.other = append(s.other, sep)
+		}
+	}
+	return s
+}
+
+func (s *Separators) Contains(c rune) bool {
+	if s == nil {
+		return false
+	}
+	if c >= 0 && c < utf8.RuneSelf {
+		return s.ascii[c]
+	}
+	return slices.Contains(s.other, c)
+}
+
 type Lexer struct {
-	str        []rune
+	str        string
 	strLen     int
-	cursor     int
-	separators map[rune]struct{}
+	cursor     int // byte offset of the current rune
+	index      int // rune offset of the current rune
+	width      int
+	separators *Separators
 	operators  *trie.Node[rune, int]
 	strQuote   rune
 
-	done    bool
-	err     error
-	token   Token
-	state   state
-	pos     int
-	buff    []rune
-	escaped bool
-	node    *trie.Node[rune, int]
+	done      bool
+	err       error
+	state     state
+	start     int // byte offset of the token
+	pos       int // rune offset of the token
+	escaped   bool
+	unescape  bool
+	buff      []byte
+	node      *trie.Node[rune, int]
+	tokenType TokenType
+	number    int64
+	value     string
+	separator rune
+	operator  int
 }
 
 func NewWithOperators(operators []string, separators []rune, str string) *Lexer {
-	return New(OperatorsTrie(operators), separators, str)
+	return New(OperatorsTrie(operators), NewSeparators(separators...), str)
 }
 
 func OperatorsTrie(
@@ -132,21 +172,18 @@ func OperatorsTrie(
 
 func New(
 	operatorTrie *trie.Node[rune, int],
-	separators []rune,
+	separators *Separators,
 	str string,
 ) *Lexer {
-	sMap := make(map[rune]struct{}, len(separators))
-	for _, sep := range separators {
-		sMap[sep] = struct{}{}
-	}
 	sl := len(str)
 	return &Lexer{
-		str:        []rune(str),
+		str:        str,
 		strLen:     sl,
 		done:       sl == 0,
 		operators:  operatorTrie,
-		separators: sMap,
+		separators: separators,
 		strQuote:   '"',
+		tokenType:  -1,
 	}
 }
 
@@ -159,59 +196,95 @@ func (l *Lexer) Next() bool {
 		if l.done = l.err != nil; l.done {
 			return false
 		}
-		l.cursor++
-		if l.done = l.cursor >= l.strLen; l.done {
-			break
+		l.cursor += l.width
+		l.index++
+		if l.cursor >= l.strLen {
+			l.done = true
+			return l.finish()
 		}
 	}
-	if l.done {
-		switch l.state {
-		case idle:
-			return false
-		case strToken:
-			if l.str[l.strLen-1] != l.strQuote {
-				l.err = fmt.Errorf("%w: unclosed string, position %d", ErrInvalidString, l.pos)
-				return false
-			}
-			return true
-		case separatorToken:
-			return true
-		case numToken:
-			l.err = l.setNumberToken()
-			return true
-		case operatorToken:
-			l.setOperatorToken()
-			return true
-		case symbolToken:
-			l.setSymbolToken()
-			return true
-		default:
-			panic(fmt.Sprintf("unreachable: unexpected state %d, position %d", l.state, l.cursor))
-		}
+	if l.err != nil {
+		l.done = true
+		return false
 	}
-	return !l.done
+	return true
 }
 
+// Token materializes the last scanned token, so the scanning itself
+// does not allocate.
 func (l *Lexer) Token() Token {
-	return l.token
+	switch l.tokenType {
+	case Number:
+		return NumberToken{
+			token: newToken(l),
+			Value: l.number,
+		}
+	case String:
+		return StringToken{
+			token: newToken(l),
+			Value: l.value,
+		}
+	case Separator:
+		return SeparatorToken{
+			token: newToken(l),
+			Value: l.separator,
+		}
+	case Operator:
+		return OperatorToken{
+			token: newToken(l),
+			Value: l.operator,
+		}
+	case Symbol:
+		return SymbolToken{
+			token: newToken(l),
+			Value: l.value,
+		}
+	default:
+		return nil
+	}
 }
 
 func (l *Lexer) Err() error {
 	return l.err
 }
 
+func (l *Lexer) finish() bool {
+	switch l.state {
+	case idle:
+		return false
+	case strToken:
+		l.err = fmt.Errorf("%w: unclosed string, position %d", ErrInvalidString, l.pos)
+		return false
+	case numToken:
+		l.err = l.setNumberToken()
+		return l.err == nil
+	case operatorToken:
+		l.setOperatorToken()
+		return true
+	case symbolToken:
+		l.setSymbolToken()
+		return true
+	default:
+		panic(fmt.Sprintf("unreachable: unexpected state %d, position %d", l.state, l.index))
+	}
+}
+
 func (l *Lexer) idle() {
 	l.state = idle
-	l.buff = l.buff[:0]
 }
 
 func (l *Lexer) advance() {
-	l.cursor++
+	l.cursor += l.width
+	l.index++
 	l.done = l.cursor == l.strLen
 }
 
 func (l *Lexer) process() bool {
-	c := l.str[l.cursor]
+	c, w := rune(l.str[l.cursor]), 1
+	if c >= utf8.RuneSelf {
+		c, w = utf8.DecodeRuneInString(l.str[l.cursor:])
+	}
+	l.width = w
 	switch l.state {
 	case idle:
 		if l.isSeparator(c) {
@@ -224,9 +297,9 @@ func (l *Lexer) process() bool {
 		} else if unicode.IsDigit(c) {
 			l.err = l.startNum(c)
 		} else if l.isOperator(c) {
-			l.err = l.startOperator(c)
+			l.err = l.startOperator()
 		} else if !unicode.IsSpace(c) {
-			l.err = l.startSymbol(c)
+			l.err = l.startSymbol()
 		}
 		return true
 	case strToken:
@@ -234,15 +307,11 @@ func (l *Lexer) process() bool {
 			l.err = l.continueStr(c)
 			return true
 		}
-		l.token = StringToken{
-			token: newToken(l),
-			Value: string(l.buff),
-		}
+		l.setStringToken()
 		l.advance()
 		return false
 	case numToken:
 		if unicode.IsDigit(c) {
-			l.err = l.continueNum(c)
 			return true
 		}
 		if unicode.IsSpace(c) {
@@ -254,11 +323,11 @@ func (l *Lexer) process() bool {
 			l.err = l.setNumberToken()
 			return false
 		}
-		l.err = l.numToSymbol(c)
+		l.err = l.numToSymbol()
 		return true
 	case operatorToken:
 		if n := l.isOperatorContinuation(c); n != nil {
-			l.err = l.continueOperator(n, c)
+			l.err = l.continueOperator(n)
 			return true
 		}
 		if unicode.IsSpace(c) {
@@ -270,7 +339,7 @@ func (l *Lexer) process() bool {
 			l.setOperatorToken()
 			return false
 		}
-		l.err = l.operatorToSymbol(c)
+		l.err = l.operatorToSymbol()
 		return true
 	case symbolToken:
 		if l.isSeparator(c) {
@@ -282,71 +351,76 @@ func (l *Lexer) process() bool {
 			l.advance()
 			return false
 		}
-		l.err = l.continueSymbol(c)
 		return true
 	default:
-		panic(fmt.Sprintf("unreachable: emit on invalid state %d, at position %d", l.state, l.cursor))
+		panic(fmt.Sprintf("unreachable: emit on invalid state %d, at position %d", l.state, l.index))
 	}
 }
 
 func (l *Lexer) isSeparator(c rune) bool {
-	_, ok := l.separators[c]
-	return ok
+	return l.separators.Contains(c)
 }
 
 func (l *Lexer) setSeparatorToken(c rune) {
 	l.state = separatorToken
-	l.pos = l.cursor
-	l.token = SeparatorToken{
-		token: newToken(l),
-		Value: c,
-	}
+	l.start, l.pos = l.cursor, l.index
+	l.tokenType = Separator
+	l.separator = c
 }
 
 func (l *Lexer) startStr() error {
 	l.state = strToken
-	l.pos = l.cursor
+	l.start, l.pos = l.cursor, l.index
+	l.unescape = false
 	return nil
 }
 
 func (l *Lexer) continueStr(v rune) error {
 	l.escaped = v == '\\' && !l.escaped
-	if !l.escaped {
-		l.buff = append(l.buff, v)
-	}
+	l.unescape = l.unescape || l.escaped
 	return nil
 }
 
+func (l *Lexer) setStringToken() {
+	l.tokenType = String
+	l.value = l.str[l.start+1 : l.cursor]
+	if !l.unescape {
+		return
+	}
+	// Backslash is a single byte in UTF-8 and never occurs inside
+	// multibyte sequences, so the escapes can be removed bytewise
+	l.buff = l.buff[:0]
+	escaped := false
+	for i := 0; i < len(l.value); i++ {
+		b := l.value[i]
+		if escaped = b == '\\' && !escaped; !escaped {
+			l.buff = append(l.buff, b)
+		}
+	}
+	l.value = string(l.buff)
+}
+
 func (l *Lexer) startNum(c rune) error {
 	if c == '0' {
-		return fmt.Errorf("%w: leading zero, position %d", ErrInvalidNumber, l.cursor)
+		return fmt.Errorf("%w: leading zero, position %d", ErrInvalidNumber, l.index)
 	}
 	l.state = numToken
-	l.pos = l.cursor
-	l.buff = append(l.buff, c)
+	l.start, l.pos = l.cursor, l.index
 	return nil
 }
 
-func (l *Lexer) continueNum(c rune) error {
-	l.buff = append(l.buff, c)
-	return nil
-}
-
-func (l *Lexer) numToSymbol(c rune) error {
+func (l *Lexer) numToSymbol() error {
 	l.state = symbolToken
-	l.buff = append(l.buff, c)
 	return nil
 }
 
 func (l *Lexer) setNumberToken() error {
-	n, err := strconv.ParseInt(string(l.buff), 10, 64)
+	n, err := strconv.ParseInt(l.str[l.start:l.cursor], 10, 64)
 	if err != nil {
 		return fmt.Errorf("%w: failed to parse number %v, position %d", ErrInvalidNumber, err, l.pos)
 	}
-	l.token = NumberToken{
-		token: newToken(l),
-		Value: n,
-	}
+	l.tokenType = Number
+	l.number = n
 	return nil
 }
 
@@ -355,10 +429,9 @@ func (l *Lexer) isOperator(c rune) bool {
 	return l.node != nil
 }
 
-func (l *Lexer) startOperator(c rune) error {
+func (l *Lexer) startOperator() error {
 	l.state = operatorToken
-	l.pos = l.cursor
-	l.buff = append(l.buff, c)
+	l.start, l.pos = l.cursor, l.index
 	return nil
 }
 
@@ -366,14 +439,13 @@ func (l *Lexer) isOperatorContinuation(c rune) *trie.Node[rune, int] {
 	return trie.GetNode(l.node, c)
 }
 
-func (l *Lexer) continueOperator(node *trie.Node[rune, int], c rune) error {
+func (l *Lexer) continueOperator(node *trie.Node[rune, int]) error {
 	l.node = node
-	l.buff = append(l.buff, c)
 	return nil
 }
 
-func (l *Lexer) operatorToSymbol(c rune) error {
-	l.buff = append(l.buff, c)
+func (l *Lexer) operatorToSymbol() error {
+	l.state = symbolToken
 	return nil
 }
 
@@ -383,27 +455,17 @@ func (l *Lexer) setOperatorToken() {
 		l.setSymbolToken()
 		return
 	}
-	l.token = OperatorToken{
-		token: newToken(l),
-		Value: idx - 1,
-	}
+	l.tokenType = Operator
+	l.operator = idx - 1
 }
 
-func (l *Lexer) startSymbol(c rune) error {
+func (l *Lexer) startSymbol() error {
 	l.state = symbolToken
-	l.pos = l.cursor
-	l.buff = append(l.buff, c)
-	return nil
-}
-
-func (l *Lexer) continueSymbol(c rune) error {
-	l.buff = append(l.buff, c)
+	l.start, l.pos = l.cursor, l.index
 	return nil
 }
 
 func (l *Lexer) setSymbolToken() {
-	l.token = SymbolToken{
-		token: newToken(l),
-		Value: string(l.buff),
-	}
+	l.tokenType = Symbol
+	l.value = l.str[l.start:l.cursor]
 }
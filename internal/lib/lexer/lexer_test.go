@@ -57,6 +57,16 @@ func TestLexer(t *testing.T) {
 			tokenizer: New(nil, nil, `"abc`),
 			err:       ErrInvalidString,
 		},
+		{
+			name:      "invalid string (single quote)",
+			tokenizer: New(nil, nil, `"`),
+			err:       ErrInvalidString,
+		},
+		{
+			name:      "invalid string (escaped closing quote)",
+			tokenizer: New(nil, nil, `"abc\"`),
+			err:       ErrInvalidString,
+		},
 		{
 			name:      "escape sequence",
 			tokenizer: New(nil, nil, `"a\"\\b"`),
@@ -66,14 +76,14 @@ func TestLexer(t *testing.T) {
 		},
 		{
 			name:      "separator at the end",
-			tokenizer: New(nil, []rune{','}, ","),
+			tokenizer: New(nil, NewSeparators(','), ","),
 			tokens: []Token{
 				SeparatorToken{token: token{Pos: 0}, Value: ','},
 			},
 		},
 		{
 			name:      "separator",
-			tokenizer: New(nil, []rune{','}, "1,2,3"),
+			tokenizer: New(nil, NewSeparators(','), "1,2,3"),
 			tokens: []Token{
 				NumberToken{token: token{Pos: 0}, Value: 1},
 				SeparatorToken{token: token{Pos: 1}, Value: ','},
@@ -84,7 +94,7 @@ func TestLexer(t *testing.T) {
 		},
 		{
 			name:      "separators",
-			tokenizer: New(nil, []rune{',', ':'}, "1,2:: \",::\""),
+			tokenizer: New(nil, NewSeparators(',', ':'), "1,2:: \",::\""),
 			tokens: []Token{
 				NumberToken{token: token{Pos: 0}, Value: 1},
 				SeparatorToken{token: token{Pos: 1}, Value: ','},
@@ -109,6 +119,27 @@ func TestLexer(t *testing.T) {
 				SymbolToken{token: token{Pos: 4}, Value: "!="},
 			},
 		},
+		{
+			name:      "operator to symbol with operator suffix",
+			tokenizer: NewWithOperators([]string{"as"}, nil, "axs"),
+			tokens: []Token{
+				SymbolToken{token: token{Pos: 0}, Value: "axs"},
+			},
+		},
+		{
+			name:      "invalid number (overflow)",
+			tokenizer: New(nil, nil, "99999999999999999999 1"),
+			err:       ErrInvalidNumber,
+		},
+		{
+			name:      "multibyte symbols",
+			tokenizer: New(nil, NewSeparators(','), `группа,"Кино"`),
+			tokens: []Token{
+				SymbolToken{token: token{Pos: 0}, Value: "группа"},
+				SeparatorToken{token: token{Pos: 6}, Value: ','},
+				StringToken{token: token{Pos: 7}, Value: "Кино"},
+			},
+		},
 		{
 			name:      "operator overlap",
 			tokenizer: NewWithOperators([]string{"as", "assert"}, []rune{','}, "123 as 10 assert,as"),
@@ -134,3 +165,26 @@ func TestLexer(t *testing.T) {
 		})
 	}
 }
+
+var benchmarkFilters = []string{
+	`EQ(group, "Muse")`,
+	`AND(EQ(group, "Muse"), ALIKE(text, "%can you hear me%"), EQ(releaseDate, DATE("16.07.2006")))`,
+	`OR(IN(id, (1, 2, 3, 4, 5)), AND(GTE(releaseDate, DATE("01.01.2000")), LIKE(song, "%\"love\"%")))`,
+}
+
+func BenchmarkLexer(b *testing.B) {
+	operators := OperatorsTrie([]string{"EQ", "IN", "GT", "LT", "GTE", "LTE", "AND", "OR", "NOT", "LIKE", "ALIKE", "DATE"})
+	separators := NewSeparators('(', ')', ',')
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, f := range benchmarkFilters {
+			l := New(operators, separators, f)
+			for l.Next() {
+				_ = l.Token()
+			}
+			if l.Err() != nil {
+				b.Fatal(l.Err())
+			}
+		}
+	}
+}
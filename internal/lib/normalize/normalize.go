@@ -0,0 +1,25 @@
+package normalize
+
+import (
+	"slices"
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+var articles = []string{"the", "a", "an"}
+
+// Name returns a key for comparison of names that differ
+// in case, spacing, leading article or Unicode representation,
+// e.g. "The  Beatles", "beatles" and "ＢＥＡＴＬＥＳ" have the same key.
+func Name(name string) string {
+	s := norm.NFKC.String(name)
+	// Caser is stateful and should not be shared between goroutines
+	s = cases.Fold().String(s)
+	fields := strings.Fields(s)
+	if len(fields) > 1 && slices.Contains(articles, fields[0]) {
+		fields = fields[1:]
+	}
+	return strings.Join(fields, " ")
+}
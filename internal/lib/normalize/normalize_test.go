@@ -0,0 +1,34 @@
+package normalize_test
+
+import (
+	"testing"
+
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/normalize"
+)
+
+func TestName(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "case folding", input: "Beatles", want: "beatles"},
+		{name: "article stripping", input: "The Beatles", want: "beatles"},
+		{name: "indefinite article", input: "A Perfect Circle", want: "perfect circle"},
+		{name: "article only", input: "The", want: "the"},
+		{name: "article prefix", input: "Theatre of Tragedy", want: "theatre of tragedy"},
+		{name: "spacing", input: "  the \t Rolling   Stones ", want: "rolling stones"},
+		{name: "fullwidth", input: "ＢＥＡＴＬＥＳ", want: "beatles"},
+		{name: "decomposed characters", input: "Beyonce\u0301", want: "beyonc\u00e9"},
+		{name: "special case folding", input: "Die Ärzte STRASSE ß", want: "die ärzte strasse ss"},
+		{name: "cyrillic", input: "Кино", want: "кино"},
+		{name: "empty", input: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalize.Name(tt.input); got != tt.want {
+				t.Errorf("Name(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package songs
+
+import "time"
+
+type Album struct {
+	ID          int64
+	Title       string
+	Artist      string
+	ArtistID    int64
+	ReleaseDate time.Time
+	CoverLink   string
+}
+
+func NewAlbum(
+	title string,
+	artistID int64,
+	releaseDate time.Time,
+	coverLink string,
+) Album {
+	return Album{
+		ID:          -1,
+		Title:       title,
+		ArtistID:    artistID,
+		ReleaseDate: releaseDate,
+		CoverLink:   coverLink,
+	}
+}
+
+// Track is a position of the song on the album,
+// zero disc or track number means that it is not specified
+type Track struct {
+	AlbumID    int64
+	Album      string
+	DiscNumber int
+	Number     int
+}
+
+type AlbumField string
+
+const (
+	AlbumTitle       AlbumField = "title"
+	AlbumArtistID    AlbumField = "artistId"
+	AlbumReleaseDate AlbumField = "releaseDate"
+	AlbumCoverLink   AlbumField = "cover"
+)
+
+type AlbumUpdate map[AlbumField]any
@@ -0,0 +1,289 @@
+package songs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/httpx"
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/logger"
+)
+
+type AlbumsService interface {
+	CreateAlbum(ctx context.Context, title string, artistID int64, releaseDate time.Time, coverLink string) (Album, error)
+	GetAlbum(ctx context.Context, id int64) (Album, error)
+	GetAlbums(ctx context.Context, pagination Pagination) ([]Album, error)
+	GetTracks(ctx context.Context, id int64) ([]Song, error)
+	UpdateAlbum(ctx context.Context, id int64, upd AlbumUpdate) error
+	DeleteAlbum(ctx context.Context, id int64) error
+}
+
+type albumsController struct {
+	controller
+	albumsService AlbumsService
+}
+
+func newAlbumsController(
+	log *logger.Logger,
+	albumsService AlbumsService,
+) *albumsController {
+	return &albumsController{
+		controller:    newBaseController(log),
+		albumsService: albumsService,
+	}
+}
+
+type albumDTO struct {
+	ID          int64  `json:"id"`
+	Title       string `json:"title"`
+	Artist      string `json:"group"`
+	ArtistID    int64  `json:"artistId"`
+	ReleaseDate string `json:"releaseDate"`
+	CoverLink   string `json:"cover"`
+}
+
+type createAlbumDTO struct {
+	Title       string `json:"title"`
+	ArtistID    int64  `json:"artistId"`
+	ReleaseDate string `json:"releaseDate"`
+	CoverLink   string `json:"cover"`
+}
+
+type updateAlbumDTO struct {
+	Title       *string `json:"title"`
+	ArtistID    *int64  `json:"artistId"`
+	ReleaseDate *string `json:"releaseDate"`
+	CoverLink   *string `json:"cover"`
+}
+
+func toAlbumDTO(album Album) albumDTO {
+	return albumDTO{
+		ID:          album.ID,
+		Title:       album.Title,
+		Artist:      album.Artist,
+		ArtistID:    album.ArtistID,
+		ReleaseDate: album.ReleaseDate.Format(releaseDateFormat),
+		CoverLink:   album.CoverLink,
+	}
+}
+
+// CreateAlbum godoc
+// @Summary      Create album
+// @Tags         albums
+// @Accept       json
+// @Produce      json
+// @Param        payload body createAlbumDTO true "Album data"
+// @Success      201  {object}  albumDTO
+// @Failure      400  {string}  string
+// @Failure      500  {string}  string
+// @Router       /albums [post]
+func (c *albumsController) CreateAlbum(w http.ResponseWriter, r *http.Request) {
+	createAlbum, httpErr := httpx.JSONBody[createAlbumDTO](c.log.Logger, c.decoder, w, r)
+	if httpErr != nil {
+		http.Error(w, httpErr.Text, httpErr.Status)
+		return
+	}
+	title := strings.TrimSpace(createAlbum.Title)
+	if len(title) == 0 {
+		c.badRequest(w, r, fmt.Errorf("%w: %v", ErrInvalidField, AlbumTitle))
+		return
+	}
+	releaseDate, err := time.Parse(releaseDateFormat, createAlbum.ReleaseDate)
+	if err != nil {
+		c.badRequest(w, r, fmt.Errorf("%w: %v", ErrInvalidDate, err))
+		return
+	}
+	album, err := c.albumsService.CreateAlbum(r.Context(), title, createAlbum.ArtistID, releaseDate, createAlbum.CoverLink)
+	if errors.Is(err, ErrArtistNotFound) {
+		c.badRequest(w, r, err)
+		return
+	}
+	if err != nil {
+		c.serverError(w, r, err, "failed to create album")
+		return
+	}
+	c.json(w, r, toAlbumDTO(album), http.StatusCreated)
+}
+
+// GetAlbums godoc
+// @Summary      Get albums
+// @Tags         albums
+// @Produce      json
+// @Param        page     query  uint64  false  "Page number"
+// @Param        pageSize query  uint64  false  "Page size"
+// @Success      200  {array}   albumDTO
+// @Failure      400  {string}  string
+// @Failure      500  {string}  string
+// @Router       /albums [get]
+func (c *albumsController) GetAlbums(w http.ResponseWriter, r *http.Request) {
+	pagination := Pagination{
+		PageSize: c.maxPageSize,
+	}
+	if err := c.parsePagination(&pagination, r.URL.Query()); err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	albums, err := c.albumsService.GetAlbums(r.Context(), pagination)
+	if err != nil {
+		c.serverError(w, r, err, "failed to get albums")
+		return
+	}
+	dtos := make([]albumDTO, len(albums))
+	for i, album := range albums {
+		dtos[i] = toAlbumDTO(album)
+	}
+	c.json(w, r, dtos, http.StatusOK)
+}
+
+// GetAlbum godoc
+// @Summary      Get album
+// @Tags         albums
+// @Produce      json
+// @Param        albumId  path   int64   true   "Album id"
+// @Success      200  {object}  albumDTO
+// @Failure      400  {string}  string
+// @Failure      404  {string}  string
+// @Failure      500  {string}  string
+// @Router       /albums/{albumId} [get]
+func (c *albumsController) GetAlbum(w http.ResponseWriter, r *http.Request) {
+	albumId, err := c.parsePathId(r, "albumId")
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	album, err := c.albumsService.GetAlbum(r.Context(), albumId)
+	if errors.Is(err, ErrAlbumNotFound) {
+		c.notFound(w, r, err)
+		return
+	}
+	if err != nil {
+		c.serverError(w, r, err, "failed to get album")
+		return
+	}
+	c.json(w, r, toAlbumDTO(album), http.StatusOK)
+}
+
+// GetTracks godoc
+// @Summary      Get album tracklist
+// @Description  Songs are ordered by disc and track numbers.
+// @Tags         albums
+// @Produce      json
+// @Param        albumId  path   int64   true   "Album id"
+// @Success      200  {array}   songDTO
+// @Failure      400  {string}  string
+// @Failure      404  {string}  string
+// @Failure      500  {string}  string
+// @Router       /albums/{albumId}/tracks [get]
+func (c *albumsController) GetTracks(w http.ResponseWriter, r *http.Request) {
+	albumId, err := c.parsePathId(r, "albumId")
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	songs, err := c.albumsService.GetTracks(r.Context(), albumId)
+	if errors.Is(err, ErrAlbumNotFound) {
+		c.notFound(w, r, err)
+		return
+	}
+	if err != nil {
+		c.serverError(w, r, err, "failed to get tracks")
+		return
+	}
+	c.json(w, r, toDTOs(songs), http.StatusOK)
+}
+
+// UpdateAlbum godoc
+// @Summary      Update album
+// @Tags         albums
+// @Accept       json
+// @Param        albumId  path   int64          true "Album id"
+// @Param        payload  body   updateAlbumDTO true "Album data"
+// @Success      204  {string}  string
+// @Failure      400  {string}  string
+// @Failure      404  {string}  string
+// @Failure      500  {string}  string
+// @Router       /albums/{albumId} [patch]
+func (c *albumsController) UpdateAlbum(w http.ResponseWriter, r *http.Request) {
+	albumId, err := c.parsePathId(r, "albumId")
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	u, httpErr := httpx.JSONBody[updateAlbumDTO](c.log.Logger, c.decoder, w, r)
+	if httpErr != nil {
+		http.Error(w, httpErr.Text, httpErr.Status)
+		return
+	}
+	upd := make(AlbumUpdate, 4)
+	if u.Title != nil {
+		title := strings.TrimSpace(*u.Title)
+		if len(title) == 0 {
+			c.badRequest(w, r, fmt.Errorf("%w: %v", ErrInvalidField, AlbumTitle))
+			return
+		}
+		upd[AlbumTitle] = title
+	}
+	if u.ArtistID != nil {
+		upd[AlbumArtistID] = *u.ArtistID
+	}
+	if u.ReleaseDate != nil {
+		releaseDate, err := time.Parse(releaseDateFormat, *u.ReleaseDate)
+		if err != nil {
+			c.badRequest(w, r, fmt.Errorf("%w: %v", ErrInvalidDate, err))
+			return
+		}
+		upd[AlbumReleaseDate] = releaseDate
+	}
+	if u.CoverLink != nil {
+		upd[AlbumCoverLink] = *u.CoverLink
+	}
+	if len(upd) == 0 {
+		c.badRequest(w, r, ErrNothingToUpdate)
+		return
+	}
+	err = c.albumsService.UpdateAlbum(r.Context(), albumId, upd)
+	if errors.Is(err, ErrAlbumNotFound) {
+		c.notFound(w, r, err)
+		return
+	}
+	if errors.Is(err, ErrArtistNotFound) {
+		c.badRequest(w, r, err)
+		return
+	}
+	if err != nil {
+		c.serverError(w, r, err, "failed to update album")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteAlbum godoc
+// @Summary      Delete album
+// @Description  Songs of the album are kept without tracklist positions.
+// @Tags         albums
+// @Param        albumId  path   int64   true   "Album id"
+// @Success      204  {string}  string
+// @Failure      400  {string}  string
+// @Failure      404  {string}  string
+// @Failure      500  {string}  string
+// @Router       /albums/{albumId} [delete]
+func (c *albumsController) DeleteAlbum(w http.ResponseWriter, r *http.Request) {
+	albumId, err := c.parsePathId(r, "albumId")
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	err = c.albumsService.DeleteAlbum(r.Context(), albumId)
+	if errors.Is(err, ErrAlbumNotFound) {
+		c.notFound(w, r, err)
+		return
+	}
+	if err != nil {
+		c.serverError(w, r, err, "failed to delete album")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,196 @@
+package songs
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/logger"
+)
+
+var ErrAlbumNotFound = errors.New("album not found")
+
+type albumsRepo struct {
+	log  *logger.Logger
+	pool *pgxpool.Pool
+}
+
+func newAlbumsRepo(log *logger.Logger, pool *pgxpool.Pool) *albumsRepo {
+	return &albumsRepo{
+		log:  log,
+		pool: pool,
+	}
+}
+
+const saveAlbumQuery = `WITH a AS (INSERT INTO album (title, artist_id, release_date, cover_link) VALUES ($1, $2, $3, $4) RETURNING id, artist_id) SELECT a.id, artist.name FROM a JOIN artist ON artist.id = a.artist_id`
+
+func (s *albumsRepo) SaveAlbum(ctx context.Context, album *Album) error {
+	args := []any{album.Title, album.ArtistID, pgtype.Date{Time: album.ReleaseDate, Valid: true}, album.CoverLink}
+	s.log.Debug(ctx, "executing query", slog.String("query", saveAlbumQuery), slog.Any("args", args))
+	err := s.pool.QueryRow(ctx, saveAlbumQuery, args...).Scan(&album.ID, &album.Artist)
+	if pgErrorCode(err) == pgerrcode.ForeignKeyViolation {
+		return ErrArtistNotFound
+	}
+	return err
+}
+
+const albumColumns = `album.id, album.title, artist.name, album.artist_id, album.release_date, album.cover_link`
+
+const albumsTable = `album JOIN artist ON artist.id = album.artist_id`
+
+func scanAlbum(row pgx.Row) (Album, error) {
+	var a Album
+	var d pgtype.Date
+	if err := row.Scan(&a.ID, &a.Title, &a.Artist, &a.ArtistID, &d, &a.CoverLink); err != nil {
+		return Album{}, err
+	}
+	a.ReleaseDate = d.Time.In(time.Local)
+	return a, nil
+}
+
+const albumQuery = `SELECT ` + albumColumns + ` FROM ` + albumsTable + ` WHERE album.id = $1`
+
+func (s *albumsRepo) GetAlbum(ctx context.Context, id int64) (Album, error) {
+	s.log.Debug(ctx, "executing query", slog.String("query", albumQuery), slog.Int64("id", id))
+	album, err := scanAlbum(s.pool.QueryRow(ctx, albumQuery, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Album{}, ErrAlbumNotFound
+	}
+	return album, err
+}
+
+func (s *albumsRepo) GetAlbums(ctx context.Context, pagination Pagination) ([]Album, error) {
+	q := strings.Builder{}
+	q.WriteString(`SELECT ` + albumColumns + ` FROM ` + albumsTable + ` ORDER BY album.id ASC`)
+	var args []any
+	if pagination.Page > 0 {
+		q.WriteString(" OFFSET $")
+		args = append(args, (pagination.Page-1)*pagination.PageSize)
+		q.WriteString(strconv.Itoa(len(args)))
+	}
+	q.WriteString(" LIMIT $")
+	args = append(args, pagination.PageSize)
+	q.WriteString(strconv.Itoa(len(args)))
+	s.log.Debug(ctx, "executing query", slog.String("query", q.String()), slog.Any("args", args))
+	rows, err := s.pool.Query(ctx, q.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var albums []Album
+	for rows.Next() {
+		a, err := scanAlbum(rows)
+		if err != nil {
+			return nil, err
+		}
+		albums = append(albums, a)
+	}
+	s.log.Debug(ctx, "got albums", slog.Int("count", len(albums)))
+	return albums, rows.Err()
+}
+
+const tracksQuery = `SELECT ` + songColumns + ` FROM ` + songsTable + ` WHERE song.album_id = $1 AND song.deleted_at IS NULL ORDER BY song.disc_number ASC NULLS LAST, song.track_number ASC NULLS LAST, song.id ASC`
+
+func (s *albumsRepo) GetTracks(ctx context.Context, id int64) ([]Song, error) {
+	s.log.Debug(ctx, "executing query", slog.String("query", tracksQuery), slog.Int64("id", id))
+	rows, err := s.pool.Query(ctx, tracksQuery, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var songs []Song
+	for rows.Next() {
+		s, err := scanSong(rows)
+		if err != nil {
+			return nil, err
+		}
+		songs = append(songs, s)
+	}
+	s.log.Debug(ctx, "got tracks", slog.Int("count", len(songs)))
+	return songs, rows.Err()
+}
+
+var albumFieldToColumn = map[AlbumField]string{
+	AlbumTitle:       "title",
+	AlbumArtistID:    "artist_id",
+	AlbumReleaseDate: "release_date",
+	AlbumCoverLink:   "cover_link",
+}
+
+func (s *albumsRepo) UpdateAlbum(ctx context.Context, id int64, upd AlbumUpdate) error {
+	q := strings.Builder{}
+	q.Grow(100)
+	q.WriteString("UPDATE album SET ")
+	i := 0
+	var args []any
+	for f, v := range upd {
+		if i > 0 {
+			q.WriteString(", ")
+		}
+		i++
+		q.WriteString(albumFieldToColumn[f])
+		q.WriteString(" = $")
+		if f == AlbumReleaseDate {
+			args = append(args, pgtype.Date{Time: v.(time.Time), Valid: true})
+		} else {
+			args = append(args, v)
+		}
+		q.WriteString(strconv.Itoa(len(args)))
+	}
+	q.WriteString(" WHERE id = $")
+	args = append(args, id)
+	q.WriteString(strconv.Itoa(len(args)))
+	s.log.Debug(ctx, "executing query", slog.String("query", q.String()), slog.Any("args", args))
+	tag, err := s.pool.Exec(ctx, q.String(), args...)
+	if pgErrorCode(err) == pgerrcode.ForeignKeyViolation {
+		return ErrArtistNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAlbumNotFound
+	}
+	return nil
+}
+
+// Songs of the deleted album are kept, only their tracklist positions are cleared
+const lockAlbumTracksQuery = `SELECT id FROM song WHERE album_id = $1 ORDER BY id FOR UPDATE`
+
+const deleteAlbumQuery = `WITH t AS (UPDATE song SET album_id = NULL, disc_number = NULL, track_number = NULL WHERE album_id = $1) DELETE FROM album WHERE id = $1`
+
+// DeleteAlbum detaches the tracks (including trashed songs) from the album
+// and records their revisions
+func (s *albumsRepo) DeleteAlbum(ctx context.Context, id int64) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	ids, err := lockSongIds(ctx, s.log, tx, lockAlbumTracksQuery, id)
+	if err != nil {
+		return err
+	}
+	err = recordRevisions(ctx, s.log, tx, ids, func() error {
+		s.log.Debug(ctx, "executing query", slog.String("query", deleteAlbumQuery), slog.Int64("id", id))
+		tag, err := tx.Exec(ctx, deleteAlbumQuery, id)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrAlbumNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,62 @@
+package songs
+
+import (
+	"context"
+	"time"
+)
+
+type AlbumsRepo interface {
+	SaveAlbum(ctx context.Context, album *Album) error
+	GetAlbum(ctx context.Context, id int64) (Album, error)
+	GetAlbums(ctx context.Context, pagination Pagination) ([]Album, error)
+	GetTracks(ctx context.Context, id int64) ([]Song, error)
+	UpdateAlbum(ctx context.Context, id int64, upd AlbumUpdate) error
+	DeleteAlbum(ctx context.Context, id int64) error
+}
+
+type albumsService struct {
+	albumsRepo AlbumsRepo
+}
+
+func newAlbumsService(albumsRepo AlbumsRepo) *albumsService {
+	return &albumsService{
+		albumsRepo: albumsRepo,
+	}
+}
+
+func (s *albumsService) CreateAlbum(
+	ctx context.Context,
+	title string,
+	artistID int64,
+	releaseDate time.Time,
+	coverLink string,
+) (Album, error) {
+	album := NewAlbum(title, artistID, releaseDate, coverLink)
+	if err := s.albumsRepo.SaveAlbum(ctx, &album); err != nil {
+		return Album{}, err
+	}
+	return album, nil
+}
+
+func (s *albumsService) GetAlbum(ctx context.Context, id int64) (Album, error) {
+	return s.albumsRepo.GetAlbum(ctx, id)
+}
+
+func (s *albumsService) GetAlbums(ctx context.Context, pagination Pagination) ([]Album, error) {
+	return s.albumsRepo.GetAlbums(ctx, pagination)
+}
+
+func (s *albumsService) GetTracks(ctx context.Context, id int64) ([]Song, error) {
+	if _, err := s.albumsRepo.GetAlbum(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.albumsRepo.GetTracks(ctx, id)
+}
+
+func (s *albumsService) UpdateAlbum(ctx context.Context, id int64, upd AlbumUpdate) error {
+	return s.albumsRepo.UpdateAlbum(ctx, id, upd)
+}
+
+func (s *albumsService) DeleteAlbum(ctx context.Context, id int64) error {
+	return s.albumsRepo.DeleteAlbum(ctx, id)
+}
@@ -0,0 +1,45 @@
+package songs
+
+type Artist struct {
+	ID   int64
+	Name string
+}
+
+func NewArtist(name string) Artist {
+	return Artist{
+		ID:   -1,
+		Name: name,
+	}
+}
+
+// ArtistAlias is a name under which the artist can be found,
+// names with the same key are considered equal
+type ArtistAlias struct {
+	Key  string
+	Name string
+}
+
+type ArtistRole string
+
+const (
+	PrimaryRole  ArtistRole = "primary"
+	FeaturedRole ArtistRole = "featured"
+	ComposerRole ArtistRole = "composer"
+	LyricistRole ArtistRole = "lyricist"
+)
+
+func (r ArtistRole) Valid() bool {
+	switch r {
+	case PrimaryRole, FeaturedRole, ComposerRole, LyricistRole:
+		return true
+	default:
+		return false
+	}
+}
+
+// Credit is an additional artist of the song
+type Credit struct {
+	ArtistID int64
+	Artist   string
+	Role     ArtistRole
+}
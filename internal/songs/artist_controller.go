@@ -0,0 +1,416 @@
+package songs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/filter"
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/httpx"
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/logger"
+)
+
+type ArtistsService interface {
+	CreateArtist(ctx context.Context, name string) (Artist, error)
+	GetArtist(ctx context.Context, id int64) (Artist, error)
+	GetArtists(ctx context.Context, pagination Pagination) ([]Artist, error)
+	UpdateArtist(ctx context.Context, id int64, name string) error
+	DeleteArtist(ctx context.Context, id int64) error
+	GetArtistSongs(ctx context.Context, id int64, query Query) ([]Song, error)
+	GetAliases(ctx context.Context, id int64) ([]ArtistAlias, error)
+	CreateAlias(ctx context.Context, id int64, name string) (ArtistAlias, error)
+	MergeArtists(ctx context.Context, targetId int64, sourceId int64) error
+}
+
+type artistsController struct {
+	controller
+	artistsService ArtistsService
+}
+
+func newArtistsController(
+	log *logger.Logger,
+	artistsService ArtistsService,
+) *artistsController {
+	return &artistsController{
+		controller:     newBaseController(log),
+		artistsService: artistsService,
+	}
+}
+
+type artistDTO struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type createArtistDTO struct {
+	Name string `json:"name"`
+}
+
+type updateArtistDTO struct {
+	Name *string `json:"name"`
+}
+
+type aliasDTO struct {
+	Key  string `json:"key"`
+	Name string `json:"name"`
+}
+
+type createAliasDTO struct {
+	Name string `json:"name"`
+}
+
+type mergeArtistDTO struct {
+	ArtistID int64 `json:"artistId"`
+}
+
+func toArtistDTO(artist Artist) artistDTO {
+	return artistDTO{
+		ID:   artist.ID,
+		Name: artist.Name,
+	}
+}
+
+// CreateArtist godoc
+// @Summary      Create artist
+// @Tags         artists
+// @Accept       json
+// @Produce      json
+// @Param        payload body createArtistDTO true "Artist data"
+// @Success      201  {object}  artistDTO
+// @Failure      400  {string}  string
+// @Failure      409  {string}  string
+// @Failure      500  {string}  string
+// @Router       /artists [post]
+func (c *artistsController) CreateArtist(w http.ResponseWriter, r *http.Request) {
+	createArtist, httpErr := httpx.JSONBody[createArtistDTO](c.log.Logger, c.decoder, w, r)
+	if httpErr != nil {
+		http.Error(w, httpErr.Text, httpErr.Status)
+		return
+	}
+	name := strings.TrimSpace(createArtist.Name)
+	if len(name) == 0 {
+		c.badRequest(w, r, fmt.Errorf("%w: %v", ErrInvalidField, "name"))
+		return
+	}
+	artist, err := c.artistsService.CreateArtist(r.Context(), name)
+	if errors.Is(err, ErrArtistAlreadyExists) {
+		c.conflict(w, r, err)
+		return
+	}
+	if err != nil {
+		c.serverError(w, r, err, "failed to create artist")
+		return
+	}
+	c.json(w, r, toArtistDTO(artist), http.StatusCreated)
+}
+
+// GetArtists godoc
+// @Summary      Get artists
+// @Tags         artists
+// @Produce      json
+// @Param        page     query  uint64  false  "Page number"
+// @Param        pageSize query  uint64  false  "Page size"
+// @Success      200  {array}   artistDTO
+// @Failure      400  {string}  string
+// @Failure      500  {string}  string
+// @Router       /artists [get]
+func (c *artistsController) GetArtists(w http.ResponseWriter, r *http.Request) {
+	pagination := Pagination{
+		PageSize: c.maxPageSize,
+	}
+	if err := c.parsePagination(&pagination, r.URL.Query()); err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	artists, err := c.artistsService.GetArtists(r.Context(), pagination)
+	if err != nil {
+		c.serverError(w, r, err, "failed to get artists")
+		return
+	}
+	dtos := make([]artistDTO, len(artists))
+	for i, artist := range artists {
+		dtos[i] = toArtistDTO(artist)
+	}
+	c.json(w, r, dtos, http.StatusOK)
+}
+
+// GetArtist godoc
+// @Summary      Get artist
+// @Tags         artists
+// @Produce      json
+// @Param        artistId path   int64   true   "Artist id"
+// @Success      200  {object}  artistDTO
+// @Failure      400  {string}  string
+// @Failure      404  {string}  string
+// @Failure      500  {string}  string
+// @Router       /artists/{artistId} [get]
+func (c *artistsController) GetArtist(w http.ResponseWriter, r *http.Request) {
+	artistId, err := c.parsePathId(r, "artistId")
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	artist, err := c.artistsService.GetArtist(r.Context(), artistId)
+	if errors.Is(err, ErrArtistNotFound) {
+		c.notFound(w, r, err)
+		return
+	}
+	if err != nil {
+		c.serverError(w, r, err, "failed to get artist")
+		return
+	}
+	c.json(w, r, toArtistDTO(artist), http.StatusOK)
+}
+
+// UpdateArtist godoc
+// @Summary      Update artist
+// @Tags         artists
+// @Accept       json
+// @Param        artistId path   int64           true "Artist id"
+// @Param        payload  body   updateArtistDTO true "Artist data"
+// @Success      204  {string}  string
+// @Failure      400  {string}  string
+// @Failure      404  {string}  string
+// @Failure      409  {string}  string
+// @Failure      500  {string}  string
+// @Router       /artists/{artistId} [patch]
+func (c *artistsController) UpdateArtist(w http.ResponseWriter, r *http.Request) {
+	artistId, err := c.parsePathId(r, "artistId")
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	u, httpErr := httpx.JSONBody[updateArtistDTO](c.log.Logger, c.decoder, w, r)
+	if httpErr != nil {
+		http.Error(w, httpErr.Text, httpErr.Status)
+		return
+	}
+	if u.Name == nil {
+		c.badRequest(w, r, ErrNothingToUpdate)
+		return
+	}
+	name := strings.TrimSpace(*u.Name)
+	if len(name) == 0 {
+		c.badRequest(w, r, fmt.Errorf("%w: %v", ErrInvalidField, "name"))
+		return
+	}
+	err = c.artistsService.UpdateArtist(r.Context(), artistId, name)
+	if errors.Is(err, ErrArtistNotFound) {
+		c.notFound(w, r, err)
+		return
+	}
+	if errors.Is(err, ErrArtistAlreadyExists) {
+		c.conflict(w, r, err)
+		return
+	}
+	if err != nil {
+		c.serverError(w, r, err, "failed to update artist")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteArtist godoc
+// @Summary      Delete artist
+// @Tags         artists
+// @Param        artistId path   int64   true   "Artist id"
+// @Success      204  {string}  string
+// @Failure      400  {string}  string
+// @Failure      404  {string}  string
+// @Failure      409  {string}  string
+// @Failure      500  {string}  string
+// @Router       /artists/{artistId} [delete]
+func (c *artistsController) DeleteArtist(w http.ResponseWriter, r *http.Request) {
+	artistId, err := c.parsePathId(r, "artistId")
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	err = c.artistsService.DeleteArtist(r.Context(), artistId)
+	if errors.Is(err, ErrArtistNotFound) {
+		c.notFound(w, r, err)
+		return
+	}
+	if errors.Is(err, ErrArtistHasSongs) {
+		c.conflict(w, r, err)
+		return
+	}
+	if err != nil {
+		c.serverError(w, r, err, "failed to delete artist")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetArtistSongs godoc
+// @Summary      Get artist songs
+// @Tags         artists
+// @Produce      json
+// @Param        artistId path   int64   true   "Artist id"
+// @Param        page     query  uint64  false  "Page number"
+// @Param        pageSize query  uint64  false  "Page size"
+// @Param        lastId   query  int64   false  "Last song id"
+// @Param        filter   query  string  false  "Filter"
+// @Success      200  {array}   songDTO
+// @Failure      400  {string}  string
+// @Failure      404  {string}  string
+// @Failure      500  {string}  string
+// @Router       /artists/{artistId}/songs [get]
+func (c *artistsController) GetArtistSongs(w http.ResponseWriter, r *http.Request) {
+	artistId, err := c.parsePathId(r, "artistId")
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	sq, err := c.parseQuery(r)
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	songs, err := c.artistsService.GetArtistSongs(r.Context(), artistId, sq)
+	if errors.Is(err, ErrArtistNotFound) {
+		c.notFound(w, r, err)
+		return
+	}
+	if errors.Is(err, filter.ErrInvalidExpression) {
+		c.badRequest(w, r, err)
+		return
+	}
+	if err != nil {
+		c.serverError(w, r, err, "failed to get artist songs")
+		return
+	}
+	c.json(w, r, toDTOs(songs), http.StatusOK)
+}
+
+// GetAliases godoc
+// @Summary      Get artist aliases
+// @Tags         artists
+// @Produce      json
+// @Param        artistId path   int64   true   "Artist id"
+// @Success      200  {array}   aliasDTO
+// @Failure      400  {string}  string
+// @Failure      404  {string}  string
+// @Failure      500  {string}  string
+// @Router       /artists/{artistId}/aliases [get]
+func (c *artistsController) GetAliases(w http.ResponseWriter, r *http.Request) {
+	artistId, err := c.parsePathId(r, "artistId")
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	aliases, err := c.artistsService.GetAliases(r.Context(), artistId)
+	if errors.Is(err, ErrArtistNotFound) {
+		c.notFound(w, r, err)
+		return
+	}
+	if err != nil {
+		c.serverError(w, r, err, "failed to get aliases")
+		return
+	}
+	dtos := make([]aliasDTO, len(aliases))
+	for i, alias := range aliases {
+		dtos[i] = aliasDTO{
+			Key:  alias.Key,
+			Name: alias.Name,
+		}
+	}
+	c.json(w, r, dtos, http.StatusOK)
+}
+
+// CreateAlias godoc
+// @Summary      Create artist alias
+// @Description  Songs created with the alias as a group are assigned to the artist,
+// @Description  aliases are compared after normalization.
+// @Tags         artists
+// @Accept       json
+// @Produce      json
+// @Param        artistId path   int64           true   "Artist id"
+// @Param        payload  body   createAliasDTO  true   "Alias data"
+// @Success      201  {object}  aliasDTO
+// @Failure      400  {string}  string
+// @Failure      404  {string}  string
+// @Failure      409  {string}  string
+// @Failure      500  {string}  string
+// @Router       /artists/{artistId}/aliases [post]
+func (c *artistsController) CreateAlias(w http.ResponseWriter, r *http.Request) {
+	artistId, err := c.parsePathId(r, "artistId")
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	createAlias, httpErr := httpx.JSONBody[createAliasDTO](c.log.Logger, c.decoder, w, r)
+	if httpErr != nil {
+		http.Error(w, httpErr.Text, httpErr.Status)
+		return
+	}
+	name := strings.TrimSpace(createAlias.Name)
+	if len(name) == 0 {
+		c.badRequest(w, r, fmt.Errorf("%w: %v", ErrInvalidField, "name"))
+		return
+	}
+	alias, err := c.artistsService.CreateAlias(r.Context(), artistId, name)
+	if errors.Is(err, ErrArtistNotFound) {
+		c.notFound(w, r, err)
+		return
+	}
+	if errors.Is(err, ErrAliasIsTaken) {
+		c.conflict(w, r, err)
+		return
+	}
+	if err != nil {
+		c.serverError(w, r, err, "failed to create alias")
+		return
+	}
+	c.json(w, r, aliasDTO{
+		Key:  alias.Key,
+		Name: alias.Name,
+	}, http.StatusCreated)
+}
+
+// MergeArtists godoc
+// @Summary      Merge artists
+// @Description  Moves songs, albums and aliases of the given artist
+// @Description  to the artist from the path and deletes the given artist.
+// @Tags         artists
+// @Accept       json
+// @Param        artistId path   int64           true   "Artist id"
+// @Param        payload  body   mergeArtistDTO  true   "Artist to merge"
+// @Success      204  {string}  string
+// @Failure      400  {string}  string
+// @Failure      404  {string}  string
+// @Failure      409  {string}  string
+// @Failure      500  {string}  string
+// @Router       /artists/{artistId}/merge [post]
+func (c *artistsController) MergeArtists(w http.ResponseWriter, r *http.Request) {
+	artistId, err := c.parsePathId(r, "artistId")
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	merge, httpErr := httpx.JSONBody[mergeArtistDTO](c.log.Logger, c.decoder, w, r)
+	if httpErr != nil {
+		http.Error(w, httpErr.Text, httpErr.Status)
+		return
+	}
+	err = c.artistsService.MergeArtists(r.Context(), artistId, merge.ArtistID)
+	if errors.Is(err, ErrArtistNotFound) {
+		c.notFound(w, r, err)
+		return
+	}
+	if errors.Is(err, ErrCannotMergeArtistIntoItself) {
+		c.badRequest(w, r, err)
+		return
+	}
+	if errors.Is(err, ErrArtistsHaveDuplicateSongs) {
+		c.conflict(w, r, err)
+		return
+	}
+	if err != nil {
+		c.serverError(w, r, err, "failed to merge artists")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,225 @@
+package songs
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/logger"
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/normalize"
+)
+
+var ErrArtistNotFound = errors.New("artist not found")
+var ErrArtistAlreadyExists = errors.New("artist already exists")
+var ErrArtistHasSongs = errors.New("artist has songs")
+var ErrAliasIsTaken = errors.New("alias is taken")
+var ErrArtistsHaveDuplicateSongs = errors.New("artists have songs with the same title")
+
+type artistsRepo struct {
+	log  *logger.Logger
+	pool *pgxpool.Pool
+}
+
+func newArtistsRepo(log *logger.Logger, pool *pgxpool.Pool) *artistsRepo {
+	return &artistsRepo{
+		log:  log,
+		pool: pool,
+	}
+}
+
+const saveArtistQuery = `WITH a AS (INSERT INTO artist (name) VALUES ($1) RETURNING id) INSERT INTO artist_alias (key, name, artist_id) SELECT $2, $1, a.id FROM a RETURNING artist_id`
+
+func (s *artistsRepo) SaveArtist(ctx context.Context, artist *Artist) error {
+	args := []any{artist.Name, normalize.Name(artist.Name)}
+	s.log.Debug(ctx, "executing query", slog.String("query", saveArtistQuery), slog.Any("args", args))
+	err := s.pool.QueryRow(ctx, saveArtistQuery, args...).Scan(&artist.ID)
+	if pgErrorCode(err) == pgerrcode.UniqueViolation {
+		return ErrArtistAlreadyExists
+	}
+	return err
+}
+
+const artistQuery = `SELECT id, name FROM artist WHERE id = $1`
+
+func (s *artistsRepo) GetArtist(ctx context.Context, id int64) (Artist, error) {
+	s.log.Debug(ctx, "executing query", slog.String("query", artistQuery), slog.Int64("id", id))
+	var a Artist
+	err := s.pool.QueryRow(ctx, artistQuery, id).Scan(&a.ID, &a.Name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Artist{}, ErrArtistNotFound
+	}
+	return a, err
+}
+
+func (s *artistsRepo) GetArtists(ctx context.Context, pagination Pagination) ([]Artist, error) {
+	q := strings.Builder{}
+	q.WriteString(`SELECT id, name FROM artist ORDER BY id ASC`)
+	var args []any
+	if pagination.Page > 0 {
+		q.WriteString(" OFFSET $")
+		args = append(args, (pagination.Page-1)*pagination.PageSize)
+		q.WriteString(strconv.Itoa(len(args)))
+	}
+	q.WriteString(" LIMIT $")
+	args = append(args, pagination.PageSize)
+	q.WriteString(strconv.Itoa(len(args)))
+	s.log.Debug(ctx, "executing query", slog.String("query", q.String()), slog.Any("args", args))
+	rows, err := s.pool.Query(ctx, q.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var artists []Artist
+	for rows.Next() {
+		var a Artist
+		if err := rows.Scan(&a.ID, &a.Name); err != nil {
+			return nil, err
+		}
+		artists = append(artists, a)
+	}
+	s.log.Debug(ctx, "got artists", slog.Int("count", len(artists)))
+	return artists, rows.Err()
+}
+
+const aliasOwnerQuery = `SELECT artist_id FROM artist_alias WHERE key = $1`
+
+const updateArtistQuery = `UPDATE artist SET name = $1 WHERE id = $2`
+
+const insertAliasQuery = `INSERT INTO artist_alias (key, name, artist_id) VALUES ($1, $2, $3) ON CONFLICT (key) DO NOTHING`
+
+func (s *artistsRepo) UpdateArtist(ctx context.Context, id int64, name string) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	key := normalize.Name(name)
+	s.log.Debug(ctx, "executing query", slog.String("query", aliasOwnerQuery), slog.String("key", key))
+	var owner int64
+	err = tx.QueryRow(ctx, aliasOwnerQuery, key).Scan(&owner)
+	if err == nil && owner != id {
+		return ErrArtistAlreadyExists
+	}
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+	s.log.Debug(ctx, "executing query", slog.String("query", updateArtistQuery), slog.Int64("id", id), slog.String("name", name))
+	tag, err := tx.Exec(ctx, updateArtistQuery, name, id)
+	if pgErrorCode(err) == pgerrcode.UniqueViolation {
+		return ErrArtistAlreadyExists
+	}
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrArtistNotFound
+	}
+	args := []any{key, name, id}
+	s.log.Debug(ctx, "executing query", slog.String("query", insertAliasQuery), slog.Any("args", args))
+	if _, err := tx.Exec(ctx, insertAliasQuery, args...); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+const deleteArtistQuery = `DELETE FROM artist WHERE id = $1`
+
+func (s *artistsRepo) DeleteArtist(ctx context.Context, id int64) error {
+	s.log.Debug(ctx, "executing query", slog.String("query", deleteArtistQuery), slog.Int64("id", id))
+	tag, err := s.pool.Exec(ctx, deleteArtistQuery, id)
+	if pgErrorCode(err) == pgerrcode.ForeignKeyViolation {
+		return ErrArtistHasSongs
+	}
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrArtistNotFound
+	}
+	return nil
+}
+
+const aliasesQuery = `SELECT key, name FROM artist_alias WHERE artist_id = $1 ORDER BY key ASC`
+
+func (s *artistsRepo) GetAliases(ctx context.Context, id int64) ([]ArtistAlias, error) {
+	s.log.Debug(ctx, "executing query", slog.String("query", aliasesQuery), slog.Int64("id", id))
+	rows, err := s.pool.Query(ctx, aliasesQuery, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var aliases []ArtistAlias
+	for rows.Next() {
+		var a ArtistAlias
+		if err := rows.Scan(&a.Key, &a.Name); err != nil {
+			return nil, err
+		}
+		aliases = append(aliases, a)
+	}
+	s.log.Debug(ctx, "got aliases", slog.Int("count", len(aliases)))
+	return aliases, rows.Err()
+}
+
+const saveAliasQuery = `INSERT INTO artist_alias (key, name, artist_id) VALUES ($1, $2, $3)`
+
+func (s *artistsRepo) SaveAlias(ctx context.Context, id int64, alias *ArtistAlias) error {
+	alias.Key = normalize.Name(alias.Name)
+	args := []any{alias.Key, alias.Name, id}
+	s.log.Debug(ctx, "executing query", slog.String("query", saveAliasQuery), slog.Any("args", args))
+	_, err := s.pool.Exec(ctx, saveAliasQuery, args...)
+	switch pgErrorCode(err) {
+	case pgerrcode.ForeignKeyViolation:
+		return ErrArtistNotFound
+	case pgerrcode.UniqueViolation:
+		return ErrAliasIsTaken
+	}
+	return err
+}
+
+const lockArtistsQuery = `SELECT count(*) FROM (SELECT id FROM artist WHERE id IN ($1, $2) FOR UPDATE) AS a`
+
+const mergeArtistQuery = `SELECT merge_artist($1, $2)`
+
+const lockArtistSongsQuery = `SELECT id FROM song WHERE artist_id = $1 ORDER BY id FOR UPDATE`
+
+// MergeArtists moves songs, albums and aliases of the source artist
+// to the target artist, deletes the source artist
+// and records revisions of the moved songs
+func (s *artistsRepo) MergeArtists(ctx context.Context, targetId int64, sourceId int64) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	args := []any{targetId, sourceId}
+	s.log.Debug(ctx, "executing query", slog.String("query", lockArtistsQuery), slog.Any("args", args))
+	var count int
+	if err := tx.QueryRow(ctx, lockArtistsQuery, args...).Scan(&count); err != nil {
+		return err
+	}
+	if count != 2 {
+		return ErrArtistNotFound
+	}
+	ids, err := lockSongIds(ctx, s.log, tx, lockArtistSongsQuery, sourceId)
+	if err != nil {
+		return err
+	}
+	err = recordRevisions(ctx, s.log, tx, ids, func() error {
+		args := []any{sourceId, targetId}
+		s.log.Debug(ctx, "executing query", slog.String("query", mergeArtistQuery), slog.Any("args", args))
+		_, err := tx.Exec(ctx, mergeArtistQuery, args...)
+		if pgConstraint(err) == songArtistTitleIndex {
+			return ErrArtistsHaveDuplicateSongs
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,97 @@
+package songs
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"net/url"
+	"strconv"
+)
+
+var ErrCannotMergeArtistIntoItself = errors.New("cannot merge artist into itself")
+
+type ArtistsRepo interface {
+	SaveArtist(ctx context.Context, artist *Artist) error
+	GetArtist(ctx context.Context, id int64) (Artist, error)
+	GetArtists(ctx context.Context, pagination Pagination) ([]Artist, error)
+	UpdateArtist(ctx context.Context, id int64, name string) error
+	DeleteArtist(ctx context.Context, id int64) error
+	GetAliases(ctx context.Context, id int64) ([]ArtistAlias, error)
+	SaveAlias(ctx context.Context, id int64, alias *ArtistAlias) error
+	MergeArtists(ctx context.Context, targetId int64, sourceId int64) error
+}
+
+type artistsService struct {
+	artistsRepo ArtistsRepo
+	songsRepo   SongsRepo
+}
+
+func newArtistsService(
+	artistsRepo ArtistsRepo,
+	songsRepo SongsRepo,
+) *artistsService {
+	return &artistsService{
+		artistsRepo: artistsRepo,
+		songsRepo:   songsRepo,
+	}
+}
+
+func (s *artistsService) CreateArtist(ctx context.Context, name string) (Artist, error) {
+	artist := NewArtist(name)
+	if err := s.artistsRepo.SaveArtist(ctx, &artist); err != nil {
+		return Artist{}, err
+	}
+	return artist, nil
+}
+
+func (s *artistsService) GetArtist(ctx context.Context, id int64) (Artist, error) {
+	return s.artistsRepo.GetArtist(ctx, id)
+}
+
+func (s *artistsService) GetArtists(ctx context.Context, pagination Pagination) ([]Artist, error) {
+	return s.artistsRepo.GetArtists(ctx, pagination)
+}
+
+func (s *artistsService) UpdateArtist(ctx context.Context, id int64, name string) error {
+	return s.artistsRepo.UpdateArtist(ctx, id, name)
+}
+
+func (s *artistsService) DeleteArtist(ctx context.Context, id int64) error {
+	return s.artistsRepo.DeleteArtist(ctx, id)
+}
+
+func (s *artistsService) GetArtistSongs(ctx context.Context, id int64, query Query) ([]Song, error) {
+	if _, err := s.artistsRepo.GetArtist(ctx, id); err != nil {
+		return nil, err
+	}
+	query.FilterParams = maps.Clone(query.FilterParams)
+	if query.FilterParams == nil {
+		query.FilterParams = url.Values{}
+	}
+	query.FilterParams.Set("artistId", strconv.FormatInt(id, 10))
+	return s.songsRepo.GetSongs(ctx, query)
+}
+
+func (s *artistsService) GetAliases(ctx context.Context, id int64) ([]ArtistAlias, error) {
+	if _, err := s.artistsRepo.GetArtist(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.artistsRepo.GetAliases(ctx, id)
+}
+
+func (s *artistsService) CreateAlias(ctx context.Context, id int64, name string) (ArtistAlias, error) {
+	alias := ArtistAlias{
+		Name: name,
+	}
+	if err := s.artistsRepo.SaveAlias(ctx, id, &alias); err != nil {
+		return ArtistAlias{}, err
+	}
+	return alias, nil
+}
+
+func (s *artistsService) MergeArtists(ctx context.Context, targetId int64, sourceId int64) error {
+	if targetId == sourceId {
+		return ErrCannotMergeArtistIntoItself
+	}
+	return s.artistsRepo.MergeArtists(ctx, targetId, sourceId)
+}
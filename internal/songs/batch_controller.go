@@ -0,0 +1,138 @@
+package songs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/logger/sl"
+)
+
+type batchResultDTO struct {
+	// Line number of the request starting from 1
+	Line  int    `json:"line"`
+	ID    *int64 `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// CreateSongs godoc
+// @Summary      Create songs
+// @Description  Accepts NDJSON lines like `{"group": "Muse", "song": "Uprising"}`
+// @Description  and streams back NDJSON results `{"line": 1, "id": 42}`
+// @Description  or `{"line": 2, "error": "..."}` in the order of completion.
+// @Tags         songs
+// @Accept       application/x-ndjson
+// @Produce      application/x-ndjson
+// @Param        X-Author header string         false  "Author of the change"
+// @Param        payload  body   createSongDTO  true   "Song data, one per line"
+// @Success      200  {object}  batchResultDTO
+// @Failure      400  {string}  string
+// @Router       /songs:batch [post]
+func (c *songsController) CreateSongs(w http.ResponseWriter, r *http.Request) {
+	author, err := c.parseAuthor(r)
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	rc := http.NewResponseController(w)
+	// Results are streamed while the request body is being read
+	if err := rc.EnableFullDuplex(); err != nil {
+		c.log.Debug(r.Context(), "full duplex is not enabled", sl.Err(err))
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	requests := make(chan SongRequest)
+	invalid := make(chan batchResultDTO)
+	go c.readSongRequests(ctx, r.Body, requests, invalid)
+	results := c.songsService.CreateSongs(ctx, requests, author)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	failed := false
+	for results != nil || invalid != nil {
+		var dto batchResultDTO
+		select {
+		case res, ok := <-results:
+			if !ok {
+				results = nil
+				continue
+			}
+			dto = batchResultDTO{Line: res.Line}
+			if res.Err != nil {
+				dto.Error = res.Err.Error()
+			} else {
+				dto.ID = &res.Song.ID
+			}
+		case res, ok := <-invalid:
+			if !ok {
+				invalid = nil
+				continue
+			}
+			dto = res
+		}
+		// Channels are drained after a failure to let the goroutines finish
+		if failed {
+			continue
+		}
+		if err := enc.Encode(dto); err != nil {
+			c.log.Debug(r.Context(), "failed to write result", sl.Err(err))
+			failed = true
+			cancel()
+			continue
+		}
+		if err := rc.Flush(); err != nil {
+			c.log.Debug(r.Context(), "failed to flush result", sl.Err(err))
+		}
+	}
+}
+
+// readSongRequests reads NDJSON lines of the body, invalid lines
+// are reported without being sent to the service
+func (c *songsController) readSongRequests(
+	ctx context.Context,
+	body io.Reader,
+	requests chan<- SongRequest,
+	invalid chan<- batchResultDTO,
+) {
+	defer close(requests)
+	defer close(invalid)
+	send := func(res batchResultDTO) bool {
+		select {
+		case invalid <- res:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(nil, int(c.decoder.MaxBytes))
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var dto createSongDTO
+		err := json.Unmarshal(scanner.Bytes(), &dto)
+		if err == nil {
+			err = dto.validate()
+		}
+		if err != nil {
+			if !send(batchResultDTO{Line: line, Error: err.Error()}) {
+				return
+			}
+			continue
+		}
+		select {
+		case requests <- SongRequest{Line: line, Title: dto.Song, Artist: dto.Group}:
+		case <-ctx.Done():
+			return
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		send(batchResultDTO{Line: line + 1, Error: err.Error()})
+	}
+}
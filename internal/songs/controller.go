@@ -5,11 +5,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"net/http"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
-	"time"
+	"unicode/utf8"
 
 	"github.com/x0k/effective-mobile-song-library-service/internal/lib/httpx"
 	"github.com/x0k/effective-mobile-song-library-service/internal/lib/logger"
@@ -17,122 +20,121 @@ import (
 )
 
 var ErrLastIdCannotBeUsedWithPageParameter = errors.New("last id cannot be used with page parameter")
+
 var ErrFilterIsTooLong = errors.New("filter is too complex")
+
 var ErrInvalidDate = errors.New("invalid date")
+
 var ErrNothingToUpdate = errors.New("nothing to update")
+
 var ErrInvalidField = errors.New("invalid song field")
 
+var ErrInvalidETag = errors.New("invalid entity tag")
+
+var ErrAuthorIsTooLong = errors.New("author is too long")
+
 type SongsService interface {
-	CreateSong(ctx context.Context, song string, group string) (Song, error)
+	CreateSong(ctx context.Context, song string, group string, author string) (Song, error)
+	CreateSongs(ctx context.Context, requests <-chan SongRequest, author string) <-chan SongResult
+	ImportSongs(ctx context.Context, r io.Reader, opts ImportOptions, author string) (ImportResult, error)
+	GetSong(ctx context.Context, id int64) (Song, error)
 	GetSongs(ctx context.Context, query Query) ([]Song, error)
+	GetSongsPage(ctx context.Context, query Query) (SongsPage, error)
+	SearchLyrics(ctx context.Context, text string, query Query) (LyricsMatchesPage, error)
+	ExportSongs(ctx context.Context, query Query, yield func(Song) error) error
 	GetLyrics(ctx context.Context, id int64, pagination Pagination) ([]string, error)
-	DeleteSong(ctx context.Context, id int64) error
-	UpdateSong(ctx context.Context, id int64, songUpdate SongUpdate) error
+	DeleteSong(ctx context.Context, id int64, version int64, author string) error
+	RestoreSong(ctx context.Context, id int64, author string) error
+	PurgeTrash(ctx context.Context) (int64, error)
+	UpdateSong(ctx context.Context, id int64, version int64, songUpdate SongUpdate, author string) (int64, error)
+	GetRevisions(ctx context.Context, songId int64) ([]SongRevision, error)
+	GetRevision(ctx context.Context, songId int64, revision int64) (SongRevision, error)
+	RevertSong(ctx context.Context, id int64, revision int64, version int64, author string) (int64, error)
+	MergeSongs(ctx context.Context, targetId int64, version int64, sourceId int64, author string) (int64, error)
+	EditLyrics(ctx context.Context, id int64, version int64, edit VerseEdit, author string) (int64, error)
+	GetTimedLyrics(ctx context.Context, id int64) (TimedLyrics, int64, error)
+	SetTimedLyrics(ctx context.Context, id int64, version int64, lyrics TimedLyrics, author string) (int64, error)
+	SetSongArtists(ctx context.Context, id int64, credits []Credit) error
 }
 
-type songsController struct {
-	log          *logger.Logger
-	decoder      *httpx.JsonBodyDecoder
-	songsService SongsService
-	maxPageSize  uint64
+// controller contains request parsing and response helpers
+// shared by the module controllers
+type controller struct {
+	log         *logger.Logger
+	decoder     *httpx.JsonBodyDecoder
+	maxPageSize uint64
+	// Limits of the decoded filter expression, of each filter parameter
+	// and of all filter parameters together
+	maxFilterLength       int
+	maxFilterParamsLength int
 }
 
-func newController(
-	log *logger.Logger,
-	songsRepo SongsService,
-) *songsController {
-	return &songsController{
+func newBaseController(log *logger.Logger) controller {
+	return controller{
 		log: log,
 		decoder: &httpx.JsonBodyDecoder{
 			MaxBytes: 1 * 1024 * 1024,
 		},
-		songsService: songsRepo,
-		maxPageSize:  100,
+		maxPageSize:           100,
+		maxFilterLength:       500,
+		maxFilterParamsLength: 1000,
 	}
 }
 
-type createSongDTO struct {
-	Group string `json:"group"`
-	Song  string `json:"song"`
-}
-
-type songDTO struct {
-	ID          int64    `json:"id"`
-	Title       string   `json:"song"`
-	Artist      string   `json:"group"`
-	ReleaseDate string   `json:"releaseDate"`
-	Lyrics      []string `json:"text"`
-	Link        string   `json:"link"`
-}
-
-type updateSongDTO struct {
-	Title       *string   `json:"song"`
-	Artist      *string   `json:"group"`
-	ReleaseDate *string   `json:"releaseDate"`
-	Lyrics      *[]string `json:"text"`
-	Link        *string   `json:"link"`
+type songsController struct {
+	controller
+	songsService SongsService
 }
 
-func toDTO(song Song) songDTO {
-	return songDTO{
-		ID:          song.ID,
-		Title:       song.Title,
-		Artist:      song.Artist,
-		ReleaseDate: song.ReleaseDate.Format(releaseDateFormat),
-		Lyrics:      song.Lyrics,
-		Link:        song.Link,
+func newController(
+	log *logger.Logger,
+	songsRepo SongsService,
+) *songsController {
+	return &songsController{
+		controller:   newBaseController(log),
+		songsService: songsRepo,
 	}
 }
 
-// CreateSong godoc
-// @Summary      Create song
-// @Tags         songs
-// @Accept       json
-// @Produce      json
-// @Param        payload body createSongDTO true "Song data"
-// @Success      201  {object}  songDTO
-// @Failure      400  {string}  string
-// @Failure      500  {string}  string
-// @Router       /songs [post]
-func (c *songsController) CreateSong(w http.ResponseWriter, r *http.Request) {
-	createSong, httpErr := httpx.JSONBody[createSongDTO](c.log.Logger, c.decoder, w, r)
-	if httpErr != nil {
-		http.Error(w, httpErr.Text, httpErr.Status)
-		return
+// pageLinks returns `first`, `prev`, `next` and `last` (if songs are counted) links
+// for page based pagination and `first`, `next` links for pagination by the last song id
+func pageLinks(u *url.URL, sq Query, page SongsPage) []string {
+	link := func(rel string, param string, value string) string {
+		q := u.Query()
+		q.Del("page")
+		q.Del("lastId")
+		if param != "" {
+			q.Set(param, value)
+		}
+		return fmt.Sprintf(`<%s?%s>; rel="%s"`, u.Path, q.Encode(), rel)
+	}
+	var links []string
+	if sq.Page == 0 {
+		links = append(links, link("first", "", ""))
+		if page.HasMore {
+			lastId := page.Songs[len(page.Songs)-1].ID
+			links = append(links, link("next", "lastId", strconv.FormatInt(lastId, 10)))
+		}
+		return links
 	}
-	if len(strings.TrimSpace(createSong.Group)) == 0 {
-		c.badRequest(w, r, fmt.Errorf("%w: %v", ErrInvalidField, "group"))
-		return
+	links = append(links, link("first", "page", "1"))
+	if sq.Page > 1 {
+		links = append(links, link("prev", "page", strconv.FormatUint(sq.Page-1, 10)))
 	}
-	if len(strings.TrimSpace(createSong.Song)) == 0 {
-		c.badRequest(w, r, fmt.Errorf("%w: %v", ErrInvalidField, "song"))
-		return
+	if page.HasMore {
+		links = append(links, link("next", "page", strconv.FormatUint(sq.Page+1, 10)))
 	}
-	song, err := c.songsService.CreateSong(r.Context(), createSong.Song, createSong.Group)
-	if err != nil {
-		c.serverError(w, r, err, "failed to create song")
-		return
+	if page.Total != nil && *page.Total > 0 {
+		last := (uint64(*page.Total) + sq.PageSize - 1) / sq.PageSize
+		links = append(links, link("last", "page", strconv.FormatUint(last, 10)))
 	}
-	c.json(w, r, toDTO(song), http.StatusCreated)
+	return links
 }
 
-// GetSongs godoc
-// @Summary      Get songs
-// @Tags         songs
-// @Produce      json
-// @Param        page     query  uint64  false  "Page number"
-// @Param        pageSize query  uint64  false  "Page size"
-// @Param        lastId   query  int64   false  "Last song id"
-// @Param        filter   query  string  false  "Filter"
-// @Success      200  {array}  songDTO
-// @Failure      400  {string}  string
-// @Failure      500  {string}  string
-// @Router       /songs [get]
-func (c *songsController) GetSongs(w http.ResponseWriter, r *http.Request) {
+func (c *controller) parseQuery(r *http.Request) (Query, error) {
 	rq, err := url.ParseQuery(r.URL.RawQuery)
 	if err != nil {
-		c.badRequest(w, r, err)
-		return
+		return Query{}, err
 	}
 	sq := Query{
 		Pagination: Pagination{
@@ -140,153 +142,178 @@ func (c *songsController) GetSongs(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 	if err = c.parsePagination(&sq.Pagination, rq); err != nil {
-		c.badRequest(w, r, err)
-		return
+		return Query{}, err
 	}
 	if lastId, err := c.parseUint(rq, "lastId", 63); err != nil {
-		c.badRequest(w, r, err)
-		return
+		return Query{}, err
 	} else if lastId > 0 && sq.Page > 0 {
-		c.badRequest(w, r, ErrLastIdCannotBeUsedWithPageParameter)
-		return
+		return Query{}, ErrLastIdCannotBeUsedWithPageParameter
 	} else {
 		sq.LastId = int64(lastId)
 	}
-	if sq.Filter = rq.Get("filter"); len(sq.Filter) > 500 {
-		c.badRequest(w, r, ErrFilterIsTooLong)
-		return
-	}
-	songs, err := c.songsService.GetSongs(r.Context(), sq)
-	if err != nil {
-		c.serverError(w, r, err, "failed to get songs")
-		return
+	if sq.Filter = rq.Get("filter"); len(sq.Filter) > c.maxFilterLength {
+		return Query{}, ErrFilterIsTooLong
+	}
+	sq.FilterParams = filterParams(rq)
+	length := 0
+	for name, values := range sq.FilterParams {
+		for _, v := range values {
+			if len(name) > c.maxFilterLength || len(v) > c.maxFilterLength {
+				return Query{}, ErrFilterIsTooLong
+			}
+			length += len(name) + len(v)
+		}
 	}
-	dtos := make([]songDTO, len(songs))
-	for i, song := range songs {
-		dtos[i] = toDTO(song)
+	if length > c.maxFilterParamsLength {
+		return Query{}, ErrFilterIsTooLong
 	}
-	c.json(w, r, dtos, http.StatusOK)
+	return sq, nil
 }
 
-// GetLyrics godoc
-// @Summary      Get lyrics
-// @Tags         songs
-// @Produce      json
-// @Param        songId   path   int64   true   "Song id"
-// @Param        page     query  uint64  false  "Page number"
-// @Param        pageSize query  uint64  false  "Page size"
-// @Success      200  {array}   string
-// @Failure      400  {string}  string
-// @Failure      500  {string}  string
-// @Router       /songs/{songId}/lyrics [get]
-func (c *songsController) GetLyrics(w http.ResponseWriter, r *http.Request) {
-	songId, err := c.parseSongId(r)
-	if err != nil {
-		c.badRequest(w, r, err)
-		return
-	}
-	Pagination := Pagination{
-		PageSize: c.maxPageSize,
-	}
-	if err := c.parsePagination(&Pagination, r.URL.Query()); err != nil {
-		c.badRequest(w, r, err)
-		return
-	}
-	lyrics, err := c.songsService.GetLyrics(r.Context(), songId, Pagination)
-	if err != nil {
-		c.serverError(w, r, err, "failed to get lyrics")
-		return
+var reservedQueryParams = []string{"page", "pageSize", "lastId", "filter", "envelope", "total", "fields", "format", "q"}
+
+// parseFields collects comma separated field names,
+// the parameter may be repeated
+func parseFields(q url.Values) []string {
+	var fields []string
+	for _, v := range q["fields"] {
+		for _, f := range strings.Split(v, ",") {
+			if f = strings.TrimSpace(f); f != "" && !slices.Contains(fields, f) {
+				fields = append(fields, f)
+			}
+		}
 	}
-	c.json(w, r, lyrics, http.StatusOK)
+	return fields
 }
 
-// DeleteSong godoc
-// @Summary      Delete song
-// @Tags         songs
-// @Param        songId   path   int64   true   "Song id"
-// @Success      204  {string}  string
-// @Failure      400  {string}  string
-// @Failure      500  {string}  string
-// @Router       /songs/{songId} [delete]
-func (c *songsController) DeleteSong(w http.ResponseWriter, r *http.Request) {
-	songId, err := c.parseSongId(r)
-	if err != nil {
-		c.badRequest(w, r, err)
-		return
+func filterParams(rq url.Values) url.Values {
+	params := maps.Clone(rq)
+	for _, p := range reservedQueryParams {
+		delete(params, p)
 	}
-	if err := c.songsService.DeleteSong(r.Context(), songId); err != nil {
-		c.serverError(w, r, err, "failed to delete song")
-		return
+	return params
+}
+
+func (c *songsController) parseSongId(r *http.Request) (int64, error) {
+	return c.parsePathId(r, "songId")
+}
+
+// versionCondition is the `If-Match` precondition on the song version
+type versionCondition struct {
+	// Any version matches, the header is missing or `*`
+	any bool
+	// Versions from the strong entity tags, weak tags never match
+	versions []int64
+}
+
+func (vc versionCondition) matches(version int64) bool {
+	return vc.any || slices.Contains(vc.versions, version)
+}
+
+// parseIfMatch parses the list of entity tags from the `If-Match` header
+func (c *songsController) parseIfMatch(r *http.Request) (versionCondition, error) {
+	header := strings.TrimSpace(strings.Join(r.Header.Values("If-Match"), ","))
+	if header == "" || header == "*" {
+		return versionCondition{any: true}, nil
+	}
+	var vc versionCondition
+	for rest := header; rest != ""; {
+		weak := strings.HasPrefix(rest, "W/")
+		if weak {
+			rest = rest[2:]
+		}
+		if len(rest) < 2 || rest[0] != '"' {
+			return versionCondition{}, fmt.Errorf("%w: %s", ErrInvalidETag, header)
+		}
+		end := strings.IndexByte(rest[1:], '"') + 1
+		if end == 0 {
+			return versionCondition{}, fmt.Errorf("%w: %s", ErrInvalidETag, header)
+		}
+		// Unknown strong tags are kept out, they can't match as well
+		if version, err := strconv.ParseInt(rest[1:end], 10, 64); err == nil && version > 0 && !weak {
+			vc.versions = append(vc.versions, version)
+		}
+		rest = strings.TrimLeft(rest[end+1:], " \t")
+		if rest == "" {
+			break
+		}
+		if rest[0] != ',' {
+			return versionCondition{}, fmt.Errorf("%w: %s", ErrInvalidETag, header)
+		}
+		rest = strings.TrimLeft(rest[1:], " \t")
 	}
-	w.WriteHeader(http.StatusNoContent)
+	return vc, nil
 }
 
-// UpdateSong godoc
-// @Summary      Update song
-// @Tags         songs
-// @Accept       json
-// @Param        songId  path   int64         true "Song id"
-// @Param        payload body   updateSongDTO true "Song data"
-// @Success      204  {string}  string
-// @Failure      400  {string}  string
-// @Failure      500  {string}  string
-// @Router       /songs/{songId} [patch]
-func (c *songsController) UpdateSong(w http.ResponseWriter, r *http.Request) {
-	songId, err := c.parseSongId(r)
+// ifMatchVersion returns the song version for the conditional update,
+// zero means that any version matches. The current version is read only
+// if the header lists several versions.
+func (c *songsController) ifMatchVersion(r *http.Request, songId int64) (int64, error) {
+	vc, err := c.parseIfMatch(r)
 	if err != nil {
-		c.badRequest(w, r, err)
-		return
-	}
-	u, httpErr := httpx.JSONBody[updateSongDTO](c.log.Logger, c.decoder, w, r)
-	if httpErr != nil {
-		http.Error(w, httpErr.Text, httpErr.Status)
-		return
-	}
-	upd := make(SongUpdate, 5)
-	if u.Title != nil {
-		upd[Title] = *u.Title
+		return 0, err
 	}
-	if u.Artist != nil {
-		upd[Artist] = *u.Artist
-	}
-	if u.ReleaseDate != nil {
-		time, err := time.Parse(releaseDateFormat, *u.ReleaseDate)
-		if err != nil {
-			c.badRequest(w, r, fmt.Errorf("%w: %v", ErrInvalidDate, err))
-			return
-		}
-		upd[ReleaseDate] = time
-	}
-	if u.Lyrics != nil {
-		upd[Lyrics] = *u.Lyrics
+	switch {
+	case vc.any:
+		return 0, nil
+	case len(vc.versions) == 0:
+		return 0, ErrSongVersionMismatch
+	case len(vc.versions) == 1:
+		return vc.versions[0], nil
 	}
-	if u.Link != nil {
-		upd[Link] = *u.Link
+	song, err := c.songsService.GetSong(r.Context(), songId)
+	if err != nil {
+		return 0, err
 	}
-	if len(upd) == 0 {
-		c.badRequest(w, r, ErrNothingToUpdate)
-		return
+	if !vc.matches(song.Version) {
+		return 0, ErrSongVersionMismatch
 	}
-	if err := c.songsService.UpdateSong(r.Context(), songId, upd); err != nil {
-		c.serverError(w, r, err, "failed to update song")
-		return
+	return song.Version, nil
+}
+
+// ifMatchFailed responds to errors of ifMatchVersion
+func (c *songsController) ifMatchFailed(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidETag):
+		c.badRequest(w, r, err)
+	case errors.Is(err, ErrSongVersionMismatch):
+		c.preconditionFailed(w, r, err)
+	case errors.Is(err, ErrSongNotFound):
+		c.notFound(w, r, err)
+	default:
+		c.serverError(w, r, err, "failed to check song version")
 	}
-	w.WriteHeader(http.StatusNoContent)
 }
 
-func (c *songsController) parseSongId(r *http.Request) (int64, error) {
-	songIdStr := r.PathValue("songId")
-	if songIdStr == "" {
-		return 0, fmt.Errorf("%w: %v", ErrInvalidField, "songId is empty")
+const maxAuthorLength = 255
+
+// parseAuthor returns the author of the change from the `X-Author` header,
+// the author is empty if the header is missing
+func (c *songsController) parseAuthor(r *http.Request) (string, error) {
+	author := strings.TrimSpace(r.Header.Get("X-Author"))
+	if utf8.RuneCountInString(author) > maxAuthorLength {
+		return "", ErrAuthorIsTooLong
+	}
+	return author, nil
+}
+
+func songETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+func (c *controller) parsePathId(r *http.Request, name string) (int64, error) {
+	idStr := r.PathValue(name)
+	if idStr == "" {
+		return 0, fmt.Errorf("%w: %s is empty", ErrInvalidField, name)
 	}
-	songId, err := strconv.ParseInt(songIdStr, 10, 64)
+	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
-		return 0, fmt.Errorf("%w: songId %v", ErrInvalidField, err)
+		return 0, fmt.Errorf("%w: %s %v", ErrInvalidField, name, err)
 	}
-	return songId, nil
+	return id, nil
 }
 
-func (c *songsController) parsePagination(p *Pagination, rq url.Values) error {
+func (c *controller) parsePagination(p *Pagination, rq url.Values) error {
 	var err error
 	if p.Page, err = c.parseUint(rq, "page", 64); err != nil {
 		return err
@@ -299,7 +326,7 @@ func (c *songsController) parsePagination(p *Pagination, rq url.Values) error {
 	return nil
 }
 
-func (c *songsController) json(w http.ResponseWriter, r *http.Request, data any, status int) {
+func (c *controller) json(w http.ResponseWriter, r *http.Request, data any, status int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	if err := json.NewEncoder(w).Encode(data); err != nil {
@@ -307,17 +334,64 @@ func (c *songsController) json(w http.ResponseWriter, r *http.Request, data any,
 	}
 }
 
-func (c *songsController) serverError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+func (c *controller) serverError(w http.ResponseWriter, r *http.Request, err error, msg string) {
 	http.Error(w, err.Error(), http.StatusInternalServerError)
 	c.log.Debug(r.Context(), msg, sl.Err(err))
 }
 
-func (c *songsController) badRequest(w http.ResponseWriter, r *http.Request, err error) {
+func (c *controller) badRequest(w http.ResponseWriter, r *http.Request, err error) {
 	http.Error(w, err.Error(), http.StatusBadRequest)
 	c.log.Debug(r.Context(), "bad request", sl.Err(err))
 }
 
-func (c *songsController) parseUint(q url.Values, name string, bitSize int) (uint64, error) {
+func (c *controller) notFound(w http.ResponseWriter, r *http.Request, err error) {
+	http.Error(w, err.Error(), http.StatusNotFound)
+	c.log.Debug(r.Context(), "not found", sl.Err(err))
+}
+
+func (c *controller) conflict(w http.ResponseWriter, r *http.Request, err error) {
+	http.Error(w, err.Error(), http.StatusConflict)
+	c.log.Debug(r.Context(), "conflict", sl.Err(err))
+}
+
+// duplicateSong responds with the id of the existing song if it is known
+func (c *songsController) duplicateSong(w http.ResponseWriter, r *http.Request, err error) {
+	var dup *DuplicateSongError
+	if !errors.As(err, &dup) {
+		c.conflict(w, r, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/songs/%d", dup.ID))
+	c.json(w, r, duplicateSongDTO{
+		Error: err.Error(),
+		ID:    dup.ID,
+	}, http.StatusConflict)
+	c.log.Debug(r.Context(), "conflict", sl.Err(err))
+}
+
+func (c *controller) unprocessableEntity(w http.ResponseWriter, r *http.Request, err error) {
+	http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	c.log.Debug(r.Context(), "unprocessable entity", sl.Err(err))
+}
+
+func (c *controller) preconditionFailed(w http.ResponseWriter, r *http.Request, err error) {
+	http.Error(w, err.Error(), http.StatusPreconditionFailed)
+	c.log.Debug(r.Context(), "precondition failed", sl.Err(err))
+}
+
+func (c *controller) parseBool(q url.Values, name string) (bool, error) {
+	v := q.Get(name)
+	if len(v) == 0 {
+		return false, nil
+	}
+	r, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse %q query parameter: %w", name, err)
+	}
+	return r, nil
+}
+
+func (c *controller) parseUint(q url.Values, name string, bitSize int) (uint64, error) {
 	v := q.Get(name)
 	if len(v) == 0 {
 		return 0, nil
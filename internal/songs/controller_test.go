@@ -0,0 +1,200 @@
+package songs
+
+import (
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/httpx"
+)
+
+func TestSongsController_parseIfMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   versionCondition
+		err    error
+	}{
+		{
+			name: "missing",
+			want: versionCondition{any: true},
+		},
+		{
+			name:   "any",
+			header: "*",
+			want:   versionCondition{any: true},
+		},
+		{
+			name:   "strong",
+			header: `"3"`,
+			want:   versionCondition{versions: []int64{3}},
+		},
+		{
+			name:   "list",
+			header: `"3", W/"4" ,"5","abc"`,
+			want:   versionCondition{versions: []int64{3, 5}},
+		},
+		{
+			name:   "weak",
+			header: `W/"3"`,
+			want:   versionCondition{},
+		},
+		{
+			name:   "unquoted",
+			header: "3",
+			err:    ErrInvalidETag,
+		},
+		{
+			name:   "unclosed",
+			header: `"3", "4`,
+			err:    ErrInvalidETag,
+		},
+		{
+			name:   "missing comma",
+			header: `"3" "4"`,
+			err:    ErrInvalidETag,
+		},
+	}
+	c := &songsController{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("PATCH", "/songs/1", nil)
+			if tt.header != "" {
+				r.Header.Set("If-Match", tt.header)
+			}
+			got, err := c.parseIfMatch(r)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestController_parseQuery(t *testing.T) {
+	// The filter is longer than 1000 bytes when percent-encoded
+	filter := `IN(song, "(, )", "(, )", "(, )")`
+	filter = strings.Repeat(filter, 500/len(filter))
+	tests := []struct {
+		name  string
+		query url.Values
+		err   error
+	}{
+		{
+			name:  "encoded filter",
+			query: url.Values{"filter": {filter}},
+		},
+		{
+			name:  "long filter",
+			query: url.Values{"filter": {filter + strings.Repeat(" ", 501-len(filter))}},
+			err:   ErrFilterIsTooLong,
+		},
+		{
+			name:  "encoded parameter",
+			query: url.Values{"song[in]": {strings.Repeat(`\, "a"`, 60)}},
+		},
+		{
+			name:  "long parameter",
+			query: url.Values{"song": {strings.Repeat("a", 501)}},
+			err:   ErrFilterIsTooLong,
+		},
+		{
+			name: "long parameters",
+			query: url.Values{
+				"song":  {strings.Repeat("a", 400)},
+				"group": {strings.Repeat("a", 400), strings.Repeat("a", 200)},
+			},
+			err: ErrFilterIsTooLong,
+		},
+	}
+	c := newBaseController(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/songs?"+tt.query.Encode(), nil)
+			if _, err := c.parseQuery(r); !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestPatchVerseEdit(t *testing.T) {
+	text := []string{"text", "1"}
+	tests := []struct {
+		name  string
+		patch httpx.Patch
+		want  VerseEdit
+		ok    bool
+	}{
+		{
+			name: "replace with test",
+			patch: httpx.JSONPatch{
+				{Op: httpx.TestOp, Path: []string{"text", "0"}, Value: "A"},
+				{Op: httpx.ReplaceOp, Path: text, Value: "B"},
+			},
+			want: VerseEdit{Op: ReplaceVerse, Index: 1, Text: "B"},
+			ok:   true,
+		},
+		{
+			name:  "append",
+			patch: httpx.JSONPatch{{Op: httpx.AddOp, Path: []string{"text", "-"}, Value: "B"}},
+			want:  VerseEdit{Op: InsertVerse, Index: 3, Text: "B"},
+			ok:    true,
+		},
+		{
+			name:  "remove",
+			patch: httpx.JSONPatch{{Op: httpx.RemoveOp, Path: text}},
+			want:  VerseEdit{Op: RemoveVerse, Index: 1},
+			ok:    true,
+		},
+		{
+			name:  "move",
+			patch: httpx.JSONPatch{{Op: httpx.MoveOp, From: []string{"text", "2"}, Path: []string{"text", "0"}}},
+			want:  VerseEdit{Op: MoveVerse, Index: 0, From: 2},
+			ok:    true,
+		},
+		{
+			name:  "copy",
+			patch: httpx.JSONPatch{{Op: httpx.CopyOp, From: []string{"text", "2"}, Path: text}},
+		},
+		{
+			name:  "whole text",
+			patch: httpx.JSONPatch{{Op: httpx.ReplaceOp, Path: []string{"text"}, Value: []any{"A"}}},
+		},
+		{
+			name: "several changes",
+			patch: httpx.JSONPatch{
+				{Op: httpx.RemoveOp, Path: text},
+				{Op: httpx.RemoveOp, Path: text},
+			},
+		},
+		{
+			name:  "other field",
+			patch: httpx.JSONPatch{{Op: httpx.ReplaceOp, Path: []string{"song"}, Value: "A"}},
+		},
+		{
+			name:  "only tests",
+			patch: httpx.JSONPatch{{Op: httpx.TestOp, Path: text, Value: "A"}},
+		},
+		{
+			name:  "merge patch",
+			patch: httpx.MergePatch{Patch: map[string]any{"text": []any{"A"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := patchVerseEdit(tt.patch, 3)
+			if ok != tt.ok {
+				t.Fatalf("expected %v, got %v", tt.ok, ok)
+			}
+			if got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package songs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/httpx"
+)
+
+type creditDTO struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+type setCreditDTO struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+// SetSongArtists godoc
+// @Summary      Set song artists
+// @Description  Replaces additional artists credited on the song,
+// @Description  the song group is always its primary artist.
+// @Tags         songs
+// @Accept       json
+// @Param        songId  path   int64           true "Song id"
+// @Param        payload body   []setCreditDTO  true "Song artists"
+// @Success      204  {string}  string
+// @Failure      400  {string}  string
+// @Failure      404  {string}  string
+// @Failure      500  {string}  string
+// @Router       /songs/{songId}/artists [put]
+func (c *songsController) SetSongArtists(w http.ResponseWriter, r *http.Request) {
+	songId, err := c.parseSongId(r)
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	dtos, httpErr := httpx.JSONBody[[]setCreditDTO](c.log.Logger, c.decoder, w, r)
+	if httpErr != nil {
+		http.Error(w, httpErr.Text, httpErr.Status)
+		return
+	}
+	credits := make([]Credit, len(dtos))
+	for i, dto := range dtos {
+		credit := Credit{
+			Artist: strings.TrimSpace(dto.Name),
+			Role:   ArtistRole(dto.Role),
+		}
+		if len(credit.Artist) == 0 {
+			c.badRequest(w, r, fmt.Errorf("%w: %v", ErrInvalidField, "name"))
+			return
+		}
+		if !credit.Role.Valid() {
+			c.badRequest(w, r, fmt.Errorf("%w: %v", ErrInvalidField, "role"))
+			return
+		}
+		credits[i] = credit
+	}
+	if err := c.songsService.SetSongArtists(r.Context(), songId, credits); errors.Is(err, ErrSongNotFound) {
+		c.notFound(w, r, err)
+		return
+	} else if errors.Is(err, ErrDuplicateCredit) {
+		c.badRequest(w, r, err)
+		return
+	} else if err != nil {
+		c.serverError(w, r, err, "failed to set song artists")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,177 @@
+package songs
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/filter"
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/logger/sl"
+)
+
+var ErrUnknownExportFormat = errors.New("unknown export format")
+
+const (
+	ndjsonFormat = "ndjson"
+	csvFormat    = "csv"
+)
+
+// Columns of the CSV export, names match the JSON keys of songDTO
+var csvColumns = []string{
+	"id", "song", "group", "artistId", "releaseDate", "text", "link",
+	"albumId", "album", "discNumber", "trackNumber", "artists",
+}
+
+// Separator of the verses in the CSV text column,
+// the same as in the music info text
+const csvVerseSeparator = "\n\n"
+
+type songsEncoder interface {
+	Encode(dto songDTO) error
+	Flush() error
+}
+
+type ndjsonEncoder struct {
+	enc *json.Encoder
+}
+
+func (e ndjsonEncoder) Encode(dto songDTO) error {
+	return e.enc.Encode(dto)
+}
+
+func (e ndjsonEncoder) Flush() error {
+	return nil
+}
+
+type csvEncoder struct {
+	w      *csv.Writer
+	header bool
+}
+
+func (e *csvEncoder) writeHeader() error {
+	if e.header {
+		return nil
+	}
+	e.header = true
+	return e.w.Write(csvColumns)
+}
+
+func (e *csvEncoder) Encode(dto songDTO) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	return e.w.Write(csvRecord(dto))
+}
+
+func (e *csvEncoder) Flush() error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func csvRecord(dto songDTO) []string {
+	artists := make([]string, len(dto.Artists))
+	for i, a := range dto.Artists {
+		artists[i] = a.Role + ":" + a.Name
+	}
+	record := []string{
+		strconv.FormatInt(dto.ID, 10),
+		dto.Title,
+		dto.Artist,
+		strconv.FormatInt(dto.ArtistID, 10),
+		dto.ReleaseDate,
+		strings.Join(dto.Lyrics, csvVerseSeparator),
+		dto.Link,
+		"", "", "", "",
+		strings.Join(artists, "; "),
+	}
+	if dto.AlbumID != nil {
+		record[7] = strconv.FormatInt(*dto.AlbumID, 10)
+		record[8] = *dto.Album
+		record[9] = strconv.Itoa(dto.DiscNumber)
+		record[10] = strconv.Itoa(dto.TrackNumber)
+	}
+	return record
+}
+
+func newSongsEncoder(format string, w io.Writer) (songsEncoder, string, error) {
+	switch format {
+	case "", ndjsonFormat:
+		return ndjsonEncoder{enc: json.NewEncoder(w)}, "application/x-ndjson", nil
+	case csvFormat:
+		return &csvEncoder{w: csv.NewWriter(w)}, "text/csv; charset=utf-8", nil
+	default:
+		return nil, "", fmt.Errorf("%w: %q", ErrUnknownExportFormat, format)
+	}
+}
+
+// ExportSongs godoc
+// @Summary      Export songs
+// @Description  Streams all songs matching the filter ordered by id, the filter
+// @Description  parameters are the same as in `GET /songs`, pagination is ignored.
+// @Description  In CSV verses of the text are separated by an empty line
+// @Description  and artists are written as `role:name` pairs separated by `; `.
+// @Tags         songs
+// @Produce      application/x-ndjson,text/csv
+// @Param        filter   query  string  false  "Filter"
+// @Param        format   query  string  false  "Export format" Enums(ndjson, csv)
+// @Success      200  {object}  songDTO
+// @Failure      400  {string}  string
+// @Failure      500  {string}  string
+// @Router       /songs/export [get]
+func (c *songsController) ExportSongs(w http.ResponseWriter, r *http.Request) {
+	sq, err := c.parseQuery(r)
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	enc, contentType, err := newSongsEncoder(format, w)
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	if format == "" {
+		format = ndjsonFormat
+	}
+	// The response starts with the first song, so errors
+	// of the query itself are still reported with a status
+	started := false
+	start := func() {
+		started = true
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="songs.%s"`, format))
+		w.WriteHeader(http.StatusOK)
+	}
+	err = c.songsService.ExportSongs(r.Context(), sq, func(song Song) error {
+		if !started {
+			start()
+		}
+		return enc.Encode(toDTO(song))
+	})
+	if err != nil && !started {
+		if errors.Is(err, filter.ErrInvalidExpression) {
+			c.badRequest(w, r, err)
+			return
+		}
+		c.serverError(w, r, err, "failed to export songs")
+		return
+	}
+	if err != nil {
+		c.log.Error(r.Context(), "export is interrupted", sl.Err(err))
+		return
+	}
+	if !started {
+		start()
+	}
+	if err := enc.Flush(); err != nil {
+		c.log.Error(r.Context(), "failed to flush export", sl.Err(err))
+	}
+}
@@ -0,0 +1,173 @@
+package songs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/logger"
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/logger/sl"
+)
+
+var ErrIdempotencyKeyIsTooLong = errors.New("idempotency key is too long")
+var ErrIdempotencyKeyIsReused = errors.New("idempotency key is used with a different request")
+var ErrRequestIsInProgress = errors.New("request with the idempotency key is in progress")
+
+type IdempotencyRepo interface {
+	ReserveKey(ctx context.Context, key string, hash []byte, expiredBefore time.Time, leasedBefore time.Time) (IdempotentResponse, bool, error)
+	SaveResponse(ctx context.Context, key string, res IdempotentResponse) error
+	ReleaseKey(ctx context.Context, key string) error
+	PurgeKeys(ctx context.Context, before time.Time) (int64, error)
+}
+
+// responseRecorder keeps a copy of the response body
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	rr.ResponseWriter.WriteHeader(status)
+	rr.status = status
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	rr.body.Write(b)
+	return rr.ResponseWriter.Write(b)
+}
+
+// idempotency replays stored responses of requests with
+// the `Idempotency-Key` header, successful responses are stored
+// and the key is released after failures so the request can be retried
+type idempotency struct {
+	log      *logger.Logger
+	repo     IdempotencyRepo
+	maxBytes int64
+	// How long the keys are kept
+	keyTTL time.Duration
+	// How long the key without a response is reserved for the request,
+	// after that a retry takes it over (e.g. after a crash)
+	keyLease time.Duration
+}
+
+func newIdempotency(log *logger.Logger, repo IdempotencyRepo, keyTTL time.Duration) *idempotency {
+	return &idempotency{
+		log:      log,
+		repo:     repo,
+		maxBytes: 1 * 1024 * 1024,
+		keyTTL:   keyTTL,
+		keyLease: 1 * time.Minute,
+	}
+}
+
+func (i *idempotency) Handler(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next(w, r)
+			return
+		}
+		if utf8.RuneCountInString(key) > 255 {
+			i.error(w, r, ErrIdempotencyKeyIsTooLong, http.StatusBadRequest)
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, i.maxBytes))
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+			if errors.As(err, &maxBytesError) {
+				i.error(w, r, err, http.StatusRequestEntityTooLarge)
+				return
+			}
+			i.error(w, r, err, http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		hash := requestHash(r, body)
+		now := time.Now()
+		res, found, err := i.repo.ReserveKey(r.Context(), key, hash, now.Add(-i.keyTTL), now.Add(-i.keyLease))
+		if err != nil {
+			i.log.Error(r.Context(), "failed to reserve idempotency key", sl.Err(err))
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if found {
+			i.replay(w, r, res, hash)
+			return
+		}
+		// The outcome is stored and the key is released
+		// even if the request is cancelled
+		ctx := context.WithoutCancel(r.Context())
+		rec := &responseRecorder{ResponseWriter: w}
+		completed := false
+		defer func() {
+			if completed {
+				return
+			}
+			if err := i.repo.ReleaseKey(ctx, key); err != nil {
+				i.log.Error(ctx, "failed to release idempotency key", sl.Err(err))
+			}
+		}()
+		next(rec, r)
+		if rec.status < 200 || rec.status >= 300 {
+			return
+		}
+		completed = true
+		if err := i.repo.SaveResponse(ctx, key, IdempotentResponse{
+			RequestHash: hash,
+			Status:      rec.status,
+			ContentType: rec.Header().Get("Content-Type"),
+			Body:        rec.body.Bytes(),
+		}); err != nil {
+			i.log.Error(ctx, "failed to save idempotent response", sl.Err(err))
+		}
+	}
+}
+
+// PurgeKeys deletes expired keys and returns their number
+func (i *idempotency) PurgeKeys(ctx context.Context) (int64, error) {
+	return i.repo.PurgeKeys(ctx, time.Now().Add(-i.keyTTL))
+}
+
+func (i *idempotency) replay(w http.ResponseWriter, r *http.Request, res IdempotentResponse, hash []byte) {
+	if !bytes.Equal(res.RequestHash, hash) {
+		i.error(w, r, ErrIdempotencyKeyIsReused, http.StatusUnprocessableEntity)
+		return
+	}
+	if res.Status == 0 {
+		i.error(w, r, ErrRequestIsInProgress, http.StatusConflict)
+		return
+	}
+	if res.ContentType != "" {
+		w.Header().Set("Content-Type", res.ContentType)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(res.Status)
+	if _, err := w.Write(res.Body); err != nil {
+		i.log.Debug(r.Context(), "failed to replay response", sl.Err(err))
+	}
+}
+
+func (i *idempotency) error(w http.ResponseWriter, r *http.Request, err error, status int) {
+	http.Error(w, err.Error(), status)
+	i.log.Debug(r.Context(), "idempotency key is rejected", sl.Err(err))
+}
+
+// requestHash identifies the request by its method, path and body
+func requestHash(r *http.Request, body []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte(r.Method))
+	h.Write([]byte{0})
+	h.Write([]byte(r.URL.Path))
+	h.Write([]byte{0})
+	h.Write(body)
+	return h.Sum(nil)
+}
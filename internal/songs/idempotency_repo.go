@@ -0,0 +1,102 @@
+package songs
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/logger"
+)
+
+// IdempotentResponse is the stored response of the request
+// with the idempotency key
+type IdempotentResponse struct {
+	RequestHash []byte
+	// Zero while the request is processed
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+type idempotencyRepo struct {
+	log  *logger.Logger
+	pool *pgxpool.Pool
+}
+
+func newIdempotencyRepo(log *logger.Logger, pool *pgxpool.Pool) *idempotencyRepo {
+	return &idempotencyRepo{
+		log:  log,
+		pool: pool,
+	}
+}
+
+// Expired keys are reserved again as new ones, reservations of the same
+// request without a response are taken over after their lease expires
+const reserveKeyQuery = `INSERT INTO idempotency_key (key, request_hash) VALUES ($1, $2)` +
+	` ON CONFLICT (key) DO UPDATE SET request_hash = excluded.request_hash, response_status = NULL, response_content_type = NULL, response_body = NULL, created_at = now(), reserved_at = now()` +
+	` WHERE idempotency_key.created_at < $3 OR (idempotency_key.response_status IS NULL AND idempotency_key.reserved_at < $4 AND idempotency_key.request_hash = excluded.request_hash)`
+
+const idempotentResponseQuery = `SELECT request_hash, coalesce(response_status, 0), coalesce(response_content_type, ''), response_body FROM idempotency_key WHERE key = $1 AND created_at >= $2`
+
+// ReserveKey stores the key with the request hash, if the key
+// is already stored and created after expiredBefore its response
+// is returned with the true flag. The reservation of the same request
+// made before leasedBefore and still without a response is taken over.
+func (s *idempotencyRepo) ReserveKey(ctx context.Context, key string, hash []byte, expiredBefore time.Time, leasedBefore time.Time) (IdempotentResponse, bool, error) {
+	s.log.Debug(ctx, "executing query", slog.String("query", reserveKeyQuery), slog.String("key", key), slog.Time("expired_before", expiredBefore), slog.Time("leased_before", leasedBefore))
+	tag, err := s.pool.Exec(ctx, reserveKeyQuery, key, hash, expiredBefore, leasedBefore)
+	if err != nil {
+		return IdempotentResponse{}, false, err
+	}
+	if tag.RowsAffected() > 0 {
+		return IdempotentResponse{}, false, nil
+	}
+	s.log.Debug(ctx, "executing query", slog.String("query", idempotentResponseQuery), slog.String("key", key))
+	var res IdempotentResponse
+	err = s.pool.QueryRow(ctx, idempotentResponseQuery, key, expiredBefore).Scan(
+		&res.RequestHash,
+		&res.Status,
+		&res.ContentType,
+		&res.Body,
+	)
+	// The key is released or expired in the meantime
+	if errors.Is(err, pgx.ErrNoRows) {
+		return s.ReserveKey(ctx, key, hash, expiredBefore, leasedBefore)
+	}
+	if err != nil {
+		return IdempotentResponse{}, false, err
+	}
+	return res, true, nil
+}
+
+const saveResponseQuery = `UPDATE idempotency_key SET response_status = $2, response_content_type = $3, response_body = $4 WHERE key = $1`
+
+func (s *idempotencyRepo) SaveResponse(ctx context.Context, key string, res IdempotentResponse) error {
+	s.log.Debug(ctx, "executing query", slog.String("query", saveResponseQuery), slog.String("key", key))
+	_, err := s.pool.Exec(ctx, saveResponseQuery, key, res.Status, res.ContentType, res.Body)
+	return err
+}
+
+const releaseKeyQuery = `DELETE FROM idempotency_key WHERE key = $1 AND response_status IS NULL`
+
+// ReleaseKey removes the key without a response, so the request can be retried
+func (s *idempotencyRepo) ReleaseKey(ctx context.Context, key string) error {
+	s.log.Debug(ctx, "executing query", slog.String("query", releaseKeyQuery), slog.String("key", key))
+	_, err := s.pool.Exec(ctx, releaseKeyQuery, key)
+	return err
+}
+
+const purgeKeysQuery = `DELETE FROM idempotency_key WHERE created_at < $1`
+
+// PurgeKeys deletes keys created before the given time
+func (s *idempotencyRepo) PurgeKeys(ctx context.Context, before time.Time) (int64, error) {
+	s.log.Debug(ctx, "executing query", slog.String("query", purgeKeysQuery), slog.Time("before", before))
+	tag, err := s.pool.Exec(ctx, purgeKeysQuery, before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,185 @@
+package songs
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var ErrInvalidCSV = errors.New("invalid CSV")
+var ErrMissingColumn = errors.New("missing column")
+var ErrUnknownImportField = errors.New("unknown import field")
+var ErrEmptyValue = errors.New("empty value")
+var ErrValueIsTooLong = errors.New("value is too long")
+
+// Song fields that can be imported from CSV, columns of the other
+// fields are ignored
+var importFields = []SongField{Title, Group, ReleaseDate, Lyrics, Link}
+
+// Fields that must be present in the CSV and have non empty values
+var requiredImportFields = []SongField{Title, Group, ReleaseDate}
+
+// Maximum length of the string fields, see the song table
+const maxFieldLength = 255
+
+type ImportOptions struct {
+	// Names of the CSV columns by the song fields, unmapped fields
+	// are read from the columns with the same names as the fields
+	Columns map[SongField]string
+	// Layout of the release dates, the configured layout is used by default
+	DateLayout string
+	// Validate songs without saving them
+	DryRun bool
+}
+
+// RowError is a validation error of the CSV row,
+// the row number includes the header
+type RowError struct {
+	Row    int
+	Column string
+	Err    error
+}
+
+func (e RowError) Error() string {
+	if e.Column == "" {
+		return fmt.Sprintf("row %d: %s", e.Row, e.Err)
+	}
+	return fmt.Sprintf("row %d, column %q: %s", e.Row, e.Column, e.Err)
+}
+
+func (e RowError) Unwrap() error {
+	return e.Err
+}
+
+type ImportResult struct {
+	// Songs of the valid rows, saved unless it is a dry run
+	Songs []Song
+	// Nothing is saved if there are errors
+	Errors []RowError
+}
+
+// csvSongsReader maps CSV rows to songs
+type csvSongsReader struct {
+	r          *csv.Reader
+	dateLayout string
+	// Indexes of the columns by the song fields
+	columns map[SongField]int
+	names   map[SongField]string
+}
+
+func newCSVSongsReader(r io.Reader, columns map[SongField]string, dateLayout string) (*csvSongsReader, error) {
+	names := make(map[SongField]string, len(importFields))
+	for _, f := range importFields {
+		names[f] = string(f)
+	}
+	for f, name := range columns {
+		if _, ok := names[f]; !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownImportField, f)
+		}
+		names[f] = name
+	}
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: missing header", ErrInvalidCSV)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCSV, err)
+	}
+	indexes := make(map[SongField]int, len(importFields))
+	for _, f := range importFields {
+		for i, h := range header {
+			// Spreadsheets may save the byte order mark
+			if i == 0 {
+				h = strings.TrimPrefix(h, "\ufeff")
+			}
+			if strings.TrimSpace(h) == names[f] {
+				indexes[f] = i
+				break
+			}
+		}
+	}
+	for _, f := range requiredImportFields {
+		if _, ok := indexes[f]; !ok {
+			return nil, fmt.Errorf("%w: %q", ErrMissingColumn, names[f])
+		}
+	}
+	return &csvSongsReader{
+		r:          cr,
+		dateLayout: dateLayout,
+		columns:    indexes,
+		names:      names,
+	}, nil
+}
+
+// read returns the song of the next row and validation errors of the row,
+// io.EOF is returned at the end of the CSV
+func (r *csvSongsReader) read() (Song, []RowError, error) {
+	record, err := r.r.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return Song{}, nil, err
+		}
+		return Song{}, nil, fmt.Errorf("%w: %v", ErrInvalidCSV, err)
+	}
+	row, _ := r.r.FieldPos(0)
+	var errs []RowError
+	value := func(f SongField) string {
+		i, ok := r.columns[f]
+		if !ok {
+			return ""
+		}
+		if i >= len(record) {
+			if isRequiredImportField(f) {
+				errs = append(errs, RowError{Row: row, Column: r.names[f], Err: ErrEmptyValue})
+			}
+			return ""
+		}
+		v := strings.TrimSpace(record[i])
+		if v == "" && isRequiredImportField(f) {
+			errs = append(errs, RowError{Row: row, Column: r.names[f], Err: ErrEmptyValue})
+		} else if f != Lyrics && utf8.RuneCountInString(v) > maxFieldLength {
+			errs = append(errs, RowError{Row: row, Column: r.names[f], Err: ErrValueIsTooLong})
+		}
+		return v
+	}
+	title := value(Title)
+	artist := value(Group)
+	date := value(ReleaseDate)
+	text := value(Lyrics)
+	link := value(Link)
+	var releaseDate time.Time
+	if date != "" {
+		if releaseDate, err = time.Parse(r.dateLayout, date); err != nil {
+			errs = append(errs, RowError{
+				Row:    row,
+				Column: r.names[ReleaseDate],
+				Err:    fmt.Errorf("%w: %v", ErrInvalidDate, err),
+			})
+		}
+	}
+	return NewSong(title, artist, releaseDate, splitVerses(text), link), errs, nil
+}
+
+func isRequiredImportField(f SongField) bool {
+	return slices.Contains(requiredImportFields, f)
+}
+
+// splitVerses splits the text into verses separated by empty lines
+func splitVerses(text string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	verses := strings.Split(text, "\n\n")
+	lyrics := make([]string, 0, len(verses))
+	for _, v := range verses {
+		if v = strings.TrimSpace(v); v != "" {
+			lyrics = append(lyrics, v)
+		}
+	}
+	return lyrics
+}
@@ -0,0 +1,129 @@
+package songs
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+var ErrUnsupportedMediaType = errors.New("content type is not text/csv")
+
+// Maximum size of the imported CSV
+const maxImportBytes = 10 * 1024 * 1024
+
+type importReportDTO struct {
+	DryRun bool `json:"dryRun"`
+	// Number of valid rows
+	Rows int `json:"rows"`
+	// Ids of the created songs in the order of rows
+	IDs    []int64       `json:"ids,omitempty"`
+	Errors []rowErrorDTO `json:"errors"`
+}
+
+type rowErrorDTO struct {
+	// Row number including the header
+	Row    int    `json:"row"`
+	Column string `json:"column,omitempty"`
+	Error  string `json:"error"`
+}
+
+// ImportSongs godoc
+// @Summary      Import songs
+// @Description  Creates songs from CSV with a header row. By default the columns are
+// @Description  named as the song fields (`song`, `group`, `releaseDate`, `text`, `link`),
+// @Description  other names are set with parameters like `column[song]=Title`.
+// @Description  Verses of the text are separated by empty lines.
+// @Description  Nothing is saved if any row is invalid, the row errors are returned
+// @Description  with the 422 status.
+// @Tags         songs
+// @Accept       text/csv
+// @Produce      json
+// @Param        X-Author   header string  false  "Author of the change"
+// @Param        dryRun     query  bool    false  "Validate rows without saving songs"
+// @Param        dateLayout query  string  false  "Layout of the release dates in Go format, e.g. `2006-01-02`"
+// @Param        payload    body   string  true   "CSV"
+// @Success      200  {object}  importReportDTO  "Dry run report"
+// @Success      201  {object}  importReportDTO
+// @Failure      400  {string}  string
+// @Failure      409  {object}  duplicateSongDTO
+// @Failure      415  {string}  string
+// @Failure      422  {object}  importReportDTO
+// @Failure      500  {string}  string
+// @Router       /songs/import [post]
+func (c *songsController) ImportSongs(w http.ResponseWriter, r *http.Request) {
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mediaType := strings.ToLower(strings.TrimSpace(strings.Split(ct, ";")[0]))
+		if mediaType != "text/csv" {
+			http.Error(w, ErrUnsupportedMediaType.Error(), http.StatusUnsupportedMediaType)
+			return
+		}
+	}
+	author, err := c.parseAuthor(r)
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	q := r.URL.Query()
+	opts := ImportOptions{
+		Columns:    importColumns(q),
+		DateLayout: q.Get("dateLayout"),
+	}
+	if opts.DryRun, err = c.parseBool(q, "dryRun"); err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	body := http.MaxBytesReader(w, r.Body, maxImportBytes)
+	result, err := c.songsService.ImportSongs(r.Context(), body, opts, author)
+	if errors.Is(err, ErrInvalidCSV) ||
+		errors.Is(err, ErrMissingColumn) ||
+		errors.Is(err, ErrUnknownImportField) {
+		c.badRequest(w, r, err)
+		return
+	}
+	if errors.Is(err, ErrDuplicateSong) {
+		c.duplicateSong(w, r, err)
+		return
+	}
+	if err != nil {
+		c.serverError(w, r, err, "failed to import songs")
+		return
+	}
+	report := importReportDTO{
+		DryRun: opts.DryRun,
+		Rows:   len(result.Songs),
+		Errors: make([]rowErrorDTO, len(result.Errors)),
+	}
+	for i, e := range result.Errors {
+		report.Errors[i] = rowErrorDTO{
+			Row:    e.Row,
+			Column: e.Column,
+			Error:  e.Err.Error(),
+		}
+	}
+	if len(result.Errors) > 0 {
+		c.json(w, r, report, http.StatusUnprocessableEntity)
+		return
+	}
+	if opts.DryRun {
+		c.json(w, r, report, http.StatusOK)
+		return
+	}
+	report.IDs = make([]int64, len(result.Songs))
+	for i, s := range result.Songs {
+		report.IDs[i] = s.ID
+	}
+	c.json(w, r, report, http.StatusCreated)
+}
+
+// importColumns collects the column mapping from parameters like `column[song]=Title`
+func importColumns(q map[string][]string) map[SongField]string {
+	columns := make(map[SongField]string)
+	for k, v := range q {
+		field, ok := strings.CutPrefix(k, "column[")
+		if !ok || !strings.HasSuffix(field, "]") || len(v) == 0 {
+			continue
+		}
+		columns[SongField(field[:len(field)-1])] = v[0]
+	}
+	return columns
+}
@@ -0,0 +1,228 @@
+package songs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidLRC = errors.New("invalid LRC")
+var ErrTimestampsAreNotMonotonic = errors.New("timestamps are not monotonic")
+var ErrLyricsAreNotTimed = errors.New("lyrics are not timed")
+
+// LineTimes is the song field with start times of the lyrics lines
+const LineTimes SongField = "lineTimes"
+
+// Line times are stored in milliseconds as 32-bit integers
+const maxLRCTime = math.MaxInt32 * time.Millisecond
+
+// TimedLine is the lyrics line with its start time
+type TimedLine struct {
+	Time time.Duration
+	Text string
+}
+
+// TimedLyrics is the content of the LRC file, verses are separated
+// by empty lines and every line has exactly one timestamp
+type TimedLyrics struct {
+	Title  string
+	Artist string
+	Verses [][]TimedLine
+}
+
+var lrcTagRegexp = regexp.MustCompile(`^\[([^\]]*)\]`)
+
+var lrcTimeRegexp = regexp.MustCompile(`^(\d+):(\d{1,2})(?:[.:](\d{1,3}))?$`)
+
+// Word timestamps of the enhanced LRC
+var lrcWordTimeRegexp = regexp.MustCompile(`<\d+:\d{1,2}(?:[.:]\d{1,3})?>`)
+
+// ParseLRC reads lyrics from the LRC file. The `ti`, `ar` and `offset`
+// tags are supported, other ID tags are ignored. Timed lines without
+// text are instrumental breaks and separate verses like empty lines.
+func ParseLRC(r io.Reader) (TimedLyrics, error) {
+	var lyrics TimedLyrics
+	var verse []TimedLine
+	var offset time.Duration
+	endVerse := func() {
+		if len(verse) > 0 {
+			lyrics.Verses = append(lyrics.Verses, verse)
+			verse = nil
+		}
+	}
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		if n == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		line = strings.TrimSpace(line)
+		var times []time.Duration
+		for {
+			m := lrcTagRegexp.FindStringSubmatch(line)
+			if m == nil {
+				break
+			}
+			line = strings.TrimSpace(line[len(m[0]):])
+			if t, ok, err := parseLRCTime(m[1]); err != nil {
+				return TimedLyrics{}, fmt.Errorf("%w: line %d: %v", ErrInvalidLRC, n, err)
+			} else if ok {
+				times = append(times, t)
+				continue
+			}
+			key, value, _ := strings.Cut(m[1], ":")
+			value = strings.TrimSpace(value)
+			switch strings.ToLower(strings.TrimSpace(key)) {
+			case "ti":
+				lyrics.Title = value
+			case "ar":
+				lyrics.Artist = value
+			case "offset":
+				ms, err := strconv.Atoi(value)
+				if err != nil || ms < -math.MaxInt32 || ms > math.MaxInt32 {
+					return TimedLyrics{}, fmt.Errorf("%w: line %d: invalid offset %q", ErrInvalidLRC, n, value)
+				}
+				offset = time.Duration(ms) * time.Millisecond
+			}
+		}
+		line = strings.TrimSpace(lrcWordTimeRegexp.ReplaceAllString(line, ""))
+		switch {
+		case len(times) > 1:
+			return TimedLyrics{}, fmt.Errorf("%w: line %d: multiple timestamps", ErrInvalidLRC, n)
+		case len(times) == 0 && line != "":
+			return TimedLyrics{}, fmt.Errorf("%w: line %d: missing timestamp", ErrInvalidLRC, n)
+		case line == "":
+			endVerse()
+		case times[0]-offset > maxLRCTime:
+			return TimedLyrics{}, fmt.Errorf("%w: line %d: timestamp is too large", ErrInvalidLRC, n)
+		default:
+			// A positive offset shows the lyrics sooner
+			verse = append(verse, TimedLine{
+				Time: max(times[0]-offset, 0),
+				Text: line,
+			})
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return TimedLyrics{}, fmt.Errorf("%w: %w", ErrInvalidLRC, err)
+	}
+	endVerse()
+	if len(lyrics.Verses) == 0 {
+		return TimedLyrics{}, fmt.Errorf("%w: no timed lines", ErrInvalidLRC)
+	}
+	return lyrics, nil
+}
+
+// parseLRCTime parses `mm:ss.xx` timestamps, false is returned for other tags
+func parseLRCTime(tag string) (time.Duration, bool, error) {
+	m := lrcTimeRegexp.FindStringSubmatch(strings.TrimSpace(tag))
+	if m == nil {
+		return 0, false, nil
+	}
+	minutes, err := strconv.Atoi(m[1])
+	if err != nil || time.Duration(minutes) > maxLRCTime/time.Minute {
+		return 0, false, fmt.Errorf("timestamp %q is too large", tag)
+	}
+	seconds, _ := strconv.Atoi(m[2])
+	if seconds >= 60 {
+		return 0, false, fmt.Errorf("invalid timestamp %q", tag)
+	}
+	// Tenths, hundredths or milliseconds
+	ms := 0
+	if m[3] != "" {
+		ms, _ = strconv.Atoi(m[3] + strings.Repeat("0", 3-len(m[3])))
+	}
+	return time.Duration(minutes)*time.Minute +
+		time.Duration(seconds)*time.Second +
+		time.Duration(ms)*time.Millisecond, true, nil
+}
+
+// validate checks that the lines are timed in the order of the lyrics
+func (l TimedLyrics) validate() error {
+	var prev time.Duration
+	for _, verse := range l.Verses {
+		for _, line := range verse {
+			if line.Time < prev {
+				return fmt.Errorf("%w: %s goes after %s", ErrTimestampsAreNotMonotonic, formatLRCTime(line.Time), formatLRCTime(prev))
+			}
+			prev = line.Time
+		}
+	}
+	return nil
+}
+
+// songUpdate returns the update of the lyrics with times of their lines
+func (l TimedLyrics) songUpdate() SongUpdate {
+	lyrics := make([]string, len(l.Verses))
+	var times []int32
+	for i, verse := range l.Verses {
+		lines := make([]string, len(verse))
+		for j, line := range verse {
+			lines[j] = line.Text
+			times = append(times, int32(line.Time.Milliseconds()))
+		}
+		lyrics[i] = strings.Join(lines, "\n")
+	}
+	return SongUpdate{
+		Lyrics:    lyrics,
+		LineTimes: times,
+	}
+}
+
+// newTimedLyrics combines verses of the song with the stored line times
+func newTimedLyrics(song Song) (TimedLyrics, error) {
+	if song.LineTimes == nil {
+		return TimedLyrics{}, ErrLyricsAreNotTimed
+	}
+	lyrics := TimedLyrics{
+		Title:  song.Title,
+		Artist: song.Artist,
+		Verses: make([][]TimedLine, len(song.Lyrics)),
+	}
+	i := 0
+	for v, verse := range song.Lyrics {
+		lines := strings.Split(verse, "\n")
+		if i+len(lines) > len(song.LineTimes) {
+			return TimedLyrics{}, fmt.Errorf("%w: missing line times", ErrLyricsAreNotTimed)
+		}
+		lyrics.Verses[v] = make([]TimedLine, len(lines))
+		for j, line := range lines {
+			lyrics.Verses[v][j] = TimedLine{Time: song.LineTimes[i], Text: line}
+			i++
+		}
+	}
+	if i != len(song.LineTimes) {
+		return TimedLyrics{}, fmt.Errorf("%w: extra line times", ErrLyricsAreNotTimed)
+	}
+	return lyrics, nil
+}
+
+// WriteLRC writes the lyrics with the title and artist tags,
+// timestamps are written with hundredths of a second
+func (l TimedLyrics) WriteLRC(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	if l.Title != "" {
+		fmt.Fprintf(bw, "[ti:%s]\n", l.Title)
+	}
+	if l.Artist != "" {
+		fmt.Fprintf(bw, "[ar:%s]\n", l.Artist)
+	}
+	for _, verse := range l.Verses {
+		bw.WriteString("\n")
+		for _, line := range verse {
+			fmt.Fprintf(bw, "[%s]%s\n", formatLRCTime(line.Time), line.Text)
+		}
+	}
+	return bw.Flush()
+}
+
+func formatLRCTime(t time.Duration) string {
+	cs := t.Milliseconds() / 10
+	return fmt.Sprintf("%02d:%02d.%02d", cs/6000, cs/100%60, cs%100)
+}
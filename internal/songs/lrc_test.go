@@ -0,0 +1,136 @@
+package songs
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLRC(t *testing.T) {
+	tests := []struct {
+		name    string
+		lrc     string
+		want    TimedLyrics
+		wantErr error
+	}{
+		{
+			name: "tags and verses",
+			lrc:  "\ufeff[ti:Uprising]\n[ar:Muse]\n[length:05:04]\n\n[00:01.5]Paranoia is in bloom\n[01:02.345]The PR\n[01:05.00]\n[01:10.00]They will not force us",
+			want: TimedLyrics{
+				Title:  "Uprising",
+				Artist: "Muse",
+				Verses: [][]TimedLine{
+					{
+						{Time: 1500 * time.Millisecond, Text: "Paranoia is in bloom"},
+						{Time: time.Minute + 2345*time.Millisecond, Text: "The PR"},
+					},
+					{
+						{Time: time.Minute + 10*time.Second, Text: "They will not force us"},
+					},
+				},
+			},
+		},
+		{
+			name: "offset and word timestamps",
+			lrc:  "[offset:+1500]\n[00:01.00]<00:01.00>They <00:01.50>will",
+			want: TimedLyrics{
+				Verses: [][]TimedLine{{{Time: 0, Text: "They will"}}},
+			},
+		},
+		{
+			name:    "missing timestamp",
+			lrc:     "[00:01.00]They\nwill",
+			wantErr: ErrInvalidLRC,
+		},
+		{
+			name:    "multiple timestamps",
+			lrc:     "[00:01.00][00:10.00]They will",
+			wantErr: ErrInvalidLRC,
+		},
+		{
+			name:    "invalid seconds",
+			lrc:     "[00:61.00]They will",
+			wantErr: ErrInvalidLRC,
+		},
+		{
+			name:    "too large timestamp",
+			lrc:     "[35791:59.00]They will",
+			wantErr: ErrInvalidLRC,
+		},
+		{
+			name:    "overflowing minutes",
+			lrc:     "[99999999999999999999:00.00]They will",
+			wantErr: ErrInvalidLRC,
+		},
+		{
+			name:    "too large offset",
+			lrc:     "[offset:-2147483647]\n[35791:00.00]They will",
+			wantErr: ErrInvalidLRC,
+		},
+		{
+			name:    "no lines",
+			lrc:     "[ti:Uprising]\n",
+			wantErr: ErrInvalidLRC,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLRC(strings.NewReader(tt.lrc))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestTimedLyricsValidate(t *testing.T) {
+	lyrics := TimedLyrics{
+		Verses: [][]TimedLine{
+			{{Time: time.Second, Text: "A"}, {Time: time.Second, Text: "B"}},
+			{{Time: 500 * time.Millisecond, Text: "C"}},
+		},
+	}
+	if err := lyrics.validate(); !errors.Is(err, ErrTimestampsAreNotMonotonic) {
+		t.Fatalf("expected error %v, got %v", ErrTimestampsAreNotMonotonic, err)
+	}
+	lyrics.Verses[1][0].Time = 2 * time.Second
+	if err := lyrics.validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteLRC(t *testing.T) {
+	song := Song{
+		Title:     "Uprising",
+		Artist:    "Muse",
+		Lyrics:    []string{"Paranoia is in bloom\nThe PR", "They will not force us"},
+		LineTimes: []time.Duration{1500 * time.Millisecond, time.Minute + 2345*time.Millisecond, 70 * time.Second},
+	}
+	lyrics, err := newTimedLyrics(song)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := strings.Builder{}
+	if err := lyrics.WriteLRC(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := "[ti:Uprising]\n[ar:Muse]\n\n[00:01.50]Paranoia is in bloom\n[01:02.34]The PR\n\n[01:10.00]They will not force us\n"
+	if b.String() != want {
+		t.Errorf("expected %q, got %q", want, b.String())
+	}
+	song.LineTimes = song.LineTimes[:2]
+	if _, err := newTimedLyrics(song); !errors.Is(err, ErrLyricsAreNotTimed) {
+		t.Fatalf("expected error %v, got %v", ErrLyricsAreNotTimed, err)
+	}
+}
@@ -0,0 +1,326 @@
+package songs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/httpx"
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/logger/sl"
+)
+
+var ErrInvalidVerse = errors.New("invalid verse")
+
+type verseDTO struct {
+	// Text of the inserted or replaced verse
+	Text *string `json:"text,omitempty"`
+	// Index of the moved verse, the verse is placed at the index from the path
+	From *int `json:"from,omitempty"`
+}
+
+// ReplaceVerse godoc
+// @Summary      Replace verse
+// @Tags         songs
+// @Accept       json
+// @Param        songId   path   int64     true   "Song id"
+// @Param        index    path   int       true   "Verse index starting from zero"
+// @Param        If-Match header string    false  "Song version"
+// @Param        X-Author header string    false  "Author of the change"
+// @Param        payload  body   verseDTO  true   "Verse text"
+// @Success      204  {string}  string
+// @Header       204  {string}  ETag  "New song version"
+// @Failure      400  {string}  string
+// @Failure      404  {string}  string
+// @Failure      412  {string}  string
+// @Failure      500  {string}  string
+// @Router       /songs/{songId}/lyrics/{index} [put]
+func (c *songsController) ReplaceVerse(w http.ResponseWriter, r *http.Request) {
+	v, httpErr := httpx.JSONBody[verseDTO](c.log.Logger, c.decoder, w, r)
+	if httpErr != nil {
+		http.Error(w, httpErr.Text, httpErr.Status)
+		return
+	}
+	if v.From != nil {
+		c.badRequest(w, r, fmt.Errorf("%w: verses are moved with the POST method", ErrInvalidVerse))
+		return
+	}
+	edit := VerseEdit{Op: ReplaceVerse}
+	if err := verseText(&edit, v); err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	c.editLyrics(w, r, edit)
+}
+
+// InsertVerse godoc
+// @Summary      Insert or move verse
+// @Description  Inserts the verse with the given text before the verse at the index,
+// @Description  the index equal to the number of verses appends the verse.
+// @Description  With the `from` field the verse at that index is moved to the index from the path.
+// @Tags         songs
+// @Accept       json
+// @Param        songId   path   int64     true   "Song id"
+// @Param        index    path   int       true   "Verse index starting from zero"
+// @Param        If-Match header string    false  "Song version"
+// @Param        X-Author header string    false  "Author of the change"
+// @Param        payload  body   verseDTO  true   "Verse text or index of the moved verse"
+// @Success      204  {string}  string
+// @Header       204  {string}  ETag  "New song version"
+// @Failure      400  {string}  string
+// @Failure      404  {string}  string
+// @Failure      412  {string}  string
+// @Failure      500  {string}  string
+// @Router       /songs/{songId}/lyrics/{index} [post]
+func (c *songsController) InsertVerse(w http.ResponseWriter, r *http.Request) {
+	v, httpErr := httpx.JSONBody[verseDTO](c.log.Logger, c.decoder, w, r)
+	if httpErr != nil {
+		http.Error(w, httpErr.Text, httpErr.Status)
+		return
+	}
+	if v.From != nil {
+		if v.Text != nil {
+			c.badRequest(w, r, fmt.Errorf("%w: text and from are mutually exclusive", ErrInvalidVerse))
+			return
+		}
+		c.editLyrics(w, r, VerseEdit{Op: MoveVerse, From: *v.From})
+		return
+	}
+	edit := VerseEdit{Op: InsertVerse}
+	if err := verseText(&edit, v); err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	c.editLyrics(w, r, edit)
+}
+
+// RemoveVerse godoc
+// @Summary      Remove verse
+// @Tags         songs
+// @Param        songId   path   int64   true   "Song id"
+// @Param        index    path   int     true   "Verse index starting from zero"
+// @Param        If-Match header string  false  "Song version"
+// @Param        X-Author header string  false  "Author of the change"
+// @Success      204  {string}  string
+// @Header       204  {string}  ETag  "New song version"
+// @Failure      400  {string}  string
+// @Failure      404  {string}  string
+// @Failure      412  {string}  string
+// @Failure      500  {string}  string
+// @Router       /songs/{songId}/lyrics/{index} [delete]
+func (c *songsController) RemoveVerse(w http.ResponseWriter, r *http.Request) {
+	c.editLyrics(w, r, VerseEdit{Op: RemoveVerse})
+}
+
+func verseText(edit *VerseEdit, v verseDTO) error {
+	if v.Text == nil || len(strings.TrimSpace(*v.Text)) == 0 {
+		return fmt.Errorf("%w: text is empty", ErrInvalidVerse)
+	}
+	edit.Text = *v.Text
+	return nil
+}
+
+// editLyrics completes the edit with the path parameters
+// and applies it to the song
+func (c *songsController) editLyrics(w http.ResponseWriter, r *http.Request, edit VerseEdit) {
+	songId, err := c.parseSongId(r)
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	if edit.Index, err = c.parseVerseIndex(r); err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	version, err := c.ifMatchVersion(r, songId)
+	if err != nil {
+		c.ifMatchFailed(w, r, err)
+		return
+	}
+	author, err := c.parseAuthor(r)
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	c.applyVerseEdit(w, r, songId, version, edit, author)
+}
+
+func (c *songsController) applyVerseEdit(w http.ResponseWriter, r *http.Request, songId int64, version int64, edit VerseEdit, author string) {
+	version, err := c.songsService.EditLyrics(r.Context(), songId, version, edit, author)
+	if errors.Is(err, ErrSongNotFound) || errors.Is(err, ErrVerseNotFound) {
+		c.notFound(w, r, err)
+		return
+	}
+	if errors.Is(err, ErrSongVersionMismatch) {
+		c.preconditionFailed(w, r, err)
+		return
+	}
+	if err != nil {
+		c.serverError(w, r, err, "failed to edit lyrics")
+		return
+	}
+	w.Header().Set("ETag", songETag(version))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *songsController) parseVerseIndex(r *http.Request) (int, error) {
+	index, err := strconv.Atoi(r.PathValue("index"))
+	if err != nil {
+		return 0, fmt.Errorf("%w: index %v", ErrInvalidField, err)
+	}
+	if index < 0 {
+		return 0, fmt.Errorf("%w: index is negative", ErrInvalidField)
+	}
+	return index, nil
+}
+
+var ErrUnsupportedLRCMediaType = errors.New("content type is not text/plain")
+
+// GetLRC godoc
+// @Summary      Get timed lyrics
+// @Description  Returns the lyrics in the LRC format, verses are separated by empty lines.
+// @Description  The lyrics are timed by uploading the LRC file, other changes of the lyrics
+// @Description  remove the timestamps.
+// @Tags         songs
+// @Produce      text/plain
+// @Param        songId   path   int64   true   "Song id"
+// @Success      200  {string}  string
+// @Header       200  {string}  ETag  "Song version"
+// @Failure      400  {string}  string
+// @Failure      404  {string}  string
+// @Failure      500  {string}  string
+// @Router       /songs/{songId}/lyrics.lrc [get]
+func (c *songsController) GetLRC(w http.ResponseWriter, r *http.Request) {
+	songId, err := c.parseSongId(r)
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	lyrics, version, err := c.songsService.GetTimedLyrics(r.Context(), songId)
+	if errors.Is(err, ErrSongNotFound) || errors.Is(err, ErrLyricsAreNotTimed) {
+		c.notFound(w, r, err)
+		return
+	}
+	if err != nil {
+		c.serverError(w, r, err, "failed to get timed lyrics")
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%d.lrc"`, songId))
+	w.Header().Set("ETag", songETag(version))
+	w.WriteHeader(http.StatusOK)
+	if err := lyrics.WriteLRC(w); err != nil {
+		c.log.Debug(r.Context(), "failed to write LRC", sl.Err(err))
+	}
+}
+
+// SetLRC godoc
+// @Summary      Set timed lyrics
+// @Description  Replaces the lyrics with the lines of the LRC file, every line must have
+// @Description  one `[mm:ss.xx]` timestamp and the timestamps must not decrease.
+// @Description  Empty lines and timed lines without text separate verses.
+// @Description  The `offset` tag is applied, the title and the artist tags are ignored.
+// @Tags         songs
+// @Accept       text/plain
+// @Param        songId   path   int64   true   "Song id"
+// @Param        If-Match header string  false  "Song version"
+// @Param        X-Author header string  false  "Author of the change"
+// @Param        payload  body   string  true   "LRC"
+// @Success      204  {string}  string
+// @Header       204  {string}  ETag  "New song version"
+// @Failure      400  {string}  string
+// @Failure      404  {string}  string
+// @Failure      412  {string}  string
+// @Failure      413  {string}  string
+// @Failure      415  {string}  string
+// @Failure      422  {string}  string
+// @Failure      500  {string}  string
+// @Router       /songs/{songId}/lyrics.lrc [put]
+func (c *songsController) SetLRC(w http.ResponseWriter, r *http.Request) {
+	if mt := httpx.MediaType(r); mt != "" && mt != "text/plain" {
+		http.Error(w, ErrUnsupportedLRCMediaType.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	songId, err := c.parseSongId(r)
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	version, err := c.ifMatchVersion(r, songId)
+	if err != nil {
+		c.ifMatchFailed(w, r, err)
+		return
+	}
+	author, err := c.parseAuthor(r)
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	lyrics, err := ParseLRC(http.MaxBytesReader(w, r.Body, c.decoder.MaxBytes))
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	version, err = c.songsService.SetTimedLyrics(r.Context(), songId, version, lyrics, author)
+	if errors.Is(err, ErrSongNotFound) {
+		c.notFound(w, r, err)
+		return
+	}
+	if errors.Is(err, ErrSongVersionMismatch) {
+		c.preconditionFailed(w, r, err)
+		return
+	}
+	if errors.Is(err, ErrTimestampsAreNotMonotonic) {
+		c.unprocessableEntity(w, r, err)
+		return
+	}
+	if err != nil {
+		c.serverError(w, r, err, "failed to set timed lyrics")
+		return
+	}
+	w.Header().Set("ETag", songETag(version))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetLyrics godoc
+// @Summary      Get lyrics
+// @Tags         songs
+// @Produce      json
+// @Param        songId   path   int64   true   "Song id"
+// @Param        page     query  uint64  false  "Page number"
+// @Param        pageSize query  uint64  false  "Page size"
+// @Success      200  {array}   string
+// @Failure      400  {string}  string
+// @Failure      404  {string}  string
+// @Failure      500  {string}  string
+// @Router       /songs/{songId}/lyrics [get]
+func (c *songsController) GetLyrics(w http.ResponseWriter, r *http.Request) {
+	songId, err := c.parseSongId(r)
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	Pagination := Pagination{
+		PageSize: c.maxPageSize,
+	}
+	if err := c.parsePagination(&Pagination, r.URL.Query()); err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	lyrics, err := c.songsService.GetLyrics(r.Context(), songId, Pagination)
+	if errors.Is(err, ErrSongNotFound) {
+		c.notFound(w, r, err)
+		return
+	}
+	if err != nil {
+		c.serverError(w, r, err, "failed to get lyrics")
+		return
+	}
+	c.json(w, r, lyrics, http.StatusOK)
+}
@@ -0,0 +1,150 @@
+package songs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrVerseNotFound = errors.New("verse not found")
+
+// Array expressions of the verse edits, array indexes start from one
+// and parameters are zero based indexes
+var verseEditExpressions = map[VerseOp]string{
+	InsertVerse:  `lyrics[:$2::int] || $3::text || lyrics[$2::int + 1:]`,
+	ReplaceVerse: `lyrics[:$2::int] || $3::text || lyrics[$2::int + 2:]`,
+	MoveVerse:    `(lyrics[:$3::int] || lyrics[$3::int + 2:])[:$2::int] || lyrics[$3::int + 1] || (lyrics[:$3::int] || lyrics[$3::int + 2:])[$2::int + 1:]`,
+	RemoveVerse:  `lyrics[:$2::int] || lyrics[$2::int + 2:]`,
+}
+
+// EditLyrics applies the verse edit and returns the new version of the song,
+// if the version is not zero the song is updated only if it has the given version
+func (s *Repo) EditLyrics(ctx context.Context, id int64, version int64, edit VerseEdit, author string) (int64, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+	before, err := s.songState(ctx, tx, id)
+	if err != nil {
+		return 0, err
+	}
+	count := len(before[Lyrics].([]string))
+	// A verse can be inserted after the last one
+	last := count - 1
+	if edit.Op == InsertVerse {
+		last = count
+	}
+	if edit.Index < 0 || edit.Index > last {
+		return 0, fmt.Errorf("%w: index %d", ErrVerseNotFound, edit.Index)
+	}
+	args := []any{id, edit.Index}
+	switch edit.Op {
+	case InsertVerse, ReplaceVerse:
+		args = append(args, edit.Text)
+	case MoveVerse:
+		if edit.From < 0 || edit.From > last {
+			return 0, fmt.Errorf("%w: index %d", ErrVerseNotFound, edit.From)
+		}
+		args = append(args, edit.From)
+	}
+	q := `SELECT ` + verseEditExpressions[edit.Op] + ` FROM song WHERE id = $1`
+	s.log.Debug(ctx, "executing query", slog.String("query", q), slog.Any("args", args))
+	var lyrics []string
+	if err := tx.QueryRow(ctx, q, args...).Scan(&lyrics); err != nil {
+		return 0, err
+	}
+	// The statistics are computed from the edited lyrics
+	upd := withLyricsStats(SongUpdate{Lyrics: lyrics})
+	newVersion, err := s.updateSongTx(ctx, tx, id, version, upd, author, UpdateAction)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return newVersion, nil
+}
+
+const timedLyricsQuery = `SELECT song.title, artist.name, song.lyrics, song.lyrics_times, song.version FROM song JOIN artist ON artist.id = song.artist_id WHERE song.id = $1 AND song.deleted_at IS NULL`
+
+// GetTimedLyrics returns the song with its lyrics and line times only
+func (s *Repo) GetTimedLyrics(ctx context.Context, id int64) (Song, error) {
+	s.log.Debug(ctx, "executing query", slog.String("query", timedLyricsQuery), slog.Int64("id", id))
+	song := Song{ID: id}
+	var times []int32
+	err := s.pool.QueryRow(ctx, timedLyricsQuery, id).Scan(&song.Title, &song.Artist, &song.Lyrics, &times, &song.Version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Song{}, ErrSongNotFound
+	}
+	if err != nil {
+		return Song{}, err
+	}
+	if times != nil {
+		song.LineTimes = make([]time.Duration, len(times))
+		for i, t := range times {
+			song.LineTimes[i] = time.Duration(t) * time.Millisecond
+		}
+	}
+	return song, nil
+}
+
+const outdatedStatsQuery = `SELECT song.id, song.lyrics FROM lyrics_stats_recount JOIN song ON song.id = lyrics_stats_recount.song_id ORDER BY song.id LIMIT $1`
+
+// GetOutdatedStats returns ids and lyrics of the songs
+// whose statistics must be recounted
+func (s *Repo) GetOutdatedStats(ctx context.Context, limit int) ([]Song, error) {
+	s.log.Debug(ctx, "executing query", slog.String("query", outdatedStatsQuery), slog.Int("limit", limit))
+	rows, err := s.pool.Query(ctx, outdatedStatsQuery, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var songs []Song
+	for rows.Next() {
+		var song Song
+		if err := rows.Scan(&song.ID, &song.Lyrics); err != nil {
+			return nil, err
+		}
+		songs = append(songs, song)
+	}
+	return songs, rows.Err()
+}
+
+// The statistics are not a change of the song
+const keepSongVersionQuery = `SET LOCAL song.keep_version = 'on'`
+
+// Songs with lyrics changed after reading already have new statistics
+const saveLyricsStatsQuery = `UPDATE song SET verse_count = $2, line_count = $3, word_count = $4, unique_word_count = $5 WHERE id = $1 AND lyrics = $6`
+
+const recountedStatsQuery = `DELETE FROM lyrics_stats_recount WHERE song_id = ANY($1)`
+
+// SaveLyricsStats stores the recounted statistics of the songs
+// without changing their versions
+func (s *Repo) SaveLyricsStats(ctx context.Context, songs []Song) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	s.log.Debug(ctx, "executing query", slog.String("query", keepSongVersionQuery))
+	if _, err := tx.Exec(ctx, keepSongVersionQuery); err != nil {
+		return err
+	}
+	b := &pgx.Batch{}
+	ids := make([]int64, len(songs))
+	for i, song := range songs {
+		ids[i] = song.ID
+		b.Queue(saveLyricsStatsQuery, song.ID, song.Stats.Verses, song.Stats.Lines, song.Stats.Words, song.Stats.UniqueWords, song.Lyrics)
+	}
+	b.Queue(recountedStatsQuery, ids)
+	s.log.Debug(ctx, "executing batch", slog.String("query", saveLyricsStatsQuery), slog.Int("count", len(songs)))
+	if err := tx.SendBatch(ctx, b).Close(); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
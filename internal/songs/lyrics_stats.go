@@ -0,0 +1,78 @@
+package songs
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Statistics of the song lyrics, stored with the song
+// and available in the filter schema
+const (
+	VerseCount      SongField = "verseCount"
+	LineCount       SongField = "lineCount"
+	WordCount       SongField = "wordCount"
+	UniqueWordCount SongField = "uniqueWordCount"
+)
+
+type LyricsStats struct {
+	Verses int
+	// Non empty lines of all verses
+	Lines int
+	Words int
+	// Words are compared ignoring case
+	UniqueWords int
+}
+
+func NewLyricsStats(lyrics []string) LyricsStats {
+	stats := LyricsStats{
+		Verses: len(lyrics),
+	}
+	unique := make(map[string]struct{})
+	for _, verse := range lyrics {
+		for _, line := range strings.Split(verse, "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			stats.Lines++
+			for _, w := range lyricsWords(line) {
+				stats.Words++
+				unique[strings.ToLower(w)] = struct{}{}
+			}
+		}
+	}
+	stats.UniqueWords = len(unique)
+	return stats
+}
+
+// lyricsWords splits the line into words of letters, digits
+// and inner apostrophes, e.g. "don't"
+func lyricsWords(line string) []string {
+	fields := strings.FieldsFunc(line, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && !isApostrophe(r)
+	})
+	words := fields[:0]
+	for _, f := range fields {
+		if f = strings.TrimFunc(f, isApostrophe); f != "" {
+			words = append(words, f)
+		}
+	}
+	return words
+}
+
+func isApostrophe(r rune) bool {
+	return r == '\'' || r == '’'
+}
+
+// withLyricsStats adds the statistics of the updated lyrics to the update
+func withLyricsStats(upd SongUpdate) SongUpdate {
+	lyrics, ok := upd[Lyrics].([]string)
+	if !ok {
+		return upd
+	}
+	stats := NewLyricsStats(lyrics)
+	upd[VerseCount] = stats.Verses
+	upd[LineCount] = stats.Lines
+	upd[WordCount] = stats.Words
+	upd[UniqueWordCount] = stats.UniqueWords
+	return upd
+}
@@ -0,0 +1,37 @@
+package songs
+
+import "testing"
+
+func TestNewLyricsStats(t *testing.T) {
+	tests := []struct {
+		name   string
+		lyrics []string
+		want   LyricsStats
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:   "lines",
+			lyrics: []string{"Ooh\nYou set my soul alight\n\nOoh", "  \n"},
+			want:   LyricsStats{Verses: 2, Lines: 3, Words: 7, UniqueWords: 6},
+		},
+		{
+			name:   "case and punctuation",
+			lyrics: []string{"Don't stop, don't STOP! 'Cause - 1, 2..."},
+			want:   LyricsStats{Verses: 1, Lines: 1, Words: 7, UniqueWords: 5},
+		},
+		{
+			name:   "unicode",
+			lyrics: []string{"Группа крови на рукаве,\nмой порядковый номер на рукаве"},
+			want:   LyricsStats{Verses: 1, Lines: 2, Words: 9, UniqueWords: 7},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewLyricsStats(tt.lyrics); got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package songs
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/httpx"
+)
+
+type mergeSongDTO struct {
+	// Id of the duplicate song
+	SongID int64 `json:"songId"`
+}
+
+// MergeSongs godoc
+// @Summary      Merge songs
+// @Description  Moves the given duplicate song to the trash (duplicates are usually found there),
+// @Description  adds its additional artists to the song from the path and fills the missing lyrics,
+// @Description  link and album track of the song from the path with the duplicate values.
+// @Description  Songs must have the same artist and title.
+// @Tags         songs
+// @Accept       json
+// @Param        songId   path   int64         true   "Song id"
+// @Param        If-Match header string        false  "Song version"
+// @Param        X-Author header string        false  "Author of the change"
+// @Param        payload  body   mergeSongDTO  true   "Song to merge"
+// @Success      204  {string}  string
+// @Header       204  {string}  ETag  "New song version"
+// @Failure      400  {string}  string
+// @Failure      404  {string}  string
+// @Failure      409  {string}  string
+// @Failure      412  {string}  string
+// @Failure      500  {string}  string
+// @Router       /songs/{songId}/merge [post]
+func (c *songsController) MergeSongs(w http.ResponseWriter, r *http.Request) {
+	songId, err := c.parseSongId(r)
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	merge, httpErr := httpx.JSONBody[mergeSongDTO](c.log.Logger, c.decoder, w, r)
+	if httpErr != nil {
+		http.Error(w, httpErr.Text, httpErr.Status)
+		return
+	}
+	version, err := c.ifMatchVersion(r, songId)
+	if err != nil {
+		c.ifMatchFailed(w, r, err)
+		return
+	}
+	author, err := c.parseAuthor(r)
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	version, err = c.songsService.MergeSongs(r.Context(), songId, version, merge.SongID, author)
+	if errors.Is(err, ErrSongNotFound) {
+		c.notFound(w, r, err)
+		return
+	} else if errors.Is(err, ErrCannotMergeSongIntoItself) || errors.Is(err, ErrAlbumNotFound) {
+		// The album of the source track may be deleted concurrently
+		c.badRequest(w, r, err)
+		return
+	} else if errors.Is(err, ErrSongVersionMismatch) {
+		c.preconditionFailed(w, r, err)
+		return
+	} else if errors.Is(err, ErrDuplicateSong) {
+		c.duplicateSong(w, r, err)
+		return
+	} else if errors.Is(err, ErrSongsAreNotDuplicates) || errors.Is(err, ErrTrackIsTaken) {
+		c.conflict(w, r, err)
+		return
+	} else if err != nil {
+		c.serverError(w, r, err, "failed to merge songs")
+		return
+	}
+	w.Header().Set("ETag", songETag(version))
+	w.WriteHeader(http.StatusNoContent)
+}
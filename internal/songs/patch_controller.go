@@ -0,0 +1,255 @@
+package songs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/httpx"
+)
+
+var ErrRequiredFieldIsRemoved = errors.New("required field is removed")
+
+// patchSong applies the patch to the updatable fields of the song,
+// the song is updated only if it is not changed after reading
+func (c *songsController) patchSong(w http.ResponseWriter, r *http.Request, songId int64, p httpx.Patch) {
+	vc, err := c.parseIfMatch(r)
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	author, err := c.parseAuthor(r)
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	song, err := c.songsService.GetSong(r.Context(), songId)
+	if errors.Is(err, ErrSongNotFound) {
+		c.notFound(w, r, err)
+		return
+	}
+	if err != nil {
+		c.serverError(w, r, err, "failed to get song")
+		return
+	}
+	if !vc.matches(song.Version) {
+		c.preconditionFailed(w, r, ErrSongVersionMismatch)
+		return
+	}
+	doc, err := patchDocument(song)
+	if err != nil {
+		c.serverError(w, r, err, "failed to create patch document")
+		return
+	}
+	patched, err := p.Apply(doc)
+	if errors.Is(err, httpx.ErrTestFailed) {
+		c.conflict(w, r, err)
+		return
+	}
+	if errors.Is(err, httpx.ErrPathNotFound) || errors.Is(err, httpx.ErrInvalidPatch) {
+		c.unprocessableEntity(w, r, err)
+		return
+	}
+	if err != nil {
+		c.serverError(w, r, err, "failed to apply patch")
+		return
+	}
+	// Changes of a single verse are applied as verse edits
+	if edit, ok := patchVerseEdit(p, len(song.Lyrics)); ok {
+		c.applyVerseEdit(w, r, songId, song.Version, edit, author)
+		return
+	}
+	upd, err := patchUpdate(song, patched)
+	if err != nil {
+		c.unprocessableEntity(w, r, err)
+		return
+	}
+	// Patches with only tests change nothing
+	if len(upd) == 0 {
+		w.Header().Set("ETag", songETag(song.Version))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	c.updateSong(w, r, songId, song.Version, upd, author)
+}
+
+// patchVerseEdit returns the verse edit if the JSON Patch changes a single
+// verse of the text (`/text/N`) and only tests other values, the patch
+// must be applied successfully to the song with the given number of verses
+func patchVerseEdit(p httpx.Patch, verses int) (VerseEdit, bool) {
+	jp, ok := p.(httpx.JSONPatch)
+	if !ok {
+		return VerseEdit{}, false
+	}
+	var change *httpx.PatchOperation
+	for i := range jp {
+		if jp[i].Op == httpx.TestOp {
+			continue
+		}
+		if change != nil {
+			return VerseEdit{}, false
+		}
+		change = &jp[i]
+	}
+	if change == nil {
+		return VerseEdit{}, false
+	}
+	index, ok := verseIndex(change.Path, verses)
+	if !ok {
+		return VerseEdit{}, false
+	}
+	edit := VerseEdit{Index: index}
+	switch change.Op {
+	case httpx.AddOp, httpx.ReplaceOp:
+		text, ok := change.Value.(string)
+		if !ok {
+			return VerseEdit{}, false
+		}
+		edit.Op = ReplaceVerse
+		if change.Op == httpx.AddOp {
+			edit.Op = InsertVerse
+		}
+		edit.Text = text
+	case httpx.RemoveOp:
+		edit.Op = RemoveVerse
+	case httpx.MoveOp:
+		if edit.From, ok = verseIndex(change.From, verses); !ok {
+			return VerseEdit{}, false
+		}
+		edit.Op = MoveVerse
+	default:
+		return VerseEdit{}, false
+	}
+	return edit, true
+}
+
+// verseIndex parses the `/text/N` path, `-` is the index after the last verse
+func verseIndex(path []string, verses int) (int, bool) {
+	if len(path) != 2 || path[0] != "text" {
+		return 0, false
+	}
+	if path[1] == "-" {
+		return verses, true
+	}
+	index, err := strconv.Atoi(path[1])
+	return index, err == nil && index >= 0
+}
+
+// patchFields returns the updatable fields of the song,
+// the album fields are nil if the song is not on an album
+func patchFields(song Song) updateSongDTO {
+	releaseDate := song.ReleaseDate.Format(releaseDateFormat)
+	lyrics := song.Lyrics
+	if lyrics == nil {
+		lyrics = []string{}
+	}
+	u := updateSongDTO{
+		Title:       &song.Title,
+		Artist:      &song.Artist,
+		ReleaseDate: &releaseDate,
+		Lyrics:      &lyrics,
+		Link:        &song.Link,
+	}
+	if song.Track != nil {
+		u.AlbumID = &song.Track.AlbumID
+		u.DiscNumber = &song.Track.DiscNumber
+		u.TrackNumber = &song.Track.Number
+	}
+	return u
+}
+
+// patchDocument is the JSON document the patches are applied to
+func patchDocument(song Song) (any, error) {
+	data, err := json.Marshal(patchFields(song))
+	if err != nil {
+		return nil, err
+	}
+	var doc any
+	err = json.Unmarshal(data, &doc)
+	return doc, err
+}
+
+// patchUpdate compares the patched document with the song,
+// removed album fields are cleared, removed text and link are emptied
+func patchUpdate(song Song, patched any) (SongUpdate, error) {
+	data, err := json.Marshal(patched)
+	if err != nil {
+		return nil, err
+	}
+	var u updateSongDTO
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&u); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidField, err)
+	}
+	if u.Title == nil {
+		return nil, fmt.Errorf("%w: %s", ErrRequiredFieldIsRemoved, Title)
+	}
+	if u.Artist == nil {
+		return nil, fmt.Errorf("%w: %s", ErrRequiredFieldIsRemoved, Group)
+	}
+	if u.ReleaseDate == nil {
+		return nil, fmt.Errorf("%w: %s", ErrRequiredFieldIsRemoved, ReleaseDate)
+	}
+	if u.Lyrics == nil {
+		u.Lyrics = &[]string{}
+	}
+	if u.Link == nil {
+		u.Link = new(string)
+	}
+	orig := patchFields(song)
+	changed := updateSongDTO{}
+	if *u.Title != *orig.Title {
+		changed.Title = u.Title
+	}
+	if *u.Artist != *orig.Artist {
+		changed.Artist = u.Artist
+	}
+	if *u.ReleaseDate != *orig.ReleaseDate {
+		changed.ReleaseDate = u.ReleaseDate
+	}
+	if !slices.Equal(*u.Lyrics, *orig.Lyrics) {
+		changed.Lyrics = u.Lyrics
+	}
+	if *u.Link != *orig.Link {
+		changed.Link = u.Link
+	}
+	var cleared []SongField
+	if !equalPtr(u.AlbumID, orig.AlbumID) {
+		if u.AlbumID == nil {
+			cleared = append(cleared, AlbumID)
+		}
+		changed.AlbumID = u.AlbumID
+	}
+	if !equalPtr(u.DiscNumber, orig.DiscNumber) {
+		if u.DiscNumber == nil {
+			cleared = append(cleared, DiscNumber)
+		}
+		changed.DiscNumber = u.DiscNumber
+	}
+	if !equalPtr(u.TrackNumber, orig.TrackNumber) {
+		if u.TrackNumber == nil {
+			cleared = append(cleared, TrackNumber)
+		}
+		changed.TrackNumber = u.TrackNumber
+	}
+	upd, err := changed.songUpdate()
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range cleared {
+		upd[f] = nil
+	}
+	return upd, nil
+}
+
+func equalPtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
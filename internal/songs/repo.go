@@ -2,27 +2,71 @@ package songs
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"maps"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/x0k/effective-mobile-song-library-service/internal/lib/filter"
 	"github.com/x0k/effective-mobile-song-library-service/internal/lib/logger"
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/normalize"
+)
+
+var ErrSongNotFound = errors.New("song not found")
+var ErrTrackIsTaken = errors.New("track is taken")
+var ErrTrackWithoutAlbum = errors.New("track without album")
+var ErrDuplicateCredit = errors.New("duplicate credit")
+var ErrUnknownSongField = errors.New("unknown song field")
+var ErrSongVersionMismatch = errors.New("song version mismatch")
+var ErrDuplicateSong = errors.New("duplicate song")
+var ErrSongsAreNotDuplicates = errors.New("songs are not duplicates")
+
+// DuplicateSongError holds the id of the existing song
+// with the same artist and title
+type DuplicateSongError struct {
+	ID int64
+}
+
+func (e *DuplicateSongError) Error() string {
+	return fmt.Sprintf("%s, existing song id %d", ErrDuplicateSong, e.ID)
+}
+
+func (e *DuplicateSongError) Unwrap() error {
+	return ErrDuplicateSong
+}
+
+// Unique indexes of the song table
+const (
+	songAlbumTrackIndex  = "idx_song_album_track"
+	songArtistTitleIndex = "idx_song_artist_title"
 )
 
 type Repo struct {
 	log    *logger.Logger
-	conn   *pgx.Conn
+	pool   *pgxpool.Pool
 	filter *filter.Filter
 }
 
-func newRepo(log *logger.Logger, conn *pgx.Conn) *Repo {
-	return &Repo{
+// Matches songs with the artist in the given role,
+// the song artist is its primary artist
+var artistPredicate = filter.PredicateConfig{
+	Args: []filter.ValueType{filter.StringType, filter.StringType},
+	SQL:  `(($1 = 'primary' AND "artist"."name" = $2) OR EXISTS (SELECT 1 FROM song_artist JOIN artist AS credited ON credited.id = song_artist.artist_id WHERE song_artist.song_id = "song"."id" AND song_artist.role = $1 AND credited.name = $2))`,
+}
+
+func newRepo(log *logger.Logger, pool *pgxpool.Pool) *Repo {
+	r := &Repo{
 		log:  log,
-		conn: conn,
+		pool: pool,
 		filter: filter.New(
 			"song",
 			map[string]filter.ColumnConfig{
@@ -35,8 +79,34 @@ func newRepo(log *logger.Logger, conn *pgx.Conn) *Repo {
 					Type: filter.StringType,
 				},
 				"group": {
-					Name: "artist",
-					Type: filter.StringType,
+					Name:  "name",
+					Type:  filter.StringType,
+					Table: "artist",
+					Lookup: &filter.Lookup{
+						Normalize: normalize.Name,
+						SQL:       `"artist"."id" IN (SELECT artist_id FROM artist_alias WHERE key = $1)`,
+					},
+				},
+				"artistId": {
+					Name: "artist_id",
+					Type: filter.NumberType,
+				},
+				"album": {
+					Name:  "title",
+					Type:  filter.StringType,
+					Table: "album",
+				},
+				"albumId": {
+					Name: "album_id",
+					Type: filter.NumberType,
+				},
+				"discNumber": {
+					Name: "disc_number",
+					Type: filter.NumberType,
+				},
+				"trackNumber": {
+					Name: "track_number",
+					Type: filter.NumberType,
 				},
 				"releaseDate": {
 					Name: "release_date",
@@ -50,6 +120,22 @@ func newRepo(log *logger.Logger, conn *pgx.Conn) *Repo {
 					Name: "link",
 					Type: filter.StringType,
 				},
+				"verseCount": {
+					Name: "verse_count",
+					Type: filter.NumberType,
+				},
+				"lineCount": {
+					Name: "line_count",
+					Type: filter.NumberType,
+				},
+				"wordCount": {
+					Name: "word_count",
+					Type: filter.NumberType,
+				},
+				"uniqueWordCount": {
+					Name: "unique_word_count",
+					Type: filter.NumberType,
+				},
 			},
 			func(s string) (any, error) {
 				d, err := time.Parse(releaseDateFormat, s)
@@ -60,98 +146,648 @@ func newRepo(log *logger.Logger, conn *pgx.Conn) *Repo {
 			},
 		),
 	}
+	if err := r.filter.DefinePredicate("ARTIST", artistPredicate); err != nil {
+		panic(err)
+	}
+	return r
 }
 
-const saveSongQuery = `INSERT INTO song (title, artist, release_date, lyrics, link) VALUES ($1, $2, $3, $4, $5) RETURNING id;`
+const filterMacrosQuery = `SELECT name, definition FROM filter_macro`
 
-func (s *Repo) SaveSong(ctx context.Context, song *Song) error {
-	args := []any{song.Title, song.Artist, pgtype.Date{Time: song.ReleaseDate, Valid: true}, song.Lyrics, song.Link}
+// defineFilterMacros compiles the given macros together with the macros
+// stored in the database, the latter take precedence
+func (s *Repo) defineFilterMacros(ctx context.Context, macros map[string]string) error {
+	s.log.Debug(ctx, "executing query", slog.String("query", filterMacrosQuery))
+	rows, err := s.pool.Query(ctx, filterMacrosQuery)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	definitions := maps.Clone(macros)
+	if definitions == nil {
+		definitions = make(map[string]string)
+	}
+	for rows.Next() {
+		var name, definition string
+		if err := rows.Scan(&name, &definition); err != nil {
+			return err
+		}
+		definitions[name] = definition
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	s.log.Debug(ctx, "got filter macros", slog.Int("count", len(definitions)))
+	return s.filter.DefineMacros(definitions)
+}
+
+const saveSongQuery = `INSERT INTO song (title, artist_id, release_date, lyrics, link, verse_count, line_count, word_count, unique_word_count) VALUES ($1, artist_id_by_name($2, $3), $4, $5, $6, $7, $8, $9, $10) RETURNING id, artist_id, version;`
+
+func saveSongArgs(song *Song) []any {
+	return []any{
+		song.Title,
+		song.Artist,
+		normalize.Name(song.Artist),
+		pgtype.Date{Time: song.ReleaseDate, Valid: true},
+		song.Lyrics,
+		song.Link,
+		song.Stats.Verses,
+		song.Stats.Lines,
+		song.Stats.Words,
+		song.Stats.UniqueWords,
+	}
+}
+
+func (s *Repo) SaveSong(ctx context.Context, song *Song, author string) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	args := saveSongArgs(song)
 	s.log.Debug(ctx, "executing query", slog.String("query", saveSongQuery), slog.Any("args", args))
-	row := s.conn.QueryRow(ctx, saveSongQuery, args...)
-	return row.Scan(&song.ID)
+	err = tx.QueryRow(ctx, saveSongQuery, args...).Scan(&song.ID, &song.ArtistID, &song.Version)
+	if pgConstraint(err) == songArtistTitleIndex {
+		tx.Rollback(ctx)
+		return s.duplicateSong(ctx, song.Artist, song.Title, 0)
+	}
+	if err != nil {
+		return err
+	}
+	state, err := s.songState(ctx, tx, song.ID)
+	if err != nil {
+		return err
+	}
+	if err := writeRevision(ctx, s.log, tx, song.ID, song.Version, author, CreateAction, nil, state); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// SaveSongs saves the songs in one transaction with batched queries
+func (s *Repo) SaveSongs(ctx context.Context, songs []*Song, author string) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	b := &pgx.Batch{}
+	// The first song that is a duplicate
+	var duplicate *Song
+	for _, song := range songs {
+		b.Queue(saveSongQuery, saveSongArgs(song)...).QueryRow(func(row pgx.Row) error {
+			err := row.Scan(&song.ID, &song.ArtistID, &song.Version)
+			if duplicate == nil && pgConstraint(err) == songArtistTitleIndex {
+				duplicate = song
+			}
+			return err
+		})
+	}
+	s.log.Debug(ctx, "executing batch", slog.String("query", saveSongQuery), slog.Int("count", len(songs)))
+	if err := tx.SendBatch(ctx, b).Close(); err != nil {
+		if duplicate != nil {
+			tx.Rollback(ctx)
+			return s.duplicateSong(ctx, duplicate.Artist, duplicate.Title, 0)
+		}
+		return err
+	}
+	states := make([]songState, len(songs))
+	b = &pgx.Batch{}
+	for i, song := range songs {
+		b.Queue(songStateQuery, song.ID).QueryRow(func(row pgx.Row) error {
+			state, err := scanSongState(row)
+			states[i] = state
+			return err
+		})
+	}
+	s.log.Debug(ctx, "executing batch", slog.String("query", songStateQuery), slog.Int("count", len(songs)))
+	if err := tx.SendBatch(ctx, b).Close(); err != nil {
+		return err
+	}
+	b = &pgx.Batch{}
+	for i, song := range songs {
+		changes, err := stateChanges(nil, states[i])
+		if err != nil {
+			return err
+		}
+		b.Queue(saveRevisionQuery, song.ID, song.Version, author, string(CreateAction), changes)
+	}
+	s.log.Debug(ctx, "executing batch", slog.String("query", saveRevisionQuery), slog.Int("count", len(songs)))
+	if err := tx.SendBatch(ctx, b).Close(); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+const songColumns = `song.id, song.title, artist.name, song.artist_id, song.release_date, song.lyrics, song.link, song.album_id, album.title, song.disc_number, song.track_number, song.verse_count, song.line_count, song.word_count, song.unique_word_count, credits.ids, credits.names, credits.roles, song.version, song.deleted_at`
+
+// Tables that can be referenced by the filter
+const songsFilterTable = `song JOIN artist ON artist.id = song.artist_id LEFT JOIN album ON album.id = song.album_id`
+
+const songsTable = songsFilterTable +
+	` LEFT JOIN LATERAL (SELECT array_agg(song_artist.artist_id ORDER BY song_artist.position) AS ids, array_agg(credited.name ORDER BY song_artist.position) AS names, array_agg(song_artist.role ORDER BY song_artist.position) AS roles` +
+	` FROM song_artist JOIN artist AS credited ON credited.id = song_artist.artist_id WHERE song_artist.song_id = song.id) AS credits ON TRUE`
+
+// Selectable song fields in the order of songColumns,
+// names match the filter schema
+var songFields = []songField{
+	{"id", "song.id", func(r *songRow) []any { return []any{&r.song.ID} }},
+	{"song", "song.title", func(r *songRow) []any { return []any{&r.song.Title} }},
+	{"group", "artist.name", func(r *songRow) []any { return []any{&r.song.Artist} }},
+	{"artistId", "song.artist_id", func(r *songRow) []any { return []any{&r.song.ArtistID} }},
+	{"releaseDate", "song.release_date", func(r *songRow) []any { return []any{&r.releaseDate} }},
+	{"text", "song.lyrics", func(r *songRow) []any { return []any{&r.song.Lyrics} }},
+	{"link", "song.link", func(r *songRow) []any { return []any{&r.song.Link} }},
+	{"albumId", "song.album_id", func(r *songRow) []any { return []any{&r.albumId} }},
+	{"album", "album.title", func(r *songRow) []any { return []any{&r.album} }},
+	{"discNumber", "song.disc_number", func(r *songRow) []any { return []any{&r.disc} }},
+	{"trackNumber", "song.track_number", func(r *songRow) []any { return []any{&r.track} }},
+	{"verseCount", "song.verse_count", func(r *songRow) []any { return []any{&r.song.Stats.Verses} }},
+	{"lineCount", "song.line_count", func(r *songRow) []any { return []any{&r.song.Stats.Lines} }},
+	{"wordCount", "song.word_count", func(r *songRow) []any { return []any{&r.song.Stats.Words} }},
+	{"uniqueWordCount", "song.unique_word_count", func(r *songRow) []any { return []any{&r.song.Stats.UniqueWords} }},
+	// Credits are not a part of the filter schema
+	{creditsField, "credits.ids, credits.names, credits.roles", func(r *songRow) []any {
+		return []any{&r.creditIds, &r.creditNames, &r.creditRoles}
+	}},
+	// The version and the deletion time are not selectable
+	{"version", "song.version", func(r *songRow) []any { return []any{&r.song.Version} }},
+	{"deletedAt", "song.deleted_at", func(r *songRow) []any { return []any{&r.deletedAt} }},
+}
+
+const creditsField = "artists"
+
+type songField struct {
+	name    string
+	columns string
+	dest    func(r *songRow) []any
+}
+
+type songRow struct {
+	song        Song
+	releaseDate pgtype.Date
+	albumId     pgtype.Int8
+	album       pgtype.Text
+	disc, track pgtype.Int4
+	creditIds   []int64
+	creditNames []string
+	creditRoles []string
+	deletedAt   pgtype.Timestamptz
+}
+
+func (r *songRow) toSong() Song {
+	s := r.song
+	if len(r.creditIds) > 0 {
+		s.Credits = make([]Credit, len(r.creditIds))
+		for i, id := range r.creditIds {
+			s.Credits[i] = Credit{
+				ArtistID: id,
+				Artist:   r.creditNames[i],
+				Role:     ArtistRole(r.creditRoles[i]),
+			}
+		}
+	}
+	if r.releaseDate.Valid {
+		s.ReleaseDate = r.releaseDate.Time.In(time.Local)
+	}
+	if r.deletedAt.Valid {
+		s.DeletedAt = &r.deletedAt.Time
+	}
+	// Any of the track fields may be selected
+	if r.albumId.Valid || r.album.Valid || r.disc.Valid || r.track.Valid {
+		s.Track = &Track{
+			AlbumID:    r.albumId.Int64,
+			Album:      r.album.String,
+			DiscNumber: int(r.disc.Int32),
+			Number:     int(r.track.Int32),
+		}
+	}
+	return s
+}
+
+func scanSong(row pgx.Row) (Song, error) {
+	return scanSongFields(row, songFields)
+}
+
+func scanSongFields(row pgx.Row, fields []songField) (Song, error) {
+	var r songRow
+	dest := make([]any, 0, len(fields)+2)
+	for _, f := range fields {
+		dest = append(dest, f.dest(&r)...)
+	}
+	if err := row.Scan(dest...); err != nil {
+		return Song{}, err
+	}
+	return r.toSong(), nil
+}
+
+// selectSongFields resolves the requested field names, the id is always
+// selected and credits are selected together with the primary artist
+func (s *Repo) selectSongFields(names []string) ([]songField, error) {
+	if len(names) == 0 {
+		return songFields, nil
+	}
+	for _, name := range names {
+		if name != creditsField && !s.filter.HasColumn(name) {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownSongField, name)
+		}
+	}
+	withCredits := slices.Contains(names, creditsField)
+	fields := make([]songField, 0, len(names)+3)
+	for _, f := range songFields {
+		switch {
+		case f.name == "id",
+			withCredits && (f.name == "group" || f.name == "artistId"),
+			slices.Contains(names, f.name):
+			fields = append(fields, f)
+		}
+	}
+	return fields, nil
+}
+
+const songQuery = `SELECT ` + songColumns + ` FROM ` + songsTable + ` WHERE song.id = $1 AND song.deleted_at IS NULL`
+
+func (s *Repo) GetSong(ctx context.Context, id int64) (Song, error) {
+	s.log.Debug(ctx, "executing query", slog.String("query", songQuery), slog.Int64("id", id))
+	song, err := scanSong(s.pool.QueryRow(ctx, songQuery, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Song{}, ErrSongNotFound
+	}
+	return song, err
 }
 
 func (s *Repo) GetSongs(ctx context.Context, query Query) ([]Song, error) {
 	q := strings.Builder{}
 	q.Grow(100)
-	q.WriteString(`SELECT id, title, artist, release_date, lyrics, link FROM song`)
-	var args []any
-	if query.LastId != 0 {
-		q.WriteString(" WHERE id > $1")
-		args = append(args, query.LastId)
+	fields, err := s.selectSongFields(query.Fields)
+	if err != nil {
+		return nil, err
 	}
-	if query.Filter != "" {
-		expr, err := s.filter.Parse(query.Filter)
-		if err != nil {
-			return nil, err
-		}
-		if query.LastId == 0 {
-			q.WriteString(" WHERE ")
-		} else {
-			q.WriteString(" AND ")
+	q.WriteString(`SELECT `)
+	withCredits := false
+	for i, f := range fields {
+		if i > 0 {
+			q.WriteString(", ")
 		}
-		q.Grow(len(query.Filter) * 2)
-		args = expr.ToSQL(&q, args)
+		q.WriteString(f.columns)
+		withCredits = withCredits || f.name == creditsField
+	}
+	q.WriteString(` FROM `)
+	if withCredits {
+		q.WriteString(songsTable)
+	} else {
+		q.WriteString(songsFilterTable)
 	}
-	q.WriteString(" ORDER BY id ASC")
+	args, err := s.writeConditions(&q, query, nil)
+	if err != nil {
+		return nil, err
+	}
+	q.WriteString(" ORDER BY song.id ASC")
 	if query.Page > 0 {
 		q.WriteString(" OFFSET $")
 		args = append(args, (query.Page-1)*query.PageSize)
 		q.WriteString(strconv.Itoa(len(args)))
 	}
 	q.WriteString(" LIMIT $")
-	args = append(args, query.PageSize)
+	if query.Lookahead {
+		args = append(args, query.PageSize+1)
+	} else {
+		args = append(args, query.PageSize)
+	}
 	q.WriteString(strconv.Itoa(len(args)))
 	sql := q.String()
 	s.log.Debug(ctx, "executing query", slog.String("query", sql), slog.Any("args", args))
-	rows, err := s.conn.Query(ctx, q.String(), args...)
+	rows, err := s.pool.Query(ctx, q.String(), args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var songs []Song
 	for rows.Next() {
-		var s Song
-		var d pgtype.Date
-		if err := rows.Scan(&s.ID, &s.Title, &s.Artist, &d, &s.Lyrics, &s.Link); err != nil {
+		s, err := scanSongFields(rows, fields)
+		if err != nil {
 			return nil, err
 		}
-		s.ReleaseDate = d.Time.In(time.Local)
 		songs = append(songs, s)
 	}
 	s.log.Debug(ctx, "got songs", slog.Int("count", len(songs)))
 	return songs, nil
 }
 
-const lyricsQuery = `SELECT lyrics[$1:$2] AS paginated FROM song WHERE id = $3`
+// CountSongs returns the number of songs matching the filter of the query,
+// pagination is ignored
+func (s *Repo) CountSongs(ctx context.Context, query Query) (int64, error) {
+	q := strings.Builder{}
+	q.Grow(100)
+	q.WriteString(`SELECT count(*) FROM ` + songsFilterTable)
+	query.LastId = 0
+	args, err := s.writeConditions(&q, query, nil)
+	if err != nil {
+		return 0, err
+	}
+	sql := q.String()
+	s.log.Debug(ctx, "executing query", slog.String("query", sql), slog.Any("args", args))
+	var count int64
+	if err := s.pool.QueryRow(ctx, sql, args...).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+const exportFetchQuery = `FETCH FORWARD 100 FROM export_songs`
+
+// ExportSongs passes songs matching the filter of the query to the yield
+// function in the order of their ids. Songs are read from a server-side
+// cursor, so the whole result is never kept in memory. The cursor holds
+// its own connection until the export is done, so slow consumers don't
+// block other queries.
+// Pagination is ignored, the export stops at the first yield error.
+func (s *Repo) ExportSongs(ctx context.Context, query Query, yield func(Song) error) error {
+	q := strings.Builder{}
+	q.Grow(100)
+	q.WriteString(`DECLARE export_songs NO SCROLL CURSOR FOR SELECT ` + songColumns + ` FROM ` + songsTable)
+	args, err := s.writeConditions(&q, query, nil)
+	if err != nil {
+		return err
+	}
+	q.WriteString(" ORDER BY song.id ASC")
+	conn, err := s.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	tx, err := conn.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	sql := q.String()
+	s.log.Debug(ctx, "executing query", slog.String("query", sql), slog.Any("args", args))
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		return err
+	}
+	for {
+		rows, err := tx.Query(ctx, exportFetchQuery)
+		if err != nil {
+			return err
+		}
+		songs, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Song, error) {
+			return scanSong(row)
+		})
+		if err != nil {
+			return err
+		}
+		if len(songs) == 0 {
+			break
+		}
+		for _, song := range songs {
+			if err := yield(song); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+func (s *Repo) writeConditions(q *strings.Builder, query Query, args []any) ([]any, error) {
+	if query.Deleted {
+		q.WriteString(" WHERE song.deleted_at IS NOT NULL")
+	} else {
+		q.WriteString(" WHERE song.deleted_at IS NULL")
+	}
+	if query.LastId != 0 {
+		args = append(args, query.LastId)
+		q.WriteString(" AND song.id > $")
+		q.WriteString(strconv.Itoa(len(args)))
+	}
+	expr, err := s.parseFilter(query)
+	if err != nil {
+		return nil, err
+	}
+	if expr != nil {
+		q.WriteString(" AND ")
+		q.Grow(len(query.Filter) * 2)
+		args = expr.ToSQL(q, args)
+	}
+	return args, nil
+}
+
+func (s *Repo) parseFilter(query Query) (filter.Expr, error) {
+	var expr filter.Expr
+	if query.Filter != "" {
+		var err error
+		if expr, err = s.filter.Parse(query.Filter); err != nil {
+			return nil, err
+		}
+	}
+	paramsExpr, err := s.filter.ParseQuery(query.FilterParams)
+	if err != nil {
+		return nil, err
+	}
+	return filter.AllOf(expr, paramsExpr), nil
+}
+
+const lyricsQuery = `SELECT lyrics[$1:$2] AS paginated FROM song WHERE id = $3 AND deleted_at IS NULL`
 
 func (s *Repo) GetLyrics(ctx context.Context, id int64, pagination Pagination) ([]string, error) {
 	args := []any{pagination.Page, pagination.Page + pagination.PageSize - 1, id}
 	s.log.Debug(ctx, "executing query", slog.String("query", lyricsQuery), slog.Any("args", args))
-	row := s.conn.QueryRow(ctx, lyricsQuery, args...)
+	row := s.pool.QueryRow(ctx, lyricsQuery, args...)
 	var lyrics []string
-	err := row.Scan(&lyrics)
+	if err := row.Scan(&lyrics); errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrSongNotFound
+	} else if err != nil {
+		return nil, err
+	}
 	s.log.Debug(ctx, "got lyrics", slog.Int("count", len(lyrics)))
-	return lyrics, err
+	return lyrics, nil
 }
 
-const deleteSongQuery = `DELETE FROM song WHERE id = $1`
+const deleteSongQuery = `UPDATE song SET deleted_at = now() WHERE id = $1 AND deleted_at IS NULL`
 
-func (s *Repo) DeleteSong(ctx context.Context, id int64) error {
-	s.log.Debug(ctx, "executing query", slog.String("query", deleteSongQuery), slog.Int64("id", id))
-	_, err := s.conn.Exec(ctx, deleteSongQuery, id)
-	return err
+// DeleteSong moves the song to the trash, if the version is not zero
+// the song is deleted only if it has the given version
+func (s *Repo) DeleteSong(ctx context.Context, id int64, version int64, author string) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	q := deleteSongQuery
+	args := []any{id}
+	if version != 0 {
+		q += ` AND version = $2`
+		args = append(args, version)
+	}
+	q += ` RETURNING version, deleted_at`
+	s.log.Debug(ctx, "executing query", slog.String("query", q), slog.Any("args", args))
+	var deletedAt time.Time
+	err = tx.QueryRow(ctx, q, args...).Scan(&version, &deletedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return s.songNotAffected(ctx, id, version)
+	}
+	if err != nil {
+		return err
+	}
+	if err := writeRevision(ctx, s.log, tx, id, version, author, DeleteAction, nil, songState{DeletedAt: deletedAt}); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+const songExistsQuery = `SELECT EXISTS (SELECT 1 FROM song WHERE id = $1 AND deleted_at IS NULL)`
+
+// songNotAffected explains why the conditional statement
+// has not affected the song
+func (s *Repo) songNotAffected(ctx context.Context, id int64, version int64) error {
+	if version == 0 {
+		return ErrSongNotFound
+	}
+	s.log.Debug(ctx, "executing query", slog.String("query", songExistsQuery), slog.Int64("id", id))
+	var exists bool
+	if err := s.pool.QueryRow(ctx, songExistsQuery, id).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrSongNotFound
+	}
+	return ErrSongVersionMismatch
+}
+
+const deletedSongQuery = `SELECT song.deleted_at, song.title, artist.name FROM song JOIN artist ON artist.id = song.artist_id WHERE song.id = $1 AND song.deleted_at IS NOT NULL FOR UPDATE OF song`
+
+const restoreSongQuery = `UPDATE song SET deleted_at = NULL WHERE id = $1 RETURNING version`
+
+// RestoreSong moves the song out of the trash
+func (s *Repo) RestoreSong(ctx context.Context, id int64, author string) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	s.log.Debug(ctx, "executing query", slog.String("query", deletedSongQuery), slog.Int64("id", id))
+	var deletedAt time.Time
+	var title, artist string
+	if err := tx.QueryRow(ctx, deletedSongQuery, id).Scan(&deletedAt, &title, &artist); errors.Is(err, pgx.ErrNoRows) {
+		return ErrSongNotFound
+	} else if err != nil {
+		return err
+	}
+	s.log.Debug(ctx, "executing query", slog.String("query", restoreSongQuery), slog.Int64("id", id))
+	var version int64
+	err = tx.QueryRow(ctx, restoreSongQuery, id).Scan(&version)
+	switch pgConstraint(err) {
+	case songAlbumTrackIndex:
+		return ErrTrackIsTaken
+	case songArtistTitleIndex:
+		tx.Rollback(ctx)
+		return s.duplicateSong(ctx, artist, title, id)
+	}
+	if err != nil {
+		return err
+	}
+	if err := writeRevision(ctx, s.log, tx, id, version, author, RestoreAction, songState{DeletedAt: deletedAt}, nil); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+const purgeSongsQuery = `DELETE FROM song WHERE deleted_at < $1`
+
+// PurgeSongs permanently deletes songs moved to the trash before the given time
+func (s *Repo) PurgeSongs(ctx context.Context, before time.Time) (int64, error) {
+	s.log.Debug(ctx, "executing query", slog.String("query", purgeSongsQuery), slog.Time("before", before))
+	tag, err := s.pool.Exec(ctx, purgeSongsQuery, before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
 }
 
 var songFieldToColumn = map[SongField]string{
-	Title:       "title",
-	Artist:      "artist",
-	ReleaseDate: "release_date",
-	Lyrics:      "lyrics",
-	Link:        "link",
+	Title:           "title",
+	Group:           "artist_id",
+	ReleaseDate:     "release_date",
+	Lyrics:          "lyrics",
+	Link:            "link",
+	AlbumID:         "album_id",
+	DiscNumber:      "disc_number",
+	TrackNumber:     "track_number",
+	VerseCount:      "verse_count",
+	LineCount:       "line_count",
+	WordCount:       "word_count",
+	UniqueWordCount: "unique_word_count",
+	LineTimes:       "lyrics_times",
+}
+
+// UpdateSong updates the song and returns its new version, if the version
+// is not zero the song is updated only if it has the given version
+func (s *Repo) UpdateSong(ctx context.Context, id int64, version int64, upd SongUpdate, author string) (int64, error) {
+	return s.updateSong(ctx, id, version, upd, author, UpdateAction)
+}
+
+// RevertSong is the same as UpdateSong,
+// but the change is recorded as a revert
+func (s *Repo) RevertSong(ctx context.Context, id int64, version int64, upd SongUpdate, author string) (int64, error) {
+	return s.updateSong(ctx, id, version, upd, author, RevertAction)
+}
+
+func (s *Repo) updateSong(
+	ctx context.Context,
+	id int64,
+	version int64,
+	upd SongUpdate,
+	author string,
+	action RevisionAction,
+) (int64, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+	newVersion, err := s.updateSongTx(ctx, tx, id, version, upd, author, action)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return newVersion, nil
 }
 
-func (s *Repo) UpdateSong(ctx context.Context, id int64, upd SongUpdate) error {
+const artistIdByNameQuery = `SELECT artist_id_by_name($1, $2)`
+
+// updateSongTx updates the song and records the revision in the transaction,
+// the transaction is rolled back if the song becomes a duplicate
+func (s *Repo) updateSongTx(
+	ctx context.Context,
+	tx pgx.Tx,
+	id int64,
+	version int64,
+	upd SongUpdate,
+	author string,
+	action RevisionAction,
+) (int64, error) {
+	before, err := s.songState(ctx, tx, id)
+	if err != nil {
+		return 0, err
+	}
+	// The artist is resolved only for the locked song, so missing songs
+	// don't create artists
+	var artistId int64
+	if artist, ok := upd[Group]; ok {
+		args := []any{artist, normalize.Name(artist.(string))}
+		s.log.Debug(ctx, "executing query", slog.String("query", artistIdByNameQuery), slog.Any("args", args))
+		if err := tx.QueryRow(ctx, artistIdByNameQuery, args...).Scan(&artistId); err != nil {
+			return 0, err
+		}
+	}
+	// Line times belong to the replaced lyrics
+	if _, ok := upd[Lyrics]; ok {
+		if _, ok := upd[LineTimes]; !ok {
+			upd[LineTimes] = nil
+		}
+	}
 	q := strings.Builder{}
 	q.Grow(100)
 	q.WriteString("UPDATE song SET ")
@@ -164,7 +800,9 @@ func (s *Repo) UpdateSong(ctx context.Context, id int64, upd SongUpdate) error {
 		i++
 		q.WriteString(songFieldToColumn[f])
 		q.WriteString(" = $")
-		if f == ReleaseDate {
+		if f == Group {
+			args = append(args, artistId)
+		} else if f == ReleaseDate {
 			args = append(args, pgtype.Date{Time: v.(time.Time), Valid: true})
 		} else {
 			args = append(args, v)
@@ -174,7 +812,248 @@ func (s *Repo) UpdateSong(ctx context.Context, id int64, upd SongUpdate) error {
 	q.WriteString(" WHERE id = $")
 	args = append(args, id)
 	q.WriteString(strconv.Itoa(len(args)))
+	if version != 0 {
+		q.WriteString(" AND version = $")
+		args = append(args, version)
+		q.WriteString(strconv.Itoa(len(args)))
+	}
+	q.WriteString(" RETURNING version")
 	s.log.Debug(ctx, "executing query", slog.String("query", q.String()), slog.Any("args", args))
-	_, err := s.conn.Exec(ctx, q.String(), args...)
-	return err
+	var newVersion int64
+	err = tx.QueryRow(ctx, q.String(), args...).Scan(&newVersion)
+	switch pgErrorCode(err) {
+	case pgerrcode.ForeignKeyViolation:
+		return 0, ErrAlbumNotFound
+	case pgerrcode.UniqueViolation:
+		if pgConstraint(err) == songArtistTitleIndex {
+			tx.Rollback(ctx)
+			return 0, s.duplicateSong(ctx, updatedValue(upd, before, Group), updatedValue(upd, before, Title), id)
+		}
+		return 0, ErrTrackIsTaken
+	case pgerrcode.CheckViolation:
+		return 0, ErrTrackWithoutAlbum
+	}
+	// The song is locked, so only the version can mismatch
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrSongVersionMismatch
+	}
+	if err != nil {
+		return 0, err
+	}
+	after, err := s.songState(ctx, tx, id)
+	if err != nil {
+		return 0, err
+	}
+	if err := writeRevision(ctx, s.log, tx, id, newVersion, author, action, before, after); err != nil {
+		return 0, err
+	}
+	return newVersion, nil
+}
+
+const mergeCreditsQuery = `INSERT INTO song_artist (song_id, artist_id, role, position)` +
+	` SELECT $1, source.artist_id, source.role, (SELECT coalesce(max(position), 0) FROM song_artist WHERE song_id = $1) + row_number() OVER (ORDER BY source.position)` +
+	` FROM song_artist AS source WHERE source.song_id = $2 ON CONFLICT DO NOTHING`
+
+// The merged song may be in the trash, where the duplicates are usually found
+const mergedSongStateQuery = `SELECT song.deleted_at IS NOT NULL, song.verse_count, song.line_count, song.word_count, song.unique_word_count, ` + songStateColumns + ` FROM song JOIN artist ON artist.id = song.artist_id WHERE song.id = $1 FOR UPDATE OF song`
+
+const mergedSongsQuery = `SELECT target.version, target.artist_id = source.artist_id AND song_title_key(target.title) = song_title_key(source.title) FROM song AS target, song AS source WHERE target.id = $1 AND source.id = $2`
+
+// MergeSongs moves the source song to the trash (unless it is there already),
+// adds its credits to the target song and fills the missing values of the
+// target song (lyrics, link and album track) with the source values.
+// The songs must have the same artist and title key.
+// The lyrics statistics are copied together with the lyrics.
+// Returns the new version of the target song.
+func (s *Repo) MergeSongs(ctx context.Context, targetId int64, version int64, sourceId int64, author string) (int64, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+	target, err := s.songState(ctx, tx, targetId)
+	if err != nil {
+		return 0, err
+	}
+	s.log.Debug(ctx, "executing query", slog.String("query", mergedSongStateQuery), slog.Int64("id", sourceId))
+	var trashed bool
+	var stats LyricsStats
+	source, err := scanSongState(
+		tx.QueryRow(ctx, mergedSongStateQuery, sourceId),
+		&trashed, &stats.Verses, &stats.Lines, &stats.Words, &stats.UniqueWords,
+	)
+	if err != nil {
+		return 0, err
+	}
+	args := []any{targetId, sourceId}
+	s.log.Debug(ctx, "executing query", slog.String("query", mergedSongsQuery), slog.Any("args", args))
+	var targetVersion int64
+	var duplicates bool
+	if err := tx.QueryRow(ctx, mergedSongsQuery, args...).Scan(&targetVersion, &duplicates); err != nil {
+		return 0, err
+	}
+	if version != 0 && version != targetVersion {
+		return 0, ErrSongVersionMismatch
+	}
+	if !duplicates {
+		return 0, ErrSongsAreNotDuplicates
+	}
+	if !trashed {
+		q := deleteSongQuery + ` RETURNING version, deleted_at`
+		s.log.Debug(ctx, "executing query", slog.String("query", q), slog.Int64("id", sourceId))
+		var sourceVersion int64
+		var deletedAt time.Time
+		if err := tx.QueryRow(ctx, q, sourceId).Scan(&sourceVersion, &deletedAt); err != nil {
+			return 0, err
+		}
+		if err := writeRevision(ctx, s.log, tx, sourceId, sourceVersion, author, DeleteAction, nil, songState{DeletedAt: deletedAt}); err != nil {
+			return 0, err
+		}
+	}
+	s.log.Debug(ctx, "executing query", slog.String("query", mergeCreditsQuery), slog.Any("args", args))
+	if _, err := tx.Exec(ctx, mergeCreditsQuery, args...); err != nil {
+		return 0, err
+	}
+	if upd := missingValues(target, source, stats); len(upd) > 0 {
+		// The source track is released by the deletion
+		if targetVersion, err = s.updateSongTx(ctx, tx, targetId, targetVersion, upd, author, UpdateAction); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return targetVersion, nil
+}
+
+// missingValues returns the source values of the fields
+// that are empty in the target state, the lyrics are taken
+// with their line times and statistics
+func missingValues(target, source songState, stats LyricsStats) SongUpdate {
+	upd := SongUpdate{}
+	if lyrics := source[Lyrics].([]string); len(target[Lyrics].([]string)) == 0 && len(lyrics) > 0 {
+		upd[Lyrics] = lyrics
+		if times, ok := source[LineTimes]; ok {
+			upd[LineTimes] = times
+		}
+		upd[VerseCount] = stats.Verses
+		upd[LineCount] = stats.Lines
+		upd[WordCount] = stats.Words
+		upd[UniqueWordCount] = stats.UniqueWords
+	}
+	if link := source[Link].(string); target[Link] == "" && link != "" {
+		upd[Link] = link
+	}
+	if _, ok := target[AlbumID]; !ok {
+		for _, f := range []SongField{AlbumID, DiscNumber, TrackNumber} {
+			if v, ok := source[f]; ok {
+				upd[f] = v
+			}
+		}
+	}
+	return upd
+}
+
+const findArtistQuery = `SELECT artist.id, artist.name FROM artist_alias JOIN artist ON artist.id = artist_alias.artist_id WHERE artist_alias.key = $1`
+
+// FindArtist finds the artist by any of its aliases
+func (s *Repo) FindArtist(ctx context.Context, name string) (Artist, error) {
+	key := normalize.Name(name)
+	s.log.Debug(ctx, "executing query", slog.String("query", findArtistQuery), slog.String("key", key))
+	var a Artist
+	err := s.pool.QueryRow(ctx, findArtistQuery, key).Scan(&a.ID, &a.Name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Artist{}, ErrArtistNotFound
+	}
+	return a, err
+}
+
+const lockSongQuery = `SELECT id FROM song WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`
+
+const deleteCreditsQuery = `DELETE FROM song_artist WHERE song_id = $1`
+
+const insertCreditsQuery = `INSERT INTO song_artist (song_id, artist_id, role, position)` +
+	` SELECT $1, artist_id_by_name(c.name, c.key), c.role, c.position FROM unnest($2::text[], $3::text[], $4::text[]) WITH ORDINALITY AS c (name, key, role, position)`
+
+// SetCredits replaces additional artists of the song
+func (s *Repo) SetCredits(ctx context.Context, id int64, credits []Credit) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	s.log.Debug(ctx, "executing query", slog.String("query", lockSongQuery), slog.Int64("id", id))
+	if err := tx.QueryRow(ctx, lockSongQuery, id).Scan(&id); errors.Is(err, pgx.ErrNoRows) {
+		return ErrSongNotFound
+	} else if err != nil {
+		return err
+	}
+	s.log.Debug(ctx, "executing query", slog.String("query", deleteCreditsQuery), slog.Int64("id", id))
+	if _, err := tx.Exec(ctx, deleteCreditsQuery, id); err != nil {
+		return err
+	}
+	if len(credits) > 0 {
+		names := make([]string, len(credits))
+		keys := make([]string, len(credits))
+		roles := make([]string, len(credits))
+		for i, c := range credits {
+			names[i] = c.Artist
+			keys[i] = normalize.Name(c.Artist)
+			roles[i] = string(c.Role)
+		}
+		args := []any{id, names, keys, roles}
+		s.log.Debug(ctx, "executing query", slog.String("query", insertCreditsQuery), slog.Any("args", args))
+		_, err := tx.Exec(ctx, insertCreditsQuery, args...)
+		if pgErrorCode(err) == pgerrcode.UniqueViolation {
+			return ErrDuplicateCredit
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+const duplicateSongQuery = `SELECT song.id FROM song JOIN artist_alias ON artist_alias.artist_id = song.artist_id WHERE artist_alias.key = $1 AND song_title_key(song.title) = song_title_key($2) AND song.id <> $3 AND song.deleted_at IS NULL`
+
+// duplicateSong finds the existing song with the same artist and title
+// as the song that violates the uniqueness, the song itself is excluded
+func (s *Repo) duplicateSong(ctx context.Context, artist string, title string, id int64) error {
+	args := []any{normalize.Name(artist), title, id}
+	s.log.Debug(ctx, "executing query", slog.String("query", duplicateSongQuery), slog.Any("args", args))
+	var existing int64
+	err := s.pool.QueryRow(ctx, duplicateSongQuery, args...).Scan(&existing)
+	// The existing song is deleted in the meantime
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrDuplicateSong
+	}
+	if err != nil {
+		return err
+	}
+	return &DuplicateSongError{ID: existing}
+}
+
+// updatedValue returns the new string value of the field
+func updatedValue(upd SongUpdate, before songState, f SongField) string {
+	if v, ok := upd[f]; ok {
+		return v.(string)
+	}
+	return before[f].(string)
+}
+
+func pgErrorCode(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code
+	}
+	return ""
+}
+
+// pgConstraint returns the name of the violated constraint
+func pgConstraint(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.ConstraintName
+	}
+	return ""
 }
@@ -27,17 +27,20 @@ func TestRepo_SaveSong(t *testing.T) {
 		Lyrics:      []string{"lyrics"},
 		Link:        "link",
 	}
-	err := repo.SaveSong(ctx, &song)
+	err := repo.SaveSong(ctx, &song, "")
 	if err != nil {
 		t.Fatal(err)
 	}
 	if song.ID == -1 {
 		t.Fatal("song.ID == -1")
 	}
-	row := pgx.QueryRow(ctx, "select * from song where id = $1", song.ID)
+	if song.ArtistID == -1 {
+		t.Fatal("song.ArtistID == -1")
+	}
+	row := pgx.QueryRow(ctx, "select song.id, song.title, artist.name, song.artist_id, song.release_date, song.lyrics, song.link from song join artist on artist.id = song.artist_id where song.id = $1", song.ID)
 	var savedSong Song
 	var d pgtype.Date
-	if err := row.Scan(&savedSong.ID, &savedSong.Title, &savedSong.Artist, &d, &savedSong.Lyrics, &savedSong.Link); err != nil {
+	if err := row.Scan(&savedSong.ID, &savedSong.Title, &savedSong.Artist, &savedSong.ArtistID, &d, &savedSong.Lyrics, &savedSong.Link); err != nil {
 		t.Fatal(err)
 	}
 	savedSong.ReleaseDate = d.Time.In(time.Local)
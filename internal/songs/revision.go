@@ -0,0 +1,48 @@
+package songs
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type RevisionAction string
+
+const (
+	CreateAction  RevisionAction = "create"
+	UpdateAction  RevisionAction = "update"
+	DeleteAction  RevisionAction = "delete"
+	RestoreAction RevisionAction = "restore"
+	RevertAction  RevisionAction = "revert"
+)
+
+// FieldChange holds JSON representations of the field values,
+// absent values are represented as `null`
+type FieldChange struct {
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// SongRevision is a change of the song, the revision
+// is the song version after the change
+type SongRevision struct {
+	SongID    int64
+	Revision  int64
+	Author    string
+	Action    RevisionAction
+	CreatedAt time.Time
+	Changes   map[SongField]FieldChange
+}
+
+// Fields of the song tracked by revisions and restored by revert,
+// credits are not a part of the song history
+var revisionFields = []SongField{
+	Title,
+	Group,
+	ReleaseDate,
+	Lyrics,
+	Link,
+	AlbumID,
+	DiscNumber,
+	TrackNumber,
+	LineTimes,
+}
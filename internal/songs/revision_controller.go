@@ -0,0 +1,245 @@
+package songs
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/diff"
+)
+
+type revisionDTO struct {
+	Revision  int64     `json:"revision"`
+	Author    string    `json:"author"`
+	Action    string    `json:"action"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Names of the changed fields
+	Fields []string `json:"fields"`
+}
+
+type revisionDiffDTO struct {
+	Revision  int64                     `json:"revision"`
+	Author    string                    `json:"author"`
+	Action    string                    `json:"action"`
+	CreatedAt time.Time                 `json:"createdAt"`
+	Changes   map[string]fieldChangeDTO `json:"changes"`
+	// Verse level diff of the lyrics, present if the lyrics are changed
+	TextDiff []verseEditDTO `json:"textDiff,omitempty"`
+}
+
+type fieldChangeDTO struct {
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+type verseEditDTO struct {
+	// One of `equal`, `insert` or `delete`
+	Op string `json:"op"`
+	// Zero based index of the verse in the lyrics before the change
+	OldIndex *int `json:"oldIndex,omitempty"`
+	// Zero based index of the verse in the lyrics after the change
+	NewIndex *int   `json:"newIndex,omitempty"`
+	Text     string `json:"text"`
+}
+
+func toRevisionDTO(r SongRevision) revisionDTO {
+	dto := revisionDTO{
+		Revision:  r.Revision,
+		Author:    r.Author,
+		Action:    string(r.Action),
+		CreatedAt: r.CreatedAt,
+		Fields:    make([]string, 0, len(r.Changes)),
+	}
+	// Fields are listed in a stable order
+	for _, f := range revisionFields {
+		if _, ok := r.Changes[f]; ok {
+			dto.Fields = append(dto.Fields, string(f))
+		}
+	}
+	if _, ok := r.Changes[DeletedAt]; ok {
+		dto.Fields = append(dto.Fields, string(DeletedAt))
+	}
+	return dto
+}
+
+func toRevisionDiffDTO(r SongRevision) (revisionDiffDTO, error) {
+	dto := revisionDiffDTO{
+		Revision:  r.Revision,
+		Author:    r.Author,
+		Action:    string(r.Action),
+		CreatedAt: r.CreatedAt,
+		Changes:   make(map[string]fieldChangeDTO, len(r.Changes)),
+	}
+	for f, c := range r.Changes {
+		dto.Changes[string(f)] = fieldChangeDTO{
+			Before: c.Before,
+			After:  c.After,
+		}
+	}
+	c, ok := r.Changes[Lyrics]
+	if !ok {
+		return dto, nil
+	}
+	var before, after []string
+	if err := json.Unmarshal(c.Before, &before); err != nil {
+		return revisionDiffDTO{}, err
+	}
+	if err := json.Unmarshal(c.After, &after); err != nil {
+		return revisionDiffDTO{}, err
+	}
+	edits := diff.Slices(before, after)
+	dto.TextDiff = make([]verseEditDTO, len(edits))
+	for i, e := range edits {
+		dto.TextDiff[i] = verseEditDTO{
+			Op:   e.Op.String(),
+			Text: e.Value,
+		}
+		if e.Old >= 0 {
+			dto.TextDiff[i].OldIndex = &e.Old
+		}
+		if e.New >= 0 {
+			dto.TextDiff[i].NewIndex = &e.New
+		}
+	}
+	return dto, nil
+}
+
+func (c *songsController) parseRevision(r *http.Request) (int64, error) {
+	return c.parsePathId(r, "revision")
+}
+
+// GetRevisions godoc
+// @Summary      Get song revisions
+// @Description  Revisions are song versions after create, update, delete,
+// @Description  restore and revert operations.
+// @Tags         songs
+// @Produce      json
+// @Param        songId   path   int64   true   "Song id"
+// @Success      200  {array}   revisionDTO
+// @Failure      400  {string}  string
+// @Failure      404  {string}  string
+// @Failure      500  {string}  string
+// @Router       /songs/{songId}/revisions [get]
+func (c *songsController) GetRevisions(w http.ResponseWriter, r *http.Request) {
+	songId, err := c.parseSongId(r)
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	revisions, err := c.songsService.GetRevisions(r.Context(), songId)
+	if errors.Is(err, ErrSongNotFound) {
+		c.notFound(w, r, err)
+		return
+	}
+	if err != nil {
+		c.serverError(w, r, err, "failed to get revisions")
+		return
+	}
+	dtos := make([]revisionDTO, len(revisions))
+	for i, rev := range revisions {
+		dtos[i] = toRevisionDTO(rev)
+	}
+	c.json(w, r, dtos, http.StatusOK)
+}
+
+// GetRevision godoc
+// @Summary      Get song revision
+// @Description  Returns before and after values of the changed fields
+// @Description  and the verse level diff of the lyrics.
+// @Tags         songs
+// @Produce      json
+// @Param        songId   path   int64   true   "Song id"
+// @Param        revision path   int64   true   "Revision"
+// @Success      200  {object}  revisionDiffDTO
+// @Failure      400  {string}  string
+// @Failure      404  {string}  string
+// @Failure      500  {string}  string
+// @Router       /songs/{songId}/revisions/{revision} [get]
+func (c *songsController) GetRevision(w http.ResponseWriter, r *http.Request) {
+	songId, err := c.parseSongId(r)
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	revision, err := c.parseRevision(r)
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	rev, err := c.songsService.GetRevision(r.Context(), songId, revision)
+	if errors.Is(err, ErrRevisionNotFound) {
+		c.notFound(w, r, err)
+		return
+	}
+	if err != nil {
+		c.serverError(w, r, err, "failed to get revision")
+		return
+	}
+	dto, err := toRevisionDiffDTO(rev)
+	if err != nil {
+		c.serverError(w, r, err, "failed to diff revision")
+		return
+	}
+	c.json(w, r, dto, http.StatusOK)
+}
+
+// RevertSong godoc
+// @Summary      Revert song
+// @Description  Restores fields of the song to their values at the given revision,
+// @Description  the revert is recorded as a new revision.
+// @Tags         songs
+// @Param        songId   path   int64   true   "Song id"
+// @Param        revision path   int64   true   "Revision"
+// @Param        If-Match header string  false  "Song version"
+// @Param        X-Author header string  false  "Author of the change"
+// @Success      204  {string}  string
+// @Header       204  {string}  ETag  "New song version"
+// @Failure      400  {string}  string
+// @Failure      404  {string}  string
+// @Failure      409  {string}  string
+// @Failure      412  {string}  string
+// @Failure      500  {string}  string
+// @Router       /songs/{songId}/revisions/{revision}/revert [post]
+func (c *songsController) RevertSong(w http.ResponseWriter, r *http.Request) {
+	songId, err := c.parseSongId(r)
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	revision, err := c.parseRevision(r)
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	version, err := c.ifMatchVersion(r, songId)
+	if err != nil {
+		c.ifMatchFailed(w, r, err)
+		return
+	}
+	author, err := c.parseAuthor(r)
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	version, err = c.songsService.RevertSong(r.Context(), songId, revision, version, author)
+	if errors.Is(err, ErrSongNotFound) || errors.Is(err, ErrRevisionNotFound) {
+		c.notFound(w, r, err)
+		return
+	} else if errors.Is(err, ErrSongVersionMismatch) {
+		c.preconditionFailed(w, r, err)
+		return
+	} else if errors.Is(err, ErrDuplicateSong) {
+		c.duplicateSong(w, r, err)
+		return
+	} else if errors.Is(err, ErrAlbumNotFound) || errors.Is(err, ErrTrackIsTaken) {
+		// The album may be deleted or the track may be taken after the revision
+		c.conflict(w, r, err)
+		return
+	} else if err != nil {
+		c.serverError(w, r, err, "failed to revert song")
+		return
+	}
+	w.Header().Set("ETag", songETag(version))
+	w.WriteHeader(http.StatusNoContent)
+}
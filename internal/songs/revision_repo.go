@@ -0,0 +1,245 @@
+package songs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/logger"
+)
+
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// songState maps revision fields to their values,
+// absent values are omitted
+type songState map[SongField]any
+
+const songStateColumns = `song.title, artist.name, song.release_date, song.lyrics, song.link, song.album_id, song.disc_number, song.track_number, song.lyrics_times`
+
+const songStateQuery = `SELECT ` + songStateColumns + ` FROM song JOIN artist ON artist.id = song.artist_id WHERE song.id = $1 AND song.deleted_at IS NULL FOR UPDATE OF song`
+
+// songState locks the song and returns its current state
+func (s *Repo) songState(ctx context.Context, tx pgx.Tx, id int64) (songState, error) {
+	s.log.Debug(ctx, "executing query", slog.String("query", songStateQuery), slog.Int64("id", id))
+	return scanSongState(tx.QueryRow(ctx, songStateQuery, id))
+}
+
+// scanSongState scans songStateColumns preceded by the dest columns
+func scanSongState(row pgx.Row, dest ...any) (songState, error) {
+	var title, artist, link string
+	var releaseDate pgtype.Date
+	var lyrics []string
+	var albumId pgtype.Int8
+	var disc, track pgtype.Int4
+	var times []int32
+	err := row.Scan(append(dest, &title, &artist, &releaseDate, &lyrics, &link, &albumId, &disc, &track, &times)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrSongNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := songState{
+		Title:       title,
+		Group:       artist,
+		ReleaseDate: releaseDate.Time.Format(releaseDateFormat),
+		Lyrics:      lyrics,
+		Link:        link,
+	}
+	if albumId.Valid {
+		state[AlbumID] = albumId.Int64
+	}
+	if disc.Valid {
+		state[DiscNumber] = disc.Int32
+	}
+	if track.Valid {
+		state[TrackNumber] = track.Int32
+	}
+	if times != nil {
+		state[LineTimes] = times
+	}
+	return state, nil
+}
+
+// stateChanges compares JSON representations of the states
+func stateChanges(before, after songState) (map[SongField]FieldChange, error) {
+	changes := make(map[SongField]FieldChange, len(after))
+	for _, f := range revisionFields {
+		b, err := json.Marshal(before[f])
+		if err != nil {
+			return nil, err
+		}
+		a, err := json.Marshal(after[f])
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(b, a) {
+			changes[f] = FieldChange{Before: b, After: a}
+		}
+	}
+	return changes, nil
+}
+
+const saveRevisionQuery = `INSERT INTO song_revision (song_id, revision, author, action, changes) VALUES ($1, $2, $3, $4, $5)`
+
+func saveRevision(
+	ctx context.Context,
+	log *logger.Logger,
+	tx pgx.Tx,
+	revision SongRevision,
+) error {
+	args := []any{revision.SongID, revision.Revision, revision.Author, string(revision.Action), revision.Changes}
+	log.Debug(ctx, "executing query", slog.String("query", saveRevisionQuery), slog.Any("args", args))
+	_, err := tx.Exec(ctx, saveRevisionQuery, args...)
+	return err
+}
+
+// writeRevision saves changes between the states as a song revision
+func writeRevision(
+	ctx context.Context,
+	log *logger.Logger,
+	tx pgx.Tx,
+	id int64,
+	revision int64,
+	author string,
+	action RevisionAction,
+	before songState,
+	after songState,
+) error {
+	changes, err := stateChanges(before, after)
+	if err != nil {
+		return err
+	}
+	return saveRevision(ctx, log, tx, SongRevision{
+		SongID:   id,
+		Revision: revision,
+		Author:   author,
+		Action:   action,
+		Changes:  changes,
+	})
+}
+
+const songsStatesQuery = `SELECT song.version, ` + songStateColumns + ` FROM song JOIN artist ON artist.id = song.artist_id WHERE song.id = ANY($1) ORDER BY song.id`
+
+// songsStates returns versions and states of the songs including trashed ones,
+// ids must be sorted
+func songsStates(ctx context.Context, log *logger.Logger, tx pgx.Tx, ids []int64) ([]int64, []songState, error) {
+	log.Debug(ctx, "executing query", slog.String("query", songsStatesQuery), slog.Any("ids", ids))
+	rows, err := tx.Query(ctx, songsStatesQuery, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	versions := make([]int64, 0, len(ids))
+	states := make([]songState, 0, len(ids))
+	for rows.Next() {
+		var version int64
+		state, err := scanSongState(rows, &version)
+		if err != nil {
+			return nil, nil, err
+		}
+		versions = append(versions, version)
+		states = append(states, state)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(states) != len(ids) {
+		return nil, nil, ErrSongNotFound
+	}
+	return versions, states, nil
+}
+
+// recordRevisions saves update revisions of the songs changed by the write
+// outside of the songs repo (album deletion, artists merge),
+// the songs must be locked by the transaction
+func recordRevisions(
+	ctx context.Context,
+	log *logger.Logger,
+	tx pgx.Tx,
+	ids []int64,
+	write func() error,
+) error {
+	if len(ids) == 0 {
+		return write()
+	}
+	_, before, err := songsStates(ctx, log, tx, ids)
+	if err != nil {
+		return err
+	}
+	if err := write(); err != nil {
+		return err
+	}
+	versions, after, err := songsStates(ctx, log, tx, ids)
+	if err != nil {
+		return err
+	}
+	for i, id := range ids {
+		if err := writeRevision(ctx, log, tx, id, versions[i], "", UpdateAction, before[i], after[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockSongIds locks the songs selected by the query and returns their sorted ids
+func lockSongIds(ctx context.Context, log *logger.Logger, tx pgx.Tx, query string, args ...any) ([]int64, error) {
+	log.Debug(ctx, "executing query", slog.String("query", query), slog.Any("args", args))
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[int64])
+}
+
+const revisionColumns = `song_id, revision, author, action, created_at, changes`
+
+func scanRevision(row pgx.Row) (SongRevision, error) {
+	var r SongRevision
+	err := row.Scan(&r.SongID, &r.Revision, &r.Author, &r.Action, &r.CreatedAt, &r.Changes)
+	return r, err
+}
+
+const revisionsQuery = `SELECT ` + revisionColumns + ` FROM song_revision WHERE song_id = $1 ORDER BY revision ASC`
+
+// GetRevisions returns the history of the song including deleted songs,
+// every song has at least one revision
+func (s *Repo) GetRevisions(ctx context.Context, songId int64) ([]SongRevision, error) {
+	s.log.Debug(ctx, "executing query", slog.String("query", revisionsQuery), slog.Int64("song_id", songId))
+	rows, err := s.pool.Query(ctx, revisionsQuery, songId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var revisions []SongRevision
+	for rows.Next() {
+		r, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(revisions) == 0 {
+		return nil, ErrSongNotFound
+	}
+	s.log.Debug(ctx, "got revisions", slog.Int("count", len(revisions)))
+	return revisions, nil
+}
+
+const revisionQuery = `SELECT ` + revisionColumns + ` FROM song_revision WHERE song_id = $1 AND revision = $2`
+
+func (s *Repo) GetRevision(ctx context.Context, songId int64, revision int64) (SongRevision, error) {
+	s.log.Debug(ctx, "executing query", slog.String("query", revisionQuery), slog.Int64("song_id", songId), slog.Int64("revision", revision))
+	r, err := scanRevision(s.pool.QueryRow(ctx, revisionQuery, songId, revision))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return SongRevision{}, ErrRevisionNotFound
+	}
+	return r, err
+}
@@ -6,20 +6,97 @@ import (
 
 type SongsController interface {
 	GetSongs(w http.ResponseWriter, r *http.Request)
+	ExportSongs(w http.ResponseWriter, r *http.Request)
+	GetSong(w http.ResponseWriter, r *http.Request)
 	CreateSong(w http.ResponseWriter, r *http.Request)
+	CreateSongs(w http.ResponseWriter, r *http.Request)
+	ImportSongs(w http.ResponseWriter, r *http.Request)
+	QueryByExample(w http.ResponseWriter, r *http.Request)
 	GetLyrics(w http.ResponseWriter, r *http.Request)
+	SearchLyrics(w http.ResponseWriter, r *http.Request)
+	ReplaceVerse(w http.ResponseWriter, r *http.Request)
+	InsertVerse(w http.ResponseWriter, r *http.Request)
+	RemoveVerse(w http.ResponseWriter, r *http.Request)
+	GetLRC(w http.ResponseWriter, r *http.Request)
+	SetLRC(w http.ResponseWriter, r *http.Request)
 	DeleteSong(w http.ResponseWriter, r *http.Request)
+	RestoreSong(w http.ResponseWriter, r *http.Request)
+	MergeSongs(w http.ResponseWriter, r *http.Request)
+	GetTrash(w http.ResponseWriter, r *http.Request)
+	PurgeTrash(w http.ResponseWriter, r *http.Request)
 	UpdateSong(w http.ResponseWriter, r *http.Request)
+	SetSongArtists(w http.ResponseWriter, r *http.Request)
+	GetRevisions(w http.ResponseWriter, r *http.Request)
+	GetRevision(w http.ResponseWriter, r *http.Request)
+	RevertSong(w http.ResponseWriter, r *http.Request)
+}
+
+type ArtistsController interface {
+	CreateArtist(w http.ResponseWriter, r *http.Request)
+	GetArtists(w http.ResponseWriter, r *http.Request)
+	GetArtist(w http.ResponseWriter, r *http.Request)
+	UpdateArtist(w http.ResponseWriter, r *http.Request)
+	DeleteArtist(w http.ResponseWriter, r *http.Request)
+	GetArtistSongs(w http.ResponseWriter, r *http.Request)
+	GetAliases(w http.ResponseWriter, r *http.Request)
+	CreateAlias(w http.ResponseWriter, r *http.Request)
+	MergeArtists(w http.ResponseWriter, r *http.Request)
+}
+
+type AlbumsController interface {
+	CreateAlbum(w http.ResponseWriter, r *http.Request)
+	GetAlbums(w http.ResponseWriter, r *http.Request)
+	GetAlbum(w http.ResponseWriter, r *http.Request)
+	GetTracks(w http.ResponseWriter, r *http.Request)
+	UpdateAlbum(w http.ResponseWriter, r *http.Request)
+	DeleteAlbum(w http.ResponseWriter, r *http.Request)
 }
 
 func newRouter(
 	songsController SongsController,
+	artistsController ArtistsController,
+	albumsController AlbumsController,
+	idempotent func(http.HandlerFunc) http.HandlerFunc,
 ) *http.ServeMux {
 	mux := http.NewServeMux()
-	mux.HandleFunc("POST /songs", songsController.CreateSong)
+	mux.HandleFunc("POST /songs", idempotent(songsController.CreateSong))
+	mux.HandleFunc("POST /songs:batch", songsController.CreateSongs)
+	mux.HandleFunc("POST /songs/import", songsController.ImportSongs)
 	mux.HandleFunc("GET /songs", songsController.GetSongs)
+	mux.HandleFunc("GET /songs/export", songsController.ExportSongs)
+	mux.HandleFunc("GET /songs/search/lyrics", songsController.SearchLyrics)
+	mux.HandleFunc("POST /songs/query-by-example", songsController.QueryByExample)
+	mux.HandleFunc("GET /songs/{songId}", songsController.GetSong)
 	mux.HandleFunc("GET /songs/{songId}/lyrics", songsController.GetLyrics)
+	mux.HandleFunc("PUT /songs/{songId}/lyrics/{index}", songsController.ReplaceVerse)
+	mux.HandleFunc("POST /songs/{songId}/lyrics/{index}", songsController.InsertVerse)
+	mux.HandleFunc("DELETE /songs/{songId}/lyrics/{index}", songsController.RemoveVerse)
+	mux.HandleFunc("GET /songs/{songId}/lyrics.lrc", songsController.GetLRC)
+	mux.HandleFunc("PUT /songs/{songId}/lyrics.lrc", songsController.SetLRC)
 	mux.HandleFunc("DELETE /songs/{songId}", songsController.DeleteSong)
+	mux.HandleFunc("POST /songs/{songId}/restore", songsController.RestoreSong)
+	mux.HandleFunc("POST /songs/{songId}/merge", songsController.MergeSongs)
+	mux.HandleFunc("GET /songs/trash", songsController.GetTrash)
+	mux.HandleFunc("DELETE /songs/trash", songsController.PurgeTrash)
 	mux.HandleFunc("PATCH /songs/{songId}", songsController.UpdateSong)
+	mux.HandleFunc("PUT /songs/{songId}/artists", songsController.SetSongArtists)
+	mux.HandleFunc("GET /songs/{songId}/revisions", songsController.GetRevisions)
+	mux.HandleFunc("GET /songs/{songId}/revisions/{revision}", songsController.GetRevision)
+	mux.HandleFunc("POST /songs/{songId}/revisions/{revision}/revert", songsController.RevertSong)
+	mux.HandleFunc("POST /artists", artistsController.CreateArtist)
+	mux.HandleFunc("GET /artists", artistsController.GetArtists)
+	mux.HandleFunc("GET /artists/{artistId}", artistsController.GetArtist)
+	mux.HandleFunc("PATCH /artists/{artistId}", artistsController.UpdateArtist)
+	mux.HandleFunc("DELETE /artists/{artistId}", artistsController.DeleteArtist)
+	mux.HandleFunc("GET /artists/{artistId}/songs", artistsController.GetArtistSongs)
+	mux.HandleFunc("GET /artists/{artistId}/aliases", artistsController.GetAliases)
+	mux.HandleFunc("POST /artists/{artistId}/aliases", artistsController.CreateAlias)
+	mux.HandleFunc("POST /artists/{artistId}/merge", artistsController.MergeArtists)
+	mux.HandleFunc("POST /albums", albumsController.CreateAlbum)
+	mux.HandleFunc("GET /albums", albumsController.GetAlbums)
+	mux.HandleFunc("GET /albums/{albumId}", albumsController.GetAlbum)
+	mux.HandleFunc("GET /albums/{albumId}/tracks", albumsController.GetTracks)
+	mux.HandleFunc("PATCH /albums/{albumId}", albumsController.UpdateAlbum)
+	mux.HandleFunc("DELETE /albums/{albumId}", albumsController.DeleteAlbum)
 	return mux
 }
@@ -0,0 +1,102 @@
+package songs
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/filter"
+)
+
+var ErrEmptySearchQuery = errors.New("search query is empty")
+var ErrSearchQueryIsTooLong = errors.New("search query is too long")
+var ErrLastIdCannotBeUsedWithSearch = errors.New("last id cannot be used with search")
+
+const maxSearchQueryLength = 255
+
+type lyricsMatchDTO struct {
+	Song songDTO `json:"song"`
+	// Index of the best matching verse starting from zero
+	Verse int `json:"verse"`
+	// HTML escaped verse fragment with words wrapped into `<mark>` tags
+	Snippet string  `json:"snippet"`
+	Rank    float32 `json:"rank"`
+}
+
+// SearchLyrics godoc
+// @Summary      Search lyrics
+// @Description  Finds songs with verses matching the query in the web search syntax:
+// @Description  `"quoted phrase"`, `or`, `-excluded`. Each song is returned with its best
+// @Description  matching verse, songs are ordered by relevance.
+// @Description  The filter parameters are the same as in `GET /songs`,
+// @Description  only page based pagination is supported.
+// @Description  Snippets are HTML escaped except for the `<mark>` tags.
+// @Tags         songs
+// @Produce      json
+// @Param        q        query  string  true   "Search query"
+// @Param        page     query  uint64  false  "Page number"
+// @Param        pageSize query  uint64  false  "Page size"
+// @Param        filter   query  string  false  "Filter"
+// @Param        total    query  bool    false  "Count matching songs"
+// @Success      200  {array}  lyricsMatchDTO
+// @Header       200  {integer}  X-Total-Count  "Number of matching songs, if they are counted"
+// @Header       200  {string}   Link           "Pagination links (RFC 8288)"
+// @Failure      400  {string}  string
+// @Failure      500  {string}  string
+// @Router       /songs/search/lyrics [get]
+func (c *songsController) SearchLyrics(w http.ResponseWriter, r *http.Request) {
+	sq, err := c.parseQuery(r)
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	if sq.LastId != 0 {
+		c.badRequest(w, r, ErrLastIdCannotBeUsedWithSearch)
+		return
+	}
+	if sq.Page == 0 {
+		sq.Page = 1
+	}
+	text := strings.TrimSpace(r.URL.Query().Get("q"))
+	if text == "" {
+		c.badRequest(w, r, ErrEmptySearchQuery)
+		return
+	}
+	if utf8.RuneCountInString(text) > maxSearchQueryLength {
+		c.badRequest(w, r, ErrSearchQueryIsTooLong)
+		return
+	}
+	if sq.CountTotal, err = c.parseBool(r.URL.Query(), "total"); err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	page, err := c.songsService.SearchLyrics(r.Context(), text, sq)
+	if errors.Is(err, filter.ErrInvalidExpression) {
+		c.badRequest(w, r, err)
+		return
+	}
+	if err != nil {
+		c.serverError(w, r, err, "failed to search lyrics")
+		return
+	}
+	if page.Total != nil {
+		w.Header().Set("X-Total-Count", strconv.FormatInt(*page.Total, 10))
+	}
+	links := pageLinks(r.URL, sq, SongsPage{
+		Total:   page.Total,
+		HasMore: page.HasMore,
+	})
+	w.Header().Set("Link", strings.Join(links, ", "))
+	dtos := make([]lyricsMatchDTO, len(page.Matches))
+	for i, m := range page.Matches {
+		dtos[i] = lyricsMatchDTO{
+			Song:    toDTO(m.Song),
+			Verse:   m.Verse,
+			Snippet: m.Snippet,
+			Rank:    m.Rank,
+		}
+	}
+	c.json(w, r, dtos, http.StatusOK)
+}
@@ -0,0 +1,92 @@
+package songs
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// Songs with the best matching verse, verses are matched separately, so
+// the whole lyrics vector only narrows the songs down with the index
+const lyricsMatchesJoins = ` CROSS JOIN websearch_to_tsquery('simple', $1) AS search_query` +
+	` JOIN LATERAL (SELECT verse.index - 1 AS index, verse.text, ts_rank(to_tsvector('simple', verse.text), search_query) AS rank` +
+	` FROM unnest(song.lyrics) WITH ORDINALITY AS verse(text, index)` +
+	` WHERE to_tsvector('simple', verse.text) @@ search_query ORDER BY rank DESC, verse.index LIMIT 1) AS verse` +
+	` ON lyrics_tsvector(song.lyrics) @@ search_query`
+
+// The verse is escaped before highlighting, so only the `<mark>` tags
+// in the snippet are HTML
+const lyricsSnippetColumns = `verse.index, ts_headline('simple', replace(replace(replace(replace(verse.text, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;'), search_query, 'StartSel=<mark>, StopSel=</mark>'), verse.rank`
+
+// SearchLyrics returns songs matching the filter of the query whose verses
+// match the web search text, songs are ordered by the rank of the best verse
+func (s *Repo) SearchLyrics(ctx context.Context, text string, query Query) ([]LyricsMatch, error) {
+	q := strings.Builder{}
+	q.Grow(100)
+	q.WriteString(`SELECT ` + songColumns + `, ` + lyricsSnippetColumns + ` FROM ` + songsTable + lyricsMatchesJoins)
+	args, err := s.writeConditions(&q, query, []any{text})
+	if err != nil {
+		return nil, err
+	}
+	q.WriteString(" ORDER BY verse.rank DESC, song.id ASC")
+	if query.Page > 0 {
+		q.WriteString(" OFFSET $")
+		args = append(args, (query.Page-1)*query.PageSize)
+		q.WriteString(strconv.Itoa(len(args)))
+	}
+	q.WriteString(" LIMIT $")
+	if query.Lookahead {
+		args = append(args, query.PageSize+1)
+	} else {
+		args = append(args, query.PageSize)
+	}
+	q.WriteString(strconv.Itoa(len(args)))
+	sql := q.String()
+	s.log.Debug(ctx, "executing query", slog.String("query", sql), slog.Any("args", args))
+	rows, err := s.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var matches []LyricsMatch
+	for rows.Next() {
+		var r songRow
+		var m LyricsMatch
+		dest := make([]any, 0, len(songFields)+3)
+		for _, f := range songFields {
+			dest = append(dest, f.dest(&r)...)
+		}
+		dest = append(dest, &m.Verse, &m.Snippet, &m.Rank)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		m.Song = r.toSong()
+		matches = append(matches, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	s.log.Debug(ctx, "got lyrics matches", slog.Int("count", len(matches)))
+	return matches, nil
+}
+
+// CountLyricsMatches returns the number of songs found by SearchLyrics,
+// pagination is ignored
+func (s *Repo) CountLyricsMatches(ctx context.Context, text string, query Query) (int64, error) {
+	q := strings.Builder{}
+	q.Grow(100)
+	q.WriteString(`SELECT count(*) FROM ` + songsFilterTable + lyricsMatchesJoins)
+	query.LastId = 0
+	args, err := s.writeConditions(&q, query, []any{text})
+	if err != nil {
+		return 0, err
+	}
+	sql := q.String()
+	s.log.Debug(ctx, "executing query", slog.String("query", sql), slog.Any("args", args))
+	var count int64
+	if err := s.pool.QueryRow(ctx, sql, args...).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
@@ -2,9 +2,12 @@ package songs
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/x0k/effective-mobile-song-library-service/internal/lib/music_info"
@@ -13,31 +16,79 @@ import (
 var ErrFailedToGetInfo = errors.New("failed to get info")
 var ErrFailedToParseReleaseDate = errors.New("failed to parse release date")
 var ErrFailedToSaveSong = errors.New("failed to save song")
+var ErrCannotMergeSongIntoItself = errors.New("cannot merge song into itself")
 
 type SongsRepo interface {
-	SaveSong(ctx context.Context, song *Song) error
+	SaveSong(ctx context.Context, song *Song, author string) error
+	SaveSongs(ctx context.Context, songs []*Song, author string) error
+	GetSong(ctx context.Context, id int64) (Song, error)
 	GetSongs(ctx context.Context, query Query) ([]Song, error)
+	CountSongs(ctx context.Context, query Query) (int64, error)
+	SearchLyrics(ctx context.Context, text string, query Query) ([]LyricsMatch, error)
+	CountLyricsMatches(ctx context.Context, text string, query Query) (int64, error)
+	ExportSongs(ctx context.Context, query Query, yield func(Song) error) error
 	GetLyrics(ctx context.Context, id int64, pagination Pagination) ([]string, error)
-	DeleteSong(ctx context.Context, id int64) error
-	UpdateSong(ctx context.Context, id int64, upd SongUpdate) error
+	DeleteSong(ctx context.Context, id int64, version int64, author string) error
+	RestoreSong(ctx context.Context, id int64, author string) error
+	PurgeSongs(ctx context.Context, before time.Time) (int64, error)
+	UpdateSong(ctx context.Context, id int64, version int64, upd SongUpdate, author string) (int64, error)
+	RevertSong(ctx context.Context, id int64, version int64, upd SongUpdate, author string) (int64, error)
+	MergeSongs(ctx context.Context, targetId int64, version int64, sourceId int64, author string) (int64, error)
+	EditLyrics(ctx context.Context, id int64, version int64, edit VerseEdit, author string) (int64, error)
+	GetTimedLyrics(ctx context.Context, id int64) (Song, error)
+	GetOutdatedStats(ctx context.Context, limit int) ([]Song, error)
+	SaveLyricsStats(ctx context.Context, songs []Song) error
+	GetRevisions(ctx context.Context, songId int64) ([]SongRevision, error)
+	GetRevision(ctx context.Context, songId int64, revision int64) (SongRevision, error)
+	SetCredits(ctx context.Context, id int64, credits []Credit) error
+	FindArtist(ctx context.Context, name string) (Artist, error)
 }
 
 type songsService struct {
 	musicInfo music_info.ClientWithResponsesInterface
 	songsRepo SongsRepo
+	// How long deleted songs are kept in the trash
+	trashRetention time.Duration
+	// Default layout of the release dates in imported CSV
+	importDateLayout string
 }
 
 func newService(
 	musicInfo music_info.ClientWithResponsesInterface,
 	songsRepo SongsRepo,
+	trashRetention time.Duration,
+	importDateLayout string,
 ) *songsService {
+	if importDateLayout == "" {
+		importDateLayout = releaseDateFormat
+	}
 	return &songsService{
-		musicInfo: musicInfo,
-		songsRepo: songsRepo,
+		musicInfo:        musicInfo,
+		songsRepo:        songsRepo,
+		trashRetention:   trashRetention,
+		importDateLayout: importDateLayout,
+	}
+}
+
+func (s *songsService) CreateSong(ctx context.Context, title string, artist string, author string) (Song, error) {
+	// Known artists are looked up under their canonical names
+	if a, err := s.songsRepo.FindArtist(ctx, artist); err == nil {
+		artist = a.Name
+	} else if !errors.Is(err, ErrArtistNotFound) {
+		return Song{}, err
+	}
+	song, err := s.fetchSong(ctx, title, artist)
+	if err != nil {
+		return Song{}, err
 	}
+	if err := s.songsRepo.SaveSong(ctx, &song, author); err != nil {
+		return Song{}, fmt.Errorf("%w: %w", ErrFailedToSaveSong, err)
+	}
+	return song, nil
 }
 
-func (s *songsService) CreateSong(ctx context.Context, title string, artist string) (Song, error) {
+// fetchSong creates the song from the music info
+func (s *songsService) fetchSong(ctx context.Context, title string, artist string) (Song, error) {
 	r, err := s.musicInfo.GetInfoWithResponse(ctx, &music_info.GetInfoParams{
 		Group: artist,
 		Song:  title,
@@ -60,24 +111,386 @@ func (s *songsService) CreateSong(ctx context.Context, title string, artist stri
 		lyrics,
 		r.JSON200.Link,
 	)
-	if err := s.songsRepo.SaveSong(ctx, &song); err != nil {
-		return Song{}, fmt.Errorf("%w: %v", ErrFailedToSaveSong, err)
-	}
+	song.Stats = NewLyricsStats(song.Lyrics)
 	return song, nil
 }
 
+const (
+	// Maximum number of concurrent requests to the music info service
+	batchConcurrency = 8
+	// Maximum number of songs saved in one transaction
+	batchSize = 100
+)
+
+// CreateSongs creates songs from the requests, results are sent
+// in the order of completion and the channel is closed when
+// the requests channel is closed and all songs are processed.
+// Unlike CreateSong, music info is requested with the given artist names.
+func (s *songsService) CreateSongs(ctx context.Context, requests <-chan SongRequest, author string) <-chan SongResult {
+	fetched := make(chan SongResult)
+	var wg sync.WaitGroup
+	wg.Add(batchConcurrency)
+	for range batchConcurrency {
+		go func() {
+			defer wg.Done()
+			for req := range requests {
+				song, err := s.fetchSong(ctx, req.Title, req.Artist)
+				select {
+				case fetched <- SongResult{Line: req.Line, Song: song, Err: err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(fetched)
+	}()
+	results := make(chan SongResult)
+	go func() {
+		defer close(results)
+		s.saveSongs(ctx, fetched, author, results)
+	}()
+	return results
+}
+
+// saveSongs saves songs that are ready at the moment in one batch
+func (s *songsService) saveSongs(ctx context.Context, fetched <-chan SongResult, author string, results chan<- SongResult) {
+	batch := make([]SongResult, 0, batchSize)
+	for r := range fetched {
+		batch = append(batch[:0], r)
+	collect:
+		for len(batch) < batchSize {
+			select {
+			case r, ok := <-fetched:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, r)
+			default:
+				break collect
+			}
+		}
+		s.saveBatch(ctx, batch, author)
+		for _, r := range batch {
+			select {
+			case results <- r:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// saveBatch saves fetched songs of the batch, if the batch fails
+// songs are saved one by one to find out the failed ones
+func (s *songsService) saveBatch(ctx context.Context, batch []SongResult, author string) {
+	songs := make([]*Song, 0, len(batch))
+	for i := range batch {
+		if batch[i].Err == nil {
+			songs = append(songs, &batch[i].Song)
+		}
+	}
+	if len(songs) == 0 {
+		return
+	}
+	if err := s.songsRepo.SaveSongs(ctx, songs, author); err == nil {
+		return
+	}
+	for i := range batch {
+		if batch[i].Err != nil {
+			continue
+		}
+		if err := s.songsRepo.SaveSong(ctx, &batch[i].Song, author); err != nil {
+			batch[i].Err = fmt.Errorf("%w: %w", ErrFailedToSaveSong, err)
+		}
+	}
+}
+
+// ImportSongs creates songs from the CSV rows, the songs are saved
+// in one transaction and nothing is saved if any row is invalid
+func (s *songsService) ImportSongs(ctx context.Context, r io.Reader, opts ImportOptions, author string) (ImportResult, error) {
+	layout := opts.DateLayout
+	if layout == "" {
+		layout = s.importDateLayout
+	}
+	sr, err := newCSVSongsReader(r, opts.Columns, layout)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	var result ImportResult
+	for {
+		song, errs, err := sr.read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return ImportResult{}, err
+		}
+		if len(errs) > 0 {
+			result.Errors = append(result.Errors, errs...)
+			continue
+		}
+		song.Stats = NewLyricsStats(song.Lyrics)
+		result.Songs = append(result.Songs, song)
+	}
+	if len(result.Errors) > 0 || opts.DryRun || len(result.Songs) == 0 {
+		return result, nil
+	}
+	// Known artists are saved under their canonical names
+	canonical := make(map[string]string)
+	songs := make([]*Song, len(result.Songs))
+	for i := range result.Songs {
+		song := &result.Songs[i]
+		name, ok := canonical[song.Artist]
+		if !ok {
+			name = song.Artist
+			if a, err := s.songsRepo.FindArtist(ctx, song.Artist); err == nil {
+				name = a.Name
+			} else if !errors.Is(err, ErrArtistNotFound) {
+				return ImportResult{}, err
+			}
+			canonical[song.Artist] = name
+		}
+		song.Artist = name
+		songs[i] = song
+	}
+	if err := s.songsRepo.SaveSongs(ctx, songs, author); err != nil {
+		return ImportResult{}, fmt.Errorf("%w: %w", ErrFailedToSaveSong, err)
+	}
+	return result, nil
+}
+
+func (s *songsService) GetSong(ctx context.Context, id int64) (Song, error) {
+	return s.songsRepo.GetSong(ctx, id)
+}
+
 func (s *songsService) GetSongs(ctx context.Context, query Query) ([]Song, error) {
 	return s.songsRepo.GetSongs(ctx, query)
 }
 
+func (s *songsService) GetSongsPage(ctx context.Context, query Query) (SongsPage, error) {
+	q := query
+	q.Lookahead = true
+	songs, err := s.songsRepo.GetSongs(ctx, q)
+	if err != nil {
+		return SongsPage{}, err
+	}
+	page := SongsPage{
+		Songs: songs,
+	}
+	if uint64(len(songs)) > query.PageSize {
+		page.Songs = songs[:query.PageSize]
+		page.HasMore = true
+	}
+	if query.CountTotal {
+		total, err := s.songsRepo.CountSongs(ctx, query)
+		if err != nil {
+			return SongsPage{}, err
+		}
+		page.Total = &total
+	}
+	return page, nil
+}
+
+// SearchLyrics returns the page of songs with verses matching the text,
+// songs are ordered by relevance, so only page based pagination is supported
+func (s *songsService) SearchLyrics(ctx context.Context, text string, query Query) (LyricsMatchesPage, error) {
+	q := query
+	q.Lookahead = true
+	matches, err := s.songsRepo.SearchLyrics(ctx, text, q)
+	if err != nil {
+		return LyricsMatchesPage{}, err
+	}
+	page := LyricsMatchesPage{
+		Matches: matches,
+	}
+	if uint64(len(matches)) > query.PageSize {
+		page.Matches = matches[:query.PageSize]
+		page.HasMore = true
+	}
+	if query.CountTotal {
+		total, err := s.songsRepo.CountLyricsMatches(ctx, text, query)
+		if err != nil {
+			return LyricsMatchesPage{}, err
+		}
+		page.Total = &total
+	}
+	return page, nil
+}
+
+func (s *songsService) ExportSongs(ctx context.Context, query Query, yield func(Song) error) error {
+	return s.songsRepo.ExportSongs(ctx, query, yield)
+}
+
 func (s *songsService) GetLyrics(ctx context.Context, id int64, pagination Pagination) ([]string, error) {
 	return s.songsRepo.GetLyrics(ctx, id, pagination)
 }
 
-func (s *songsService) DeleteSong(ctx context.Context, id int64) error {
-	return s.songsRepo.DeleteSong(ctx, id)
+func (s *songsService) DeleteSong(ctx context.Context, id int64, version int64, author string) error {
+	return s.songsRepo.DeleteSong(ctx, id, version, author)
+}
+
+func (s *songsService) RestoreSong(ctx context.Context, id int64, author string) error {
+	return s.songsRepo.RestoreSong(ctx, id, author)
+}
+
+// PurgeTrash permanently deletes songs that have been in the trash
+// longer than the retention period
+func (s *songsService) PurgeTrash(ctx context.Context) (int64, error) {
+	return s.songsRepo.PurgeSongs(ctx, time.Now().Add(-s.trashRetention))
+}
+
+// Number of songs recounted in one transaction
+const recountBatchSize = 100
+
+// RecountLyricsStats recounts outdated statistics of the lyrics
+// and returns the number of recounted songs
+func (s *songsService) RecountLyricsStats(ctx context.Context) (int64, error) {
+	var count int64
+	for {
+		songs, err := s.songsRepo.GetOutdatedStats(ctx, recountBatchSize)
+		if err != nil || len(songs) == 0 {
+			return count, err
+		}
+		for i := range songs {
+			songs[i].Stats = NewLyricsStats(songs[i].Lyrics)
+		}
+		if err := s.songsRepo.SaveLyricsStats(ctx, songs); err != nil {
+			return count, err
+		}
+		count += int64(len(songs))
+	}
+}
+
+func (s *songsService) UpdateSong(ctx context.Context, id int64, version int64, upd SongUpdate, author string) (int64, error) {
+	return s.songsRepo.UpdateSong(ctx, id, version, withLyricsStats(upd), author)
+}
+
+func (s *songsService) GetRevisions(ctx context.Context, songId int64) ([]SongRevision, error) {
+	return s.songsRepo.GetRevisions(ctx, songId)
+}
+
+func (s *songsService) GetRevision(ctx context.Context, songId int64, revision int64) (SongRevision, error) {
+	return s.songsRepo.GetRevision(ctx, songId, revision)
+}
+
+func (s *songsService) EditLyrics(ctx context.Context, id int64, version int64, edit VerseEdit, author string) (int64, error) {
+	return s.songsRepo.EditLyrics(ctx, id, version, edit, author)
+}
+
+// GetTimedLyrics returns the lyrics with line times and the song version
+func (s *songsService) GetTimedLyrics(ctx context.Context, id int64) (TimedLyrics, int64, error) {
+	song, err := s.songsRepo.GetTimedLyrics(ctx, id)
+	if err != nil {
+		return TimedLyrics{}, 0, err
+	}
+	lyrics, err := newTimedLyrics(song)
+	return lyrics, song.Version, err
+}
+
+// SetTimedLyrics replaces the lyrics of the song with the timed lyrics,
+// the title and the artist of the lyrics are ignored
+func (s *songsService) SetTimedLyrics(ctx context.Context, id int64, version int64, lyrics TimedLyrics, author string) (int64, error) {
+	if err := lyrics.validate(); err != nil {
+		return 0, err
+	}
+	return s.songsRepo.UpdateSong(ctx, id, version, withLyricsStats(lyrics.songUpdate()), author)
+}
+
+// MergeSongs merges the duplicate source song into the target song
+// and returns the new version of the target song
+func (s *songsService) MergeSongs(ctx context.Context, targetId int64, version int64, sourceId int64, author string) (int64, error) {
+	if targetId == sourceId {
+		return 0, ErrCannotMergeSongIntoItself
+	}
+	return s.songsRepo.MergeSongs(ctx, targetId, version, sourceId, author)
+}
+
+// RevertSong restores fields of the song to their values at the given
+// revision and returns the new song version
+func (s *songsService) RevertSong(ctx context.Context, id int64, revision int64, version int64, author string) (int64, error) {
+	revisions, err := s.songsRepo.GetRevisions(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	upd, err := revisionUpdate(revisions, revision)
+	if err != nil {
+		return 0, err
+	}
+	return s.songsRepo.RevertSong(ctx, id, version, withLyricsStats(upd), author)
+}
+
+// revisionUpdate replays the history up to the given revision
+func revisionUpdate(revisions []SongRevision, revision int64) (SongUpdate, error) {
+	found := false
+	state := make(map[SongField]json.RawMessage, len(revisionFields))
+	for _, r := range revisions {
+		if r.Revision > revision {
+			break
+		}
+		found = found || r.Revision == revision
+		for f, c := range r.Changes {
+			state[f] = c.After
+		}
+	}
+	if !found {
+		return nil, ErrRevisionNotFound
+	}
+	upd := make(SongUpdate, len(revisionFields))
+	for _, f := range revisionFields {
+		v, err := decodeFieldValue(f, state[f])
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s of revision %d: %w", f, revision, err)
+		}
+		upd[f] = v
+	}
+	return upd, nil
+}
+
+// decodeFieldValue converts the JSON representation of the field value
+// into the SongUpdate value, absent values are decoded as nil
+func decodeFieldValue(f SongField, raw json.RawMessage) (any, error) {
+	if len(raw) == 0 {
+		raw = json.RawMessage("null")
+	}
+	switch f {
+	case ReleaseDate:
+		var v string
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, err
+		}
+		return time.Parse(releaseDateFormat, v)
+	case Lyrics:
+		var v []string
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	case AlbumID:
+		var v *int64
+		if err := json.Unmarshal(raw, &v); err != nil || v == nil {
+			return nil, err
+		}
+		return *v, nil
+	case LineTimes:
+		var v []int32
+		if err := json.Unmarshal(raw, &v); err != nil || v == nil {
+			return nil, err
+		}
+		return v, nil
+	case DiscNumber, TrackNumber:
+		var v *int
+		if err := json.Unmarshal(raw, &v); err != nil || v == nil {
+			return nil, err
+		}
+		return *v, nil
+	default:
+		var v string
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	}
 }
 
-func (s *songsService) UpdateSong(ctx context.Context, id int64, upd SongUpdate) error {
-	return s.songsRepo.UpdateSong(ctx, id, upd)
+func (s *songsService) SetSongArtists(ctx context.Context, id int64, credits []Credit) error {
+	return s.songsRepo.SetCredits(ctx, id, credits)
 }
@@ -1,6 +1,7 @@
 package songs
 
 import (
+	"net/url"
 	"time"
 )
 
@@ -10,9 +11,19 @@ type Song struct {
 	ID          int64
 	Title       string
 	Artist      string
+	ArtistID    int64
 	ReleaseDate time.Time
 	Lyrics      []string
 	Link        string
+	Track       *Track
+	Credits     []Credit
+	Stats       LyricsStats
+	// Start times of the lyrics lines, nil if the lyrics are not timed
+	LineTimes []time.Duration
+	// Incremented on every update
+	Version int64
+	// Time when the song was moved to the trash
+	DeletedAt *time.Time
 }
 
 func NewSong(
@@ -26,12 +37,27 @@ func NewSong(
 		ID:          -1,
 		Title:       title,
 		Artist:      artist,
+		ArtistID:    -1,
 		ReleaseDate: releaseDate,
 		Lyrics:      lyrics,
 		Link:        link,
 	}
 }
 
+// SongRequest is a request to create the song from the music info,
+// the line is a position of the request in the batch
+type SongRequest struct {
+	Line   int
+	Title  string
+	Artist string
+}
+
+type SongResult struct {
+	Line int
+	Song Song
+	Err  error
+}
+
 type Pagination struct {
 	PageSize uint64
 	Page     uint64
@@ -41,16 +67,78 @@ type Query struct {
 	Pagination
 	LastId int64
 	Filter string
+	// Shorthand filter parameters, e.g. `releaseDate[gte]=01.01.2000`
+	FilterParams url.Values
+	// Selected song fields, all fields are selected if empty
+	Fields []string
+	// Select songs from the trash
+	Deleted bool
+	// Select one more song than the page size
+	// to find out if there is a next page
+	Lookahead bool
+	// Count songs matching the filter
+	CountTotal bool
+}
+
+type SongsPage struct {
+	Songs []Song
+	// Number of songs matching the filter,
+	// nil if the songs are not counted
+	Total   *int64
+	HasMore bool
 }
 
 type SongField string
 
 const (
 	Title       SongField = "song"
-	Artist      SongField = "group"
+	Group       SongField = "group"
 	ReleaseDate SongField = "releaseDate"
 	Lyrics      SongField = "text"
 	Link        SongField = "link"
+	AlbumID     SongField = "albumId"
+	DiscNumber  SongField = "discNumber"
+	TrackNumber SongField = "trackNumber"
+	// Deletion time is tracked in revisions only
+	DeletedAt SongField = "deletedAt"
 )
 
 type SongUpdate map[SongField]any
+
+type VerseOp int
+
+const (
+	InsertVerse VerseOp = iota
+	ReplaceVerse
+	MoveVerse
+	RemoveVerse
+)
+
+// VerseEdit changes a single verse of the lyrics, indexes start from zero.
+// The moved verse is placed at the index after the move.
+type VerseEdit struct {
+	Op    VerseOp
+	Index int
+	// Index of the moved verse
+	From int
+	// Text of the inserted or replaced verse
+	Text string
+}
+
+// LyricsMatch is the song found by the lyrics search
+// with its best matching verse
+type LyricsMatch struct {
+	Song Song
+	// Index of the verse starting from zero
+	Verse int
+	// Verse fragment with highlighted words
+	Snippet string
+	Rank    float32
+}
+
+type LyricsMatchesPage struct {
+	Matches []LyricsMatch
+	// Number of matching songs, nil if they are not counted
+	Total   *int64
+	HasMore bool
+}
@@ -0,0 +1,588 @@
+package songs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/filter"
+	"github.com/x0k/effective-mobile-song-library-service/internal/lib/httpx"
+)
+
+type createSongDTO struct {
+	Group string `json:"group"`
+	Song  string `json:"song"`
+}
+
+func (d createSongDTO) validate() error {
+	if len(strings.TrimSpace(d.Group)) == 0 {
+		return fmt.Errorf("%w: %v", ErrInvalidField, "group")
+	}
+	if len(strings.TrimSpace(d.Song)) == 0 {
+		return fmt.Errorf("%w: %v", ErrInvalidField, "song")
+	}
+	return nil
+}
+
+type duplicateSongDTO struct {
+	Error string `json:"error"`
+	// Id of the existing song with the same artist and title
+	ID int64 `json:"id"`
+}
+
+type songDTO struct {
+	ID          int64    `json:"id"`
+	Title       string   `json:"song"`
+	Artist      string   `json:"group"`
+	ArtistID    int64    `json:"artistId"`
+	ReleaseDate string   `json:"releaseDate"`
+	Lyrics      []string `json:"text"`
+	Link        string   `json:"link"`
+	AlbumID     *int64   `json:"albumId,omitempty"`
+	Album       *string  `json:"album,omitempty"`
+	DiscNumber  int      `json:"discNumber,omitempty"`
+	TrackNumber int      `json:"trackNumber,omitempty"`
+	// Lyrics statistics, lines are counted without empty ones
+	VerseCount      int         `json:"verseCount"`
+	LineCount       int         `json:"lineCount"`
+	WordCount       int         `json:"wordCount"`
+	UniqueWordCount int         `json:"uniqueWordCount"`
+	Artists         []creditDTO `json:"artists"`
+	DeletedAt       *time.Time  `json:"deletedAt,omitempty"`
+}
+
+type songsPageDTO struct {
+	Items []songDTO `json:"items"`
+	// Id of the last song, should be passed as `lastId`
+	// to get the next page
+	NextCursor *int64 `json:"nextCursor"`
+	// Number of songs matching the filter,
+	// omitted for the next pages of the cursor pagination
+	Total *int64 `json:"total,omitempty"`
+}
+
+type sparseSongsPageDTO struct {
+	Items      []map[string]json.RawMessage `json:"items"`
+	NextCursor *int64                       `json:"nextCursor"`
+	Total      *int64                       `json:"total,omitempty"`
+}
+
+type updateSongDTO struct {
+	Title       *string   `json:"song"`
+	Artist      *string   `json:"group"`
+	ReleaseDate *string   `json:"releaseDate"`
+	Lyrics      *[]string `json:"text"`
+	Link        *string   `json:"link"`
+	AlbumID     *int64    `json:"albumId"`
+	DiscNumber  *int      `json:"discNumber"`
+	TrackNumber *int      `json:"trackNumber"`
+}
+
+// songUpdate validates the present fields
+func (u updateSongDTO) songUpdate() (SongUpdate, error) {
+	upd := make(SongUpdate, 8)
+	if u.Title != nil {
+		upd[Title] = *u.Title
+	}
+	if u.Artist != nil {
+		upd[Group] = *u.Artist
+	}
+	if u.ReleaseDate != nil {
+		time, err := time.Parse(releaseDateFormat, *u.ReleaseDate)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidDate, err)
+		}
+		upd[ReleaseDate] = time
+	}
+	if u.Lyrics != nil {
+		upd[Lyrics] = *u.Lyrics
+	}
+	if u.Link != nil {
+		upd[Link] = *u.Link
+	}
+	if u.AlbumID != nil {
+		upd[AlbumID] = *u.AlbumID
+	}
+	if u.DiscNumber != nil {
+		if *u.DiscNumber <= 0 {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidField, DiscNumber)
+		}
+		upd[DiscNumber] = *u.DiscNumber
+	}
+	if u.TrackNumber != nil {
+		if *u.TrackNumber <= 0 {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidField, TrackNumber)
+		}
+		upd[TrackNumber] = *u.TrackNumber
+	}
+	return upd, nil
+}
+
+type songExampleDTO struct {
+	ID          *int64   `json:"id"`
+	Title       *string  `json:"song"`
+	Artist      *string  `json:"group"`
+	ReleaseDate *string  `json:"releaseDate"`
+	Lyrics      []string `json:"text"`
+	Link        *string  `json:"link"`
+}
+
+// filterParams translates the example into shorthand filter parameters
+func (e songExampleDTO) filterParams() url.Values {
+	params := url.Values{}
+	if e.ID != nil {
+		params.Set("id", strconv.FormatInt(*e.ID, 10))
+	}
+	if e.Title != nil {
+		params.Set(string(Title), *e.Title)
+	}
+	if e.Artist != nil {
+		params.Set(string(Group), *e.Artist)
+	}
+	if e.ReleaseDate != nil {
+		params.Set(string(ReleaseDate), *e.ReleaseDate)
+	}
+	if len(e.Lyrics) > 0 {
+		params[string(Lyrics)+"[like]"] = e.Lyrics
+	}
+	if e.Link != nil {
+		params.Set(string(Link), *e.Link)
+	}
+	return params
+}
+
+func toDTO(song Song) songDTO {
+	dto := songDTO{
+		ID:              song.ID,
+		Title:           song.Title,
+		Artist:          song.Artist,
+		ArtistID:        song.ArtistID,
+		ReleaseDate:     song.ReleaseDate.Format(releaseDateFormat),
+		Lyrics:          song.Lyrics,
+		Link:            song.Link,
+		DeletedAt:       song.DeletedAt,
+		VerseCount:      song.Stats.Verses,
+		LineCount:       song.Stats.Lines,
+		WordCount:       song.Stats.Words,
+		UniqueWordCount: song.Stats.UniqueWords,
+	}
+	dto.Artists = make([]creditDTO, 0, len(song.Credits)+1)
+	dto.Artists = append(dto.Artists, creditDTO{
+		ID:   song.ArtistID,
+		Name: song.Artist,
+		Role: string(PrimaryRole),
+	})
+	for _, c := range song.Credits {
+		dto.Artists = append(dto.Artists, creditDTO{
+			ID:   c.ArtistID,
+			Name: c.Artist,
+			Role: string(c.Role),
+		})
+	}
+	if song.Track != nil {
+		dto.AlbumID = &song.Track.AlbumID
+		dto.Album = &song.Track.Album
+		dto.DiscNumber = song.Track.DiscNumber
+		dto.TrackNumber = song.Track.Number
+	}
+	return dto
+}
+
+func toDTOs(songs []Song) []songDTO {
+	dtos := make([]songDTO, len(songs))
+	for i, song := range songs {
+		dtos[i] = toDTO(song)
+	}
+	return dtos
+}
+
+// sparseDTOs keeps only the given fields and the id of the song DTOs,
+// field names match the JSON keys of songDTO
+func sparseDTOs(songs []Song, fields []string) ([]map[string]json.RawMessage, error) {
+	dtos := make([]map[string]json.RawMessage, len(songs))
+	for i, song := range songs {
+		data, err := json.Marshal(toDTO(song))
+		if err != nil {
+			return nil, err
+		}
+		var all map[string]json.RawMessage
+		if err := json.Unmarshal(data, &all); err != nil {
+			return nil, err
+		}
+		dto := make(map[string]json.RawMessage, len(fields)+1)
+		dto["id"] = all["id"]
+		for _, f := range fields {
+			if v, ok := all[f]; ok {
+				dto[f] = v
+			}
+		}
+		dtos[i] = dto
+	}
+	return dtos, nil
+}
+
+// CreateSong godoc
+// @Summary      Create song
+// @Description  Requests with the same `Idempotency-Key` header are processed once,
+// @Description  repeats get the stored response with the `Idempotent-Replayed` header.
+// @Tags         songs
+// @Accept       json
+// @Produce      json
+// @Param        X-Author        header string false "Author of the change"
+// @Param        Idempotency-Key header string false "Unique key of the request"
+// @Param        payload body createSongDTO true "Song data"
+// @Success      201  {object}  songDTO
+// @Failure      400  {string}  string
+// @Failure      409  {object}  duplicateSongDTO  "Duplicate song or request with the key is in progress"
+// @Failure      422  {string}  string  "Key is used with a different request"
+// @Failure      500  {string}  string
+// @Router       /songs [post]
+func (c *songsController) CreateSong(w http.ResponseWriter, r *http.Request) {
+	createSong, httpErr := httpx.JSONBody[createSongDTO](c.log.Logger, c.decoder, w, r)
+	if httpErr != nil {
+		http.Error(w, httpErr.Text, httpErr.Status)
+		return
+	}
+	if err := createSong.validate(); err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	author, err := c.parseAuthor(r)
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	song, err := c.songsService.CreateSong(r.Context(), createSong.Song, createSong.Group, author)
+	if errors.Is(err, ErrDuplicateSong) {
+		c.duplicateSong(w, r, err)
+		return
+	}
+	if err != nil {
+		c.serverError(w, r, err, "failed to create song")
+		return
+	}
+	c.json(w, r, toDTO(song), http.StatusCreated)
+}
+
+// GetSongs godoc
+// @Summary      Get songs
+// @Description  Besides the `filter` expression, songs can be filtered with shorthand
+// @Description  parameters like `group=Muse` or `releaseDate[gte]=01.01.2000`.
+// @Description  Supported operators: eq, ne, gt, gte, lt, lte, like, in.
+// @Description  With the `envelope` parameter songs are wrapped into the
+// @Description  `{"items": [...], "nextCursor": 42, "total": 100}` object.
+// @Description  Songs are counted for the envelope or with the `total` parameter,
+// @Description  but not for the pages after `lastId`.
+// @Description  The `fields` parameter accepts filter schema names and `artists`,
+// @Description  the song id is always included.
+// @Tags         songs
+// @Produce      json
+// @Param        page     query  uint64  false  "Page number"
+// @Param        pageSize query  uint64  false  "Page size"
+// @Param        lastId   query  int64   false  "Last song id"
+// @Param        filter   query  string  false  "Filter"
+// @Param        envelope query  bool    false  "Wrap songs into the pagination envelope"
+// @Param        total    query  bool    false  "Count songs matching the filter"
+// @Param        fields   query  string  false  "Comma separated list of song fields, e.g. `song,group,artists`"
+// @Success      200  {array}  songDTO
+// @Header       200  {integer}  X-Total-Count  "Number of songs matching the filter, if they are counted"
+// @Header       200  {string}   Link           "Pagination links (RFC 8288)"
+// @Failure      400  {string}  string
+// @Failure      500  {string}  string
+// @Router       /songs [get]
+func (c *songsController) GetSongs(w http.ResponseWriter, r *http.Request) {
+	sq, err := c.parseQuery(r)
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	envelope, err := c.parseBool(r.URL.Query(), "envelope")
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	total, err := c.parseBool(r.URL.Query(), "total")
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	// The next pages of the cursor pagination don't need the total
+	sq.CountTotal = (envelope || total) && sq.LastId == 0
+	sq.Fields = parseFields(r.URL.Query())
+	page, err := c.songsService.GetSongsPage(r.Context(), sq)
+	if errors.Is(err, filter.ErrInvalidExpression) || errors.Is(err, ErrUnknownSongField) {
+		c.badRequest(w, r, err)
+		return
+	}
+	if err != nil {
+		c.serverError(w, r, err, "failed to get songs")
+		return
+	}
+	if page.Total != nil {
+		w.Header().Set("X-Total-Count", strconv.FormatInt(*page.Total, 10))
+	}
+	if links := pageLinks(r.URL, sq, page); len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+	var nextCursor *int64
+	if page.HasMore {
+		nextCursor = &page.Songs[len(page.Songs)-1].ID
+	}
+	if len(sq.Fields) > 0 {
+		items, err := sparseDTOs(page.Songs, sq.Fields)
+		if err != nil {
+			c.serverError(w, r, err, "failed to select song fields")
+			return
+		}
+		if !envelope {
+			c.json(w, r, items, http.StatusOK)
+			return
+		}
+		c.json(w, r, sparseSongsPageDTO{
+			Items:      items,
+			NextCursor: nextCursor,
+			Total:      page.Total,
+		}, http.StatusOK)
+		return
+	}
+	dtos := toDTOs(page.Songs)
+	if !envelope {
+		c.json(w, r, dtos, http.StatusOK)
+		return
+	}
+	c.json(w, r, songsPageDTO{
+		Items:      dtos,
+		NextCursor: nextCursor,
+		Total:      page.Total,
+	}, http.StatusOK)
+}
+
+// QueryByExample godoc
+// @Summary      Query songs by example
+// @Description  Scalar fields of the example are matched by equality,
+// @Description  lyrics fragments are matched with `ALIKE` operator.
+// @Tags         songs
+// @Accept       json
+// @Produce      json
+// @Param        page     query  uint64          false  "Page number"
+// @Param        pageSize query  uint64          false  "Page size"
+// @Param        lastId   query  int64           false  "Last song id"
+// @Param        payload  body   songExampleDTO  true   "Song example"
+// @Success      200  {array}  songDTO
+// @Failure      400  {string}  string
+// @Failure      500  {string}  string
+// @Router       /songs/query-by-example [post]
+func (c *songsController) QueryByExample(w http.ResponseWriter, r *http.Request) {
+	sq, err := c.parseQuery(r)
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	example, httpErr := httpx.JSONBody[songExampleDTO](c.log.Logger, c.decoder, w, r)
+	if httpErr != nil {
+		http.Error(w, httpErr.Text, httpErr.Status)
+		return
+	}
+	for k, v := range example.filterParams() {
+		sq.FilterParams[k] = append(sq.FilterParams[k], v...)
+	}
+	c.songs(w, r, sq)
+}
+
+func (c *songsController) songs(w http.ResponseWriter, r *http.Request, sq Query) {
+	songs, err := c.songsService.GetSongs(r.Context(), sq)
+	if errors.Is(err, filter.ErrInvalidExpression) {
+		c.badRequest(w, r, err)
+		return
+	}
+	if err != nil {
+		c.serverError(w, r, err, "failed to get songs")
+		return
+	}
+	c.json(w, r, toDTOs(songs), http.StatusOK)
+}
+
+// GetSong godoc
+// @Summary      Get song
+// @Tags         songs
+// @Produce      json
+// @Param        songId   path   int64   true   "Song id"
+// @Success      200  {object}  songDTO
+// @Header       200  {string}  ETag  "Song version"
+// @Failure      400  {string}  string
+// @Failure      404  {string}  string
+// @Failure      500  {string}  string
+// @Router       /songs/{songId} [get]
+func (c *songsController) GetSong(w http.ResponseWriter, r *http.Request) {
+	songId, err := c.parseSongId(r)
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	song, err := c.songsService.GetSong(r.Context(), songId)
+	if errors.Is(err, ErrSongNotFound) {
+		c.notFound(w, r, err)
+		return
+	}
+	if err != nil {
+		c.serverError(w, r, err, "failed to get song")
+		return
+	}
+	w.Header().Set("ETag", songETag(song.Version))
+	c.json(w, r, toDTO(song), http.StatusOK)
+}
+
+// DeleteSong godoc
+// @Summary      Delete song
+// @Description  The song is moved to the trash and can be restored
+// @Description  until the trash is purged.
+// @Tags         songs
+// @Param        songId   path   int64   true   "Song id"
+// @Param        If-Match header string  false  "Song version"
+// @Param        X-Author header string  false  "Author of the change"
+// @Success      204  {string}  string
+// @Failure      400  {string}  string
+// @Failure      404  {string}  string
+// @Failure      412  {string}  string
+// @Failure      500  {string}  string
+// @Router       /songs/{songId} [delete]
+func (c *songsController) DeleteSong(w http.ResponseWriter, r *http.Request) {
+	songId, err := c.parseSongId(r)
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	version, err := c.ifMatchVersion(r, songId)
+	if err != nil {
+		c.ifMatchFailed(w, r, err)
+		return
+	}
+	author, err := c.parseAuthor(r)
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	if err := c.songsService.DeleteSong(r.Context(), songId, version, author); errors.Is(err, ErrSongNotFound) {
+		c.notFound(w, r, err)
+		return
+	} else if errors.Is(err, ErrSongVersionMismatch) {
+		c.preconditionFailed(w, r, err)
+		return
+	} else if err != nil {
+		c.serverError(w, r, err, "failed to delete song")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UpdateSong godoc
+// @Summary      Update song
+// @Description  Fields of the `application/json` body are updated if they are present and not null.
+// @Description  With `application/merge-patch+json` (RFC 7396) null removes the album fields
+// @Description  and clears the text and the link, `application/json-patch+json` (RFC 6902)
+// @Description  operations are applied to the song fields and single verses of the text,
+// @Description  e.g. `{"op": "add", "path": "/text/1", "value": "verse"}`.
+// @Description  A failed `test` operation results in the 409 status.
+// @Tags         songs
+// @Accept       json,application/merge-patch+json,application/json-patch+json
+// @Param        songId   path   int64         true  "Song id"
+// @Param        If-Match header string        false "Song version"
+// @Param        X-Author header string        false "Author of the change"
+// @Param        payload  body   updateSongDTO true  "Song data"
+// @Success      204  {string}  string
+// @Header       204  {string}  ETag  "New song version"
+// @Failure      400  {string}  string
+// @Failure      404  {string}  string
+// @Failure      409  {string}  string
+// @Failure      412  {string}  string
+// @Failure      415  {string}  string
+// @Failure      422  {string}  string
+// @Failure      500  {string}  string
+// @Router       /songs/{songId} [patch]
+func (c *songsController) UpdateSong(w http.ResponseWriter, r *http.Request) {
+	songId, err := c.parseSongId(r)
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	switch httpx.MediaType(r) {
+	case httpx.MergePatchMediaType:
+		p, httpErr := httpx.MergePatchBody(c.log.Logger, c.decoder, w, r)
+		if httpErr != nil {
+			http.Error(w, httpErr.Text, httpErr.Status)
+			return
+		}
+		c.patchSong(w, r, songId, p)
+		return
+	case httpx.JSONPatchMediaType:
+		p, httpErr := httpx.JSONPatchBody(c.log.Logger, c.decoder, w, r)
+		if httpErr != nil {
+			http.Error(w, httpErr.Text, httpErr.Status)
+			return
+		}
+		c.patchSong(w, r, songId, p)
+		return
+	}
+	u, httpErr := httpx.JSONBody[updateSongDTO](c.log.Logger, c.decoder, w, r)
+	if httpErr != nil {
+		http.Error(w, httpErr.Text, httpErr.Status)
+		return
+	}
+	upd, err := u.songUpdate()
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	if len(upd) == 0 {
+		c.badRequest(w, r, ErrNothingToUpdate)
+		return
+	}
+	version, err := c.ifMatchVersion(r, songId)
+	if err != nil {
+		c.ifMatchFailed(w, r, err)
+		return
+	}
+	author, err := c.parseAuthor(r)
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	c.updateSong(w, r, songId, version, upd, author)
+}
+
+func (c *songsController) updateSong(
+	w http.ResponseWriter,
+	r *http.Request,
+	songId int64,
+	version int64,
+	upd SongUpdate,
+	author string,
+) {
+	version, err := c.songsService.UpdateSong(r.Context(), songId, version, upd, author)
+	if errors.Is(err, ErrSongNotFound) {
+		c.notFound(w, r, err)
+		return
+	} else if errors.Is(err, ErrSongVersionMismatch) {
+		c.preconditionFailed(w, r, err)
+		return
+	} else if errors.Is(err, ErrAlbumNotFound) || errors.Is(err, ErrTrackWithoutAlbum) {
+		c.badRequest(w, r, err)
+		return
+	} else if errors.Is(err, ErrDuplicateSong) {
+		c.duplicateSong(w, r, err)
+		return
+	} else if errors.Is(err, ErrTrackIsTaken) {
+		c.conflict(w, r, err)
+		return
+	} else if err != nil {
+		c.serverError(w, r, err, "failed to update song")
+		return
+	}
+	w.Header().Set("ETag", songETag(version))
+	w.WriteHeader(http.StatusNoContent)
+}
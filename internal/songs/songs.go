@@ -1,27 +1,41 @@
 package songs
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"time"
 
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/x0k/effective-mobile-song-library-service/internal/lib/logger"
 	"github.com/x0k/effective-mobile-song-library-service/internal/lib/music_info"
 )
 
 func New(
+	ctx context.Context,
 	log *logger.Logger,
-	pgx *pgx.Conn,
+	pool *pgxpool.Pool,
 	musicInfoClient music_info.ClientWithResponsesInterface,
-) http.Handler {
+	filterMacros map[string]string,
+	trashRetention time.Duration,
+	idempotencyKeyTTL time.Duration,
+	importDateLayout string,
+) (http.Handler, error) {
 	songsRepo := newRepo(
 		log.With(slog.String("component", "songs_repo")),
-		pgx,
+		pool,
 	)
+	if err := songsRepo.defineFilterMacros(ctx, filterMacros); err != nil {
+		return nil, fmt.Errorf("failed to define filter macros: %w", err)
+	}
 
 	songsService := newService(
 		musicInfoClient,
 		songsRepo,
+		trashRetention,
+		importDateLayout,
 	)
 
 	songsController := newController(
@@ -29,5 +43,118 @@ func New(
 		songsService,
 	)
 
-	return newRouter(songsController)
+	artistsRepo := newArtistsRepo(
+		log.With(slog.String("component", "artists_repo")),
+		pool,
+	)
+
+	artistsService := newArtistsService(
+		artistsRepo,
+		songsRepo,
+	)
+
+	artistsController := newArtistsController(
+		log.With(slog.String("component", "artists_controller")),
+		artistsService,
+	)
+
+	albumsRepo := newAlbumsRepo(
+		log.With(slog.String("component", "albums_repo")),
+		pool,
+	)
+
+	albumsService := newAlbumsService(albumsRepo)
+
+	albumsController := newAlbumsController(
+		log.With(slog.String("component", "albums_controller")),
+		albumsService,
+	)
+
+	idempotencyRepo := newIdempotencyRepo(
+		log.With(slog.String("component", "idempotency_repo")),
+		pool,
+	)
+
+	idempotency := newIdempotency(
+		log.With(slog.String("component", "idempotency")),
+		idempotencyRepo,
+		idempotencyKeyTTL,
+	)
+
+	return newRouter(
+		songsController,
+		artistsController,
+		albumsController,
+		idempotency.Handler,
+	), nil
+}
+
+// Import creates songs from the CSV without the HTTP server,
+// the music info service is not used
+func Import(
+	ctx context.Context,
+	log *logger.Logger,
+	pool *pgxpool.Pool,
+	r io.Reader,
+	opts ImportOptions,
+	importDateLayout string,
+	author string,
+) (ImportResult, error) {
+	songsRepo := newRepo(
+		log.With(slog.String("component", "songs_repo")),
+		pool,
+	)
+	songsService := newService(nil, songsRepo, 0, importDateLayout)
+	return songsService.ImportSongs(ctx, r, opts, author)
+}
+
+// PurgeTrash permanently deletes songs that have been in the trash
+// longer than the retention period and returns their number
+func PurgeTrash(
+	ctx context.Context,
+	log *logger.Logger,
+	pool *pgxpool.Pool,
+	trashRetention time.Duration,
+) (int64, error) {
+	songsRepo := newRepo(
+		log.With(slog.String("component", "songs_repo")),
+		pool,
+	)
+	songsService := newService(nil, songsRepo, trashRetention, "")
+	return songsService.PurgeTrash(ctx)
+}
+
+// PurgeIdempotencyKeys deletes idempotency keys that are older
+// than the TTL and returns their number
+func PurgeIdempotencyKeys(
+	ctx context.Context,
+	log *logger.Logger,
+	pool *pgxpool.Pool,
+	keyTTL time.Duration,
+) (int64, error) {
+	idempotencyRepo := newIdempotencyRepo(
+		log.With(slog.String("component", "idempotency_repo")),
+		pool,
+	)
+	idempotency := newIdempotency(
+		log.With(slog.String("component", "idempotency")),
+		idempotencyRepo,
+		keyTTL,
+	)
+	return idempotency.PurgeKeys(ctx)
+}
+
+// RecountLyricsStats recounts statistics of the lyrics that were
+// approximated by the migration and returns the number of recounted songs
+func RecountLyricsStats(
+	ctx context.Context,
+	log *logger.Logger,
+	pool *pgxpool.Pool,
+) (int64, error) {
+	songsRepo := newRepo(
+		log.With(slog.String("component", "songs_repo")),
+		pool,
+	)
+	songsService := newService(nil, songsRepo, 0, "")
+	return songsService.RecountLyricsStats(ctx)
 }
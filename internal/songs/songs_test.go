@@ -3,10 +3,15 @@ package songs_test
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gavv/httpexpect/v2"
 	"github.com/x0k/effective-mobile-song-library-service/internal/lib/logger"
@@ -21,7 +26,15 @@ func TestSongs(t *testing.T) {
 	pgx := testutils.SetupPgx(ctx, log.Logger, t)
 	musicInfoClient := testutils.SetupMusicInfoClient(ctx, t)
 
-	router := songs.New(log, pgx, musicInfoClient)
+	if _, err := pgx.Exec(ctx, `INSERT INTO filter_macro (name, definition) VALUES ('@muse', 'EQ(group, "Muse")')`); err != nil {
+		t.Fatal(err)
+	}
+	router, err := songs.New(ctx, log, pgx, musicInfoClient, map[string]string{
+		"@modern": `GTE(releaseDate, DATE("01.01.2000"))`,
+	}, 0, 24*time.Hour, "")
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	server := httptest.NewServer(router)
 	defer server.Close()
@@ -37,13 +50,21 @@ func TestSongs(t *testing.T) {
 		JSON().IsEqual(map[string]any{
 		"id":          1,
 		"group":       "Muse",
+		"artistId":    1,
 		"song":        "Supermassive Black Hole",
 		"releaseDate": "16.07.2006",
 		"text": []string{
 			"Ooh baby, don't you know I suffer?\nOoh baby, can you hear me moan?\nYou caught me under false pretenses\nHow long before you let me go?",
 			"Ooh\nYou set my soul alight\nOoh\nYou set my soul alight",
 		},
-		"link": "https://www.youtube.com/watch?v=Xsp3_a-PMTw",
+		"link":            "https://www.youtube.com/watch?v=Xsp3_a-PMTw",
+		"verseCount":      2,
+		"lineCount":       8,
+		"wordCount":       39,
+		"uniqueWordCount": 24,
+		"artists": []map[string]any{
+			{"id": 1, "name": "Muse", "role": "primary"},
+		},
 	})
 
 	e.GET("/songs").
@@ -54,16 +75,85 @@ func TestSongs(t *testing.T) {
 		{
 			"id":          1,
 			"group":       "Muse",
+			"artistId":    1,
 			"song":        "Supermassive Black Hole",
 			"releaseDate": "16.07.2006",
 			"text": []string{
 				"Ooh baby, don't you know I suffer?\nOoh baby, can you hear me moan?\nYou caught me under false pretenses\nHow long before you let me go?",
 				"Ooh\nYou set my soul alight\nOoh\nYou set my soul alight",
 			},
-			"link": "https://www.youtube.com/watch?v=Xsp3_a-PMTw",
+			"link":            "https://www.youtube.com/watch?v=Xsp3_a-PMTw",
+			"verseCount":      2,
+			"lineCount":       8,
+			"wordCount":       39,
+			"uniqueWordCount": 24,
+			"artists": []map[string]any{
+				{"id": 1, "name": "Muse", "role": "primary"},
+			},
 		},
 	})
 
+	e.GET("/songs").
+		WithQuery("group", "Muse").
+		WithQuery("releaseDate[gte]", "01.01.2000").
+		WithQuery("text[like]", "%soul alight%").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Array().Length().IsEqual(1)
+
+	e.GET("/songs").
+		WithQuery("filter", `EQ(group, "Muse")`).
+		WithQuery("releaseDate[lt]", "01.01.2000").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Array().IsEmpty()
+
+	e.GET("/songs").
+		WithQuery("filter", `AND(@muse, @modern)`).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Array().Length().IsEqual(1)
+
+	e.GET("/songs").
+		WithQuery("filter", `AND(@unknown, @modern)`).
+		Expect().
+		Status(http.StatusBadRequest)
+
+	e.GET("/songs").
+		WithQuery("releaseDate[like]", "%2006%").
+		Expect().
+		Status(http.StatusBadRequest)
+
+	e.GET("/songs").
+		WithQuery("gruop", "Muse").
+		Expect().
+		Status(http.StatusBadRequest)
+
+	e.POST("/songs/query-by-example").
+		WithJSON(map[string]any{
+			"group": "Muse",
+			"text":  []string{"%moan%", "%soul alight%"},
+		}).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Array().Length().IsEqual(1)
+
+	e.POST("/songs/query-by-example").
+		WithJSON(map[string]any{
+			"group":       "Muse",
+			"releaseDate": "01.01.2000",
+		}).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Array().IsEmpty()
+
+	e.POST("/songs/query-by-example").
+		WithJSON(map[string]any{
+			"releaseDate": "2006-07-16",
+		}).
+		Expect().
+		Status(http.StatusBadRequest)
+
 	e.GET("/songs/1/lyrics").
 		WithQuery("page", "2").
 		WithQuery("pageSize", "1").
@@ -92,14 +182,1136 @@ func TestSongs(t *testing.T) {
 		{
 			"id":          1,
 			"group":       "group",
+			"artistId":    2,
 			"song":        "song",
 			"releaseDate": "08.08.2008",
 			"text":        []string{"text1", "text2"},
 			"link":        "link",
+			"artists": []map[string]any{
+				{"id": 2, "name": "group", "role": "primary"},
+			},
 		},
 	})
 
+	e.PUT("/songs/1/artists").
+		WithJSON([]map[string]any{
+			{"name": "Matt Bellamy", "role": "composer"},
+			{"name": "unknown", "role": "producer"},
+		}).
+		Expect().
+		Status(http.StatusBadRequest)
+
+	e.PUT("/songs/1/artists").
+		WithJSON([]map[string]any{
+			{"name": "Matt Bellamy", "role": "composer"},
+			{"name": "Matt Bellamy", "role": "lyricist"},
+		}).
+		Expect().
+		Status(http.StatusNoContent)
+
+	e.GET("/songs/1").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().Value("artists").IsEqual([]map[string]any{
+		{"id": 2, "name": "group", "role": "primary"},
+		{"id": 3, "name": "Matt Bellamy", "role": "composer"},
+		{"id": 3, "name": "Matt Bellamy", "role": "lyricist"},
+	})
+
+	e.GET("/songs").
+		WithQuery("filter", `AND(ARTIST("primary", "group"), ARTIST("lyricist", "Matt Bellamy"))`).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Array().Length().IsEqual(1)
+
+	e.GET("/songs").
+		WithQuery("filter", `ARTIST("featured", "Matt Bellamy")`).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Array().Length().IsEqual(0)
+
+	e.PUT("/songs/2/artists").
+		WithJSON([]map[string]any{}).
+		Expect().
+		Status(http.StatusNotFound)
+
+	e.GET("/songs/1").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().HasValue("song", "song")
+
+	e.POST("/albums").
+		WithJSON(map[string]any{
+			"title":       "album",
+			"artistId":    2,
+			"releaseDate": "08.08.2008",
+			"cover":       "cover",
+		}).
+		Expect().
+		Status(http.StatusCreated).
+		JSON().IsEqual(map[string]any{
+		"id":          1,
+		"title":       "album",
+		"group":       "group",
+		"artistId":    2,
+		"releaseDate": "08.08.2008",
+		"cover":       "cover",
+	})
+
+	e.PATCH("/songs/1").
+		WithJSON(map[string]any{
+			"trackNumber": 1,
+		}).
+		Expect().
+		Status(http.StatusBadRequest)
+
+	e.PATCH("/songs/1").
+		WithJSON(map[string]any{
+			"albumId":     1,
+			"discNumber":  1,
+			"trackNumber": 1,
+		}).
+		Expect().
+		Status(http.StatusNoContent)
+
+	e.GET("/albums/1/tracks").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Array().Value(0).Object().
+		HasValue("id", 1).
+		HasValue("album", "album").
+		HasValue("discNumber", 1).
+		HasValue("trackNumber", 1)
+
+	e.GET("/songs").
+		WithQuery("album", "album").
+		WithQuery("trackNumber[lte]", 1).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Array().Length().IsEqual(1)
+
+	e.DELETE("/albums/1").
+		Expect().
+		Status(http.StatusNoContent)
+
+	e.GET("/albums/1/tracks").
+		Expect().
+		Status(http.StatusNotFound)
+
+	e.GET("/songs/1").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().NotContainsKey("albumId")
+
+	albumRevisions := e.GET("/songs/1/revisions").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Array()
+	albumRevisions.Value(int(albumRevisions.Length().Raw())-1).Object().
+		HasValue("action", "update").
+		HasValue("fields", []string{"albumId", "discNumber", "trackNumber"})
+
+	e.GET("/artists/2").
+		Expect().
+		Status(http.StatusOK).
+		JSON().IsEqual(map[string]any{
+		"id":   2,
+		"name": "group",
+	})
+
+	e.GET("/artists/2/songs").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Array().Length().IsEqual(1)
+
+	e.GET("/artists/1/songs").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Array().Length().IsEqual(0)
+
+	e.PATCH("/artists/2").
+		WithJSON(map[string]any{
+			"name": "Muse",
+		}).
+		Expect().
+		Status(http.StatusConflict)
+
+	e.DELETE("/artists/2").
+		Expect().
+		Status(http.StatusConflict)
+
+	e.DELETE("/artists/1").
+		Expect().
+		Status(http.StatusNoContent)
+
+	e.GET("/artists/1").
+		Expect().
+		Status(http.StatusNotFound)
+
+	e.GET("/artists/1/songs").
+		Expect().
+		Status(http.StatusNotFound)
+
+	// The song is restored later, when there is another song with the same title
+	e.PATCH("/songs/1").
+		WithJSON(map[string]any{
+			"song": "Supermassive Black Hole (Demo)",
+		}).
+		Expect().
+		Status(http.StatusNoContent)
+
+	e.DELETE("/songs/1").
+		Expect().
+		Status(http.StatusNoContent)
+
+	e.GET("/songs/1").
+		Expect().
+		Status(http.StatusNotFound)
+
+	e.GET("/songs/1/lyrics").
+		Expect().
+		Status(http.StatusNotFound)
+
+	e.PATCH("/songs/1").
+		WithJSON(map[string]any{
+			"song": "song",
+		}).
+		Expect().
+		Status(http.StatusNotFound)
+
+	e.PATCH("/songs/1").
+		WithJSON(map[string]any{
+			"group": "Nobody",
+		}).
+		Expect().
+		Status(http.StatusNotFound)
+
+	e.GET("/artists").
+		Expect().
+		Status(http.StatusOK).
+		Body().NotContains("Nobody")
+
 	e.DELETE("/songs/1").
+		Expect().
+		Status(http.StatusNotFound)
+
+	e.POST("/artists").
+		WithJSON(map[string]any{
+			"name": "Muse",
+		}).
+		Expect().
+		Status(http.StatusCreated).
+		JSON().Object().HasValue("id", 4)
+
+	e.POST("/artists").
+		WithJSON(map[string]any{
+			"name": "MUSE",
+		}).
+		Expect().
+		Status(http.StatusConflict)
+
+	e.POST("/songs").
+		WithJSON(map[string]string{
+			"song":  "Supermassive Black Hole",
+			"group": "the  muse",
+		}).
+		Expect().
+		Status(http.StatusCreated).
+		JSON().Object().
+		HasValue("group", "Muse").
+		HasValue("artistId", 4)
+
+	e.GET("/songs").
+		WithQuery("filter", `EQ(group, "ＭＵＳＥ")`).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Array().Length().IsEqual(1)
+
+	e.POST("/artists/3/aliases").
+		WithJSON(map[string]any{
+			"name": "The Muse",
+		}).
+		Expect().
+		Status(http.StatusConflict)
+
+	e.POST("/artists/3/aliases").
+		WithJSON(map[string]any{
+			"name": "Matthew Bellamy",
+		}).
+		Expect().
+		Status(http.StatusCreated).
+		JSON().IsEqual(map[string]any{
+		"key":  "matthew bellamy",
+		"name": "Matthew Bellamy",
+	})
+
+	e.POST("/artists/4/merge").
+		WithJSON(map[string]any{
+			"artistId": 4,
+		}).
+		Expect().
+		Status(http.StatusBadRequest)
+
+	e.POST("/artists/4/merge").
+		WithJSON(map[string]any{
+			"artistId": 3,
+		}).
+		Expect().
+		Status(http.StatusNoContent)
+
+	e.GET("/artists/3").
+		Expect().
+		Status(http.StatusNotFound)
+
+	e.GET("/artists/4/aliases").
+		Expect().
+		Status(http.StatusOK).
+		JSON().IsEqual([]map[string]any{
+		{"key": "matt bellamy", "name": "Matt Bellamy"},
+		{"key": "matthew bellamy", "name": "Matthew Bellamy"},
+		{"key": "muse", "name": "Muse"},
+	})
+
+	e.GET("/songs").
+		WithQuery("group", "Matthew Bellamy").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Array().Length().IsEqual(1)
+
+	e.PATCH("/songs/2").
+		WithJSON(map[string]any{
+			"song": "Supermassive Black Hole (Live)",
+		}).
 		Expect().
 		Status(http.StatusNoContent)
+
+	e.POST("/songs").
+		WithJSON(map[string]string{
+			"song":  "Supermassive Black Hole",
+			"group": "Muse",
+		}).
+		Expect().
+		Status(http.StatusCreated).
+		JSON().Object().HasValue("id", 3)
+
+	res := e.GET("/songs").
+		WithQuery("pageSize", 1).
+		WithQuery("envelope", true).
+		Expect().
+		Status(http.StatusOK)
+	res.Header("X-Total-Count").IsEqual("2")
+	res.Header("Link").IsEqual(`</songs?envelope=true&pageSize=1>; rel="first", </songs?envelope=true&lastId=2&pageSize=1>; rel="next"`)
+	res.JSON().Object().
+		HasValue("total", 2).
+		HasValue("nextCursor", 2).
+		Value("items").Array().Length().IsEqual(1)
+
+	res = e.GET("/songs").
+		WithQuery("pageSize", 1).
+		WithQuery("lastId", 2).
+		WithQuery("envelope", true).
+		Expect().
+		Status(http.StatusOK)
+	res.Header("X-Total-Count").IsEmpty()
+	res.Header("Link").IsEqual(`</songs?envelope=true&pageSize=1>; rel="first"`)
+	res.JSON().Object().
+		NotContainsKey("total").
+		HasValue("nextCursor", nil).
+		Value("items").Array().Value(0).Object().HasValue("id", 3)
+
+	res = e.GET("/songs").
+		WithQuery("page", 2).
+		WithQuery("pageSize", 1).
+		WithQuery("group", "Muse").
+		WithQuery("total", true).
+		Expect().
+		Status(http.StatusOK)
+	res.Header("X-Total-Count").IsEqual("2")
+	res.Header("Link").IsEqual(`</songs?group=Muse&page=1&pageSize=1&total=true>; rel="first", </songs?group=Muse&page=1&pageSize=1&total=true>; rel="prev", </songs?group=Muse&page=2&pageSize=1&total=true>; rel="last"`)
+	res.JSON().Array().Length().IsEqual(1)
+
+	res = e.GET("/songs").
+		WithQuery("page", 1).
+		WithQuery("pageSize", 1).
+		Expect().
+		Status(http.StatusOK)
+	res.Header("X-Total-Count").IsEmpty()
+	res.Header("Link").IsEqual(`</songs?page=1&pageSize=1>; rel="first", </songs?page=2&pageSize=1>; rel="next"`)
+	res.JSON().Array().Length().IsEqual(1)
+
+	e.GET("/songs").
+		WithQuery("lastId", 2).
+		WithQuery("fields", "song,group").
+		Expect().
+		Status(http.StatusOK).
+		JSON().IsEqual([]map[string]any{
+		{"id": 3, "song": "Supermassive Black Hole", "group": "Muse"},
+	})
+
+	e.GET("/songs").
+		WithQuery("lastId", 2).
+		WithQuery("fields", "artists").
+		WithQuery("envelope", true).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().Value("items").IsEqual([]map[string]any{
+		{"id": 3, "artists": []map[string]any{{"id": 4, "name": "Muse", "role": "primary"}}},
+	})
+
+	e.GET("/songs").
+		WithQuery("fields", "text,lyrics").
+		Expect().
+		Status(http.StatusBadRequest)
+
+	e.GET("/songs/3").
+		Expect().
+		Status(http.StatusOK).
+		Header("ETag").IsEqual(`"1"`)
+
+	e.PATCH("/songs/3").
+		WithHeader("If-Match", `"2"`).
+		WithJSON(map[string]any{
+			"link": "link",
+		}).
+		Expect().
+		Status(http.StatusPreconditionFailed)
+
+	e.PATCH("/songs/3").
+		WithHeader("If-Match", `"1"`).
+		WithJSON(map[string]any{
+			"link": "link",
+		}).
+		Expect().
+		Status(http.StatusNoContent).
+		Header("ETag").IsEqual(`"2"`)
+
+	e.DELETE("/songs/3").
+		WithHeader("If-Match", `"1"`).
+		Expect().
+		Status(http.StatusPreconditionFailed)
+
+	e.DELETE("/songs/3").
+		WithHeader("If-Match", "1").
+		Expect().
+		Status(http.StatusBadRequest)
+
+	e.DELETE("/songs/3").
+		WithHeader("If-Match", `W/"2"`).
+		Expect().
+		Status(http.StatusPreconditionFailed)
+
+	e.DELETE("/songs/3").
+		WithHeader("If-Match", `"1", W/"2"`).
+		Expect().
+		Status(http.StatusPreconditionFailed)
+
+	trash := e.GET("/songs/trash").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Array()
+	trash.Length().IsEqual(1)
+	trash.Value(0).Object().
+		HasValue("id", 1).
+		ContainsKey("deletedAt")
+
+	e.POST("/songs/1/restore").
+		Expect().
+		Status(http.StatusNoContent)
+
+	e.POST("/songs/1/restore").
+		Expect().
+		Status(http.StatusNotFound)
+
+	e.GET("/songs/1").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().NotContainsKey("deletedAt")
+
+	e.DELETE("/songs/1").
+		Expect().
+		Status(http.StatusNoContent)
+
+	e.DELETE("/songs/trash").
+		Expect().
+		Status(http.StatusOK).
+		JSON().IsEqual(map[string]any{"purged": 1})
+
+	e.GET("/songs/trash").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Array().IsEmpty()
+
+	e.POST("/songs/1/restore").
+		Expect().
+		Status(http.StatusNotFound)
+
+	revisions := e.GET("/songs/3/revisions").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Array()
+	revisions.Length().IsEqual(2)
+	revisions.Value(0).Object().
+		HasValue("revision", 1).
+		HasValue("action", "create")
+	revisions.Value(1).Object().
+		HasValue("revision", 2).
+		HasValue("action", "update").
+		HasValue("fields", []string{"link"})
+
+	e.PATCH("/songs/3").
+		WithHeader("X-Author", "editor").
+		WithJSON(map[string]any{
+			"text": []string{
+				"Ooh\nYou set my soul alight\nOoh\nYou set my soul alight",
+				"Glaciers melting in the dead of night",
+			},
+		}).
+		Expect().
+		Status(http.StatusNoContent).
+		Header("ETag").IsEqual(`"3"`)
+
+	revision := e.GET("/songs/3/revisions/3").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object()
+	revision.
+		HasValue("author", "editor").
+		HasValue("action", "update")
+	revision.Value("changes").Object().Keys().ContainsOnly("text")
+	revision.Value("textDiff").IsEqual([]map[string]any{
+		{"op": "delete", "oldIndex": 0, "text": "Ooh baby, don't you know I suffer?\nOoh baby, can you hear me moan?\nYou caught me under false pretenses\nHow long before you let me go?"},
+		{"op": "equal", "oldIndex": 1, "newIndex": 0, "text": "Ooh\nYou set my soul alight\nOoh\nYou set my soul alight"},
+		{"op": "insert", "newIndex": 1, "text": "Glaciers melting in the dead of night"},
+	})
+
+	e.POST("/songs/3/revisions/1/revert").
+		WithHeader("If-Match", `"2", "3"`).
+		Expect().
+		Status(http.StatusNoContent).
+		Header("ETag").IsEqual(`"4"`)
+
+	e.GET("/songs/3").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().
+		HasValue("link", "https://www.youtube.com/watch?v=Xsp3_a-PMTw").
+		Value("text").Array().Length().IsEqual(2)
+
+	e.GET("/songs/3/revisions/4").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().
+		HasValue("action", "revert").
+		Value("changes").Object().Keys().ContainsOnly("text", "link")
+
+	e.POST("/songs/3/revisions/10/revert").
+		Expect().
+		Status(http.StatusNotFound)
+
+	e.GET("/songs/1/revisions").
+		Expect().
+		Status(http.StatusNotFound)
+
+	e.DELETE("/songs/3").
+		WithHeader("If-Match", "*").
+		Expect().
+		Status(http.StatusNoContent)
+
+	batch := e.POST("/songs:batch").
+		WithHeader("Content-Type", "application/x-ndjson").
+		WithText(strings.Join([]string{
+			`{"group": "Muse", "song": "Supermassive Black Hole"}`,
+			`{"group": "Muse"`,
+			``,
+			`{"group": " ", "song": "Supermassive Black Hole"}`,
+		}, "\n")).
+		Expect().
+		Status(http.StatusOK)
+	batch.Header("Content-Type").IsEqual("application/x-ndjson")
+	results := map[int]map[string]any{}
+	for _, line := range strings.Split(strings.TrimSpace(batch.Body().Raw()), "\n") {
+		var res map[string]any
+		if err := json.Unmarshal([]byte(line), &res); err != nil {
+			t.Fatal(err)
+		}
+		results[int(res["line"].(float64))] = res
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %v", results)
+	}
+	if _, ok := results[1]["id"]; !ok {
+		t.Fatalf("expected id for line 1, got %v", results[1])
+	}
+	for _, line := range []int{2, 4} {
+		if _, ok := results[line]["error"]; !ok {
+			t.Fatalf("expected error for line %d, got %v", line, results[line])
+		}
+	}
+	batchSongPath := fmt.Sprintf("/songs/%d", int64(results[1]["id"].(float64)))
+	e.GET(batchSongPath).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().
+		HasValue("group", "Muse").
+		HasValue("song", "Supermassive Black Hole")
+
+	export := e.GET("/songs/export").
+		WithQuery("group", "Muse").
+		Expect().
+		Status(http.StatusOK)
+	export.Header("Content-Type").IsEqual("application/x-ndjson")
+	exported := strings.Split(strings.TrimSpace(export.Body().Raw()), "\n")
+	if len(exported) == 0 {
+		t.Fatal("expected exported songs")
+	}
+	for _, line := range exported {
+		var song map[string]any
+		if err := json.Unmarshal([]byte(line), &song); err != nil {
+			t.Fatal(err)
+		}
+		if song["group"] != "Muse" {
+			t.Fatalf("unexpected song %v", song)
+		}
+	}
+
+	csvExport := e.GET("/songs/export").
+		WithQuery("format", "csv").
+		WithQuery("filter", `EQ(group, "Muse")`).
+		Expect().
+		Status(http.StatusOK)
+	csvExport.Header("Content-Type").IsEqual("text/csv; charset=utf-8")
+	csvExport.Body().
+		HasPrefix("id,song,group,artistId,releaseDate,text,link,albumId,album,discNumber,trackNumber,artists\n").
+		Contains("primary:Muse")
+
+	e.GET("/songs/export").
+		WithQuery("format", "xml").
+		Expect().
+		Status(http.StatusBadRequest)
+
+	e.GET("/songs/export").
+		WithQuery("filter", "EQ(").
+		Expect().
+		Status(http.StatusBadRequest)
+
+	spreadsheet := "Title,Artist,Released,Lyrics\n" +
+		"Uprising,Muse,2009-09-07,\"The paranoia is in bloom\r\n\r\n\r\nThey will not force us\"\n" +
+		"Starlight,Muse,2006-09-04,\n"
+	e.POST("/songs/import").
+		WithHeader("Content-Type", "text/csv").
+		WithQuery("column[song]", "Title").
+		WithQuery("column[group]", "Artist").
+		WithQuery("column[releaseDate]", "Released").
+		WithQuery("column[text]", "Lyrics").
+		WithQuery("dateLayout", "2006-01-02").
+		WithQuery("dryRun", true).
+		WithText(spreadsheet).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().
+		HasValue("dryRun", true).
+		HasValue("rows", 2).
+		NotContainsKey("ids")
+
+	e.POST("/songs/import").
+		WithHeader("Content-Type", "text/csv").
+		WithText("song,group,releaseDate\nUprising,,07.09.2009\nStarlight,Muse,2006-09-04\n").
+		Expect().
+		Status(http.StatusUnprocessableEntity).
+		JSON().Object().
+		HasValue("rows", 0).
+		Value("errors").Array().Length().IsEqual(2)
+
+	e.POST("/songs/import").
+		WithHeader("Content-Type", "text/csv").
+		WithText("song,group\nUprising,Muse\n").
+		Expect().
+		Status(http.StatusBadRequest)
+
+	imported := e.POST("/songs/import").
+		WithHeader("Content-Type", "text/csv").
+		WithQuery("column[song]", "Title").
+		WithQuery("column[group]", "Artist").
+		WithQuery("column[releaseDate]", "Released").
+		WithQuery("column[text]", "Lyrics").
+		WithQuery("dateLayout", "2006-01-02").
+		WithText(spreadsheet).
+		Expect().
+		Status(http.StatusCreated).
+		JSON().Object()
+	imported.Value("ids").Array().Length().IsEqual(2)
+
+	e.GET(fmt.Sprintf("/songs/%d", int64(imported.Value("ids").Array().Value(0).Number().Raw()))).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().
+		HasValue("song", "Uprising").
+		HasValue("group", "Muse").
+		HasValue("releaseDate", "07.09.2009").
+		HasValue("text", []string{"The paranoia is in bloom", "They will not force us"})
+
+	e.DELETE(batchSongPath).
+		Expect().
+		Status(http.StatusNoContent)
+
+	created := e.POST("/songs").
+		WithHeader("Idempotency-Key", "create-muse").
+		WithJSON(map[string]string{
+			"song":  "Supermassive Black Hole",
+			"group": "Muse",
+		}).
+		Expect().
+		Status(http.StatusCreated).
+		JSON().Object()
+	createdId := created.Value("id").Number().Raw()
+
+	replayed := e.POST("/songs").
+		WithHeader("Idempotency-Key", "create-muse").
+		WithJSON(map[string]string{
+			"song":  "Supermassive Black Hole",
+			"group": "Muse",
+		}).
+		Expect().
+		Status(http.StatusCreated)
+	replayed.Header("Idempotent-Replayed").IsEqual("true")
+	replayed.JSON().Object().HasValue("id", createdId)
+
+	e.POST("/songs").
+		WithHeader("Idempotency-Key", "create-muse").
+		WithJSON(map[string]string{
+			"song":  "Uprising",
+			"group": "Muse",
+		}).
+		Expect().
+		Status(http.StatusUnprocessableEntity)
+
+	e.GET("/songs").
+		WithQuery("filter", fmt.Sprintf("GT(id, %d)", int64(createdId))).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Array().Length().IsEqual(0)
+
+	purged, err := songs.PurgeIdempotencyKeys(ctx, log, pgx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged == 0 {
+		t.Fatal("expected expired idempotency keys to be purged")
+	}
+
+	e.POST("/songs").
+		WithHeader("Idempotency-Key", "create-muse").
+		WithJSON(map[string]string{
+			"song":  "Supermassive Black Hole",
+			"group": "Muse",
+		}).
+		Expect().
+		Status(http.StatusConflict).
+		Headers().NotContainsKey("Idempotent-Replayed")
+
+	duplicate := e.POST("/songs").
+		WithJSON(map[string]string{
+			"song":  "Supermassive Black Hole",
+			"group": "Muse",
+		}).
+		Expect().
+		Status(http.StatusConflict)
+	duplicate.Header("Location").IsEqual(fmt.Sprintf("/songs/%d", int64(createdId)))
+	duplicate.JSON().Object().HasValue("id", createdId)
+
+	// The reservation of an interrupted request is taken over after its lease
+	interruptedBody := []byte(`{"group":"Muse","song":"Supermassive Black Hole"}`)
+	interruptedHash := sha256.Sum256(append([]byte("POST\x00/songs\x00"), interruptedBody...))
+	if _, err := pgx.Exec(ctx, `INSERT INTO idempotency_key (key, request_hash) VALUES ('interrupted', $1)`, interruptedHash[:]); err != nil {
+		t.Fatal(err)
+	}
+	e.POST("/songs").
+		WithHeader("Idempotency-Key", "interrupted").
+		WithHeader("Content-Type", "application/json").
+		WithBytes(interruptedBody).
+		Expect().
+		Status(http.StatusConflict).
+		Body().Contains("in progress")
+	if _, err := pgx.Exec(ctx, `UPDATE idempotency_key SET reserved_at = now() - interval '1 hour' WHERE key = 'interrupted'`); err != nil {
+		t.Fatal(err)
+	}
+	e.POST("/songs").
+		WithHeader("Idempotency-Key", "interrupted").
+		WithHeader("Content-Type", "application/json").
+		WithBytes(interruptedBody).
+		Expect().
+		Status(http.StatusConflict).
+		JSON().Object().HasValue("id", createdId)
+
+	e.PATCH("/songs/2").
+		WithJSON(map[string]any{
+			"song": "supermassive  BLACK hole",
+		}).
+		Expect().
+		Status(http.StatusConflict).
+		JSON().Object().HasValue("id", createdId)
+
+	e.POST("/songs/3/restore").
+		Expect().
+		Status(http.StatusConflict).
+		JSON().Object().HasValue("id", createdId)
+
+	createdPath := fmt.Sprintf("/songs/%d/merge", int64(createdId))
+	e.POST(createdPath).
+		WithJSON(map[string]any{"songId": createdId}).
+		Expect().
+		Status(http.StatusBadRequest)
+
+	e.POST(createdPath).
+		WithJSON(map[string]any{"songId": 1}).
+		Expect().
+		Status(http.StatusNotFound)
+
+	e.POST(createdPath).
+		WithJSON(map[string]any{"songId": 2}).
+		Expect().
+		Status(http.StatusConflict)
+
+	e.POST(createdPath).
+		WithHeader("If-Match", `"2"`).
+		WithJSON(map[string]any{"songId": 3}).
+		Expect().
+		Status(http.StatusPreconditionFailed)
+
+	e.POST(createdPath).
+		WithHeader("X-Author", "editor").
+		WithHeader("If-Match", `"1"`).
+		WithJSON(map[string]any{"songId": 3}).
+		Expect().
+		Status(http.StatusNoContent).
+		Header("ETag").IsEqual(`"1"`)
+
+	e.GET("/songs/2").
+		Expect().
+		Status(http.StatusOK)
+
+	e.GET("/songs/trash").
+		WithQuery("id", 3).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Array().Length().IsEqual(1)
+
+	lyricsPath := fmt.Sprintf("/songs/%d/lyrics", int64(createdId))
+	e.PUT(lyricsPath+"/0").
+		WithHeader("If-Match", `"1"`).
+		WithJSON(map[string]any{"text": "First"}).
+		Expect().
+		Status(http.StatusNoContent).
+		Header("ETag").IsEqual(`"2"`)
+
+	e.PUT(lyricsPath+"/0").
+		WithHeader("If-Match", `"1"`).
+		WithJSON(map[string]any{"text": "Stale"}).
+		Expect().
+		Status(http.StatusPreconditionFailed)
+
+	e.POST(lyricsPath + "/2").
+		WithJSON(map[string]any{"text": "Last"}).
+		Expect().
+		Status(http.StatusNoContent)
+
+	e.POST(lyricsPath + "/0").
+		WithJSON(map[string]any{"from": 2}).
+		Expect().
+		Status(http.StatusNoContent)
+
+	e.DELETE(lyricsPath + "/1").
+		Expect().
+		Status(http.StatusNoContent).
+		Header("ETag").IsEqual(`"5"`)
+
+	e.GET(lyricsPath).
+		Expect().
+		Status(http.StatusOK).
+		JSON().IsEqual([]string{
+		"Last",
+		"Ooh\nYou set my soul alight\nOoh\nYou set my soul alight",
+	})
+
+	e.DELETE(lyricsPath + "/2").
+		Expect().
+		Status(http.StatusNotFound)
+
+	e.POST(lyricsPath + "/3").
+		WithJSON(map[string]any{"text": "Gap"}).
+		Expect().
+		Status(http.StatusNotFound)
+
+	e.POST(lyricsPath + "/0").
+		WithJSON(map[string]any{"from": 2}).
+		Expect().
+		Status(http.StatusNotFound)
+
+	e.PUT(lyricsPath + "/-1").
+		WithJSON(map[string]any{"text": "Negative"}).
+		Expect().
+		Status(http.StatusBadRequest)
+
+	e.PUT(lyricsPath + "/0").
+		WithJSON(map[string]any{"text": " "}).
+		Expect().
+		Status(http.StatusBadRequest)
+
+	songPath := fmt.Sprintf("/songs/%d", int64(createdId))
+	e.PATCH(songPath).
+		WithHeader("If-Match", `"5"`).
+		WithHeader("Content-Type", "application/merge-patch+json").
+		WithBytes([]byte(`{"link": null, "text": ["A", "B"]}`)).
+		Expect().
+		Status(http.StatusNoContent).
+		Header("ETag").IsEqual(`"6"`)
+
+	patched := e.GET(songPath).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object()
+	patched.HasValue("link", "")
+	patched.HasValue("text", []string{"A", "B"})
+
+	e.PATCH(songPath).
+		WithHeader("Content-Type", "application/json-patch+json").
+		WithBytes([]byte(`[
+			{"op": "test", "path": "/text/0", "value": "A"},
+			{"op": "replace", "path": "/text/1", "value": "C"},
+			{"op": "add", "path": "/text/-", "value": "D"}
+		]`)).
+		Expect().
+		Status(http.StatusNoContent).
+		Header("ETag").IsEqual(`"7"`)
+
+	e.GET(lyricsPath).
+		Expect().
+		Status(http.StatusOK).
+		JSON().IsEqual([]string{"A", "C", "D"})
+
+	e.PATCH(songPath).
+		WithHeader("Content-Type", "application/json-patch+json").
+		WithHeader("If-Match", `"7"`).
+		WithBytes([]byte(`[
+			{"op": "test", "path": "/text/2", "value": "D"},
+			{"op": "move", "from": "/text/2", "path": "/text/0"}
+		]`)).
+		Expect().
+		Status(http.StatusNoContent).
+		Header("ETag").IsEqual(`"8"`)
+
+	e.GET(lyricsPath).
+		Expect().
+		Status(http.StatusOK).
+		JSON().IsEqual([]string{"D", "A", "C"})
+
+	e.PATCH(songPath).
+		WithHeader("Content-Type", "application/json-patch+json").
+		WithBytes([]byte(`[{"op": "test", "path": "/text/0", "value": "B"}]`)).
+		Expect().
+		Status(http.StatusConflict)
+
+	e.PATCH(songPath).
+		WithHeader("Content-Type", "application/json-patch+json").
+		WithBytes([]byte(`[{"op": "test", "path": "/song", "value": "Supermassive Black Hole"}]`)).
+		Expect().
+		Status(http.StatusNoContent).
+		Header("ETag").IsEqual(`"8"`)
+
+	e.PATCH(songPath).
+		WithHeader("Content-Type", "application/json-patch+json").
+		WithBytes([]byte(`[{"op": "remove", "path": "/song"}]`)).
+		Expect().
+		Status(http.StatusUnprocessableEntity)
+
+	e.PATCH(songPath).
+		WithHeader("Content-Type", "application/json-patch+json").
+		WithBytes([]byte(`[{"op": "remove", "path": "/text/5"}]`)).
+		Expect().
+		Status(http.StatusUnprocessableEntity)
+
+	e.PATCH(songPath).
+		WithHeader("Content-Type", "application/json-patch+json").
+		WithBytes([]byte(`[{"op": "add", "path": "/text/0"}]`)).
+		Expect().
+		Status(http.StatusBadRequest)
+
+	e.PATCH(songPath).
+		WithHeader("Content-Type", "application/merge-patch+json").
+		WithBytes([]byte(`{"id": 1}`)).
+		Expect().
+		Status(http.StatusUnprocessableEntity)
+
+	e.PATCH(songPath).
+		WithHeader("Content-Type", "text/plain").
+		WithBytes([]byte(`song`)).
+		Expect().
+		Status(http.StatusUnsupportedMediaType)
+
+	search := e.GET("/songs/search/lyrics").
+		WithQuery("q", "c").
+		WithQuery("filter", `EQ(group, "Muse")`).
+		WithQuery("total", true).
+		Expect().
+		Status(http.StatusOK)
+	search.Header("X-Total-Count").IsEqual("1")
+	matches := search.JSON().Array()
+	matches.Length().IsEqual(1)
+	match := matches.Value(0).Object()
+	match.Value("song").Object().HasValue("id", createdId)
+	match.HasValue("verse", 2)
+	match.HasValue("snippet", "<mark>C</mark>")
+
+	uncounted := e.GET("/songs/search/lyrics").
+		WithQuery("q", "c -d").
+		Expect().
+		Status(http.StatusOK)
+	uncounted.Headers().NotContainsKey("X-Total-Count")
+	uncounted.JSON().Array().Value(0).Object().HasValue("verse", 2)
+
+	e.PUT(lyricsPath + "/0").
+		WithJSON(map[string]any{"text": `<img src=x onerror="alert(1)"> D & E`}).
+		Expect().
+		Status(http.StatusNoContent)
+
+	snippet := e.GET("/songs/search/lyrics").
+		WithQuery("q", "onerror").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Array().Value(0).Object().
+		Value("snippet").String()
+	snippet.Contains("&lt;img")
+	snippet.Contains("<mark>onerror</mark>")
+	snippet.NotContains("<img")
+	snippet.NotContains(`"`)
+
+	e.PUT(lyricsPath + "/0").
+		WithJSON(map[string]any{"text": "D"}).
+		Expect().
+		Status(http.StatusNoContent)
+
+	e.GET("/songs/search/lyrics").
+		WithQuery("q", " ").
+		Expect().
+		Status(http.StatusBadRequest)
+
+	e.GET("/songs/search/lyrics").
+		WithQuery("q", "c").
+		WithQuery("lastId", 1).
+		Expect().
+		Status(http.StatusBadRequest)
+
+	stats := e.GET("/songs").
+		WithQuery("filter", `AND(GT(verseCount, 2), EQ(uniqueWordCount, 3))`).
+		WithQuery("fields", "verseCount,lineCount,wordCount,uniqueWordCount").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Array()
+	stats.Length().IsEqual(1)
+	stats.Value(0).Object().IsEqual(map[string]any{
+		"id":              createdId,
+		"verseCount":      3,
+		"lineCount":       3,
+		"wordCount":       3,
+		"uniqueWordCount": 3,
+	})
+
+	if _, err := pgx.Exec(ctx, `UPDATE song SET word_count = 0 WHERE id = $1`, int64(createdId)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pgx.Exec(ctx, `INSERT INTO lyrics_stats_recount (song_id) VALUES ($1)`, int64(createdId)); err != nil {
+		t.Fatal(err)
+	}
+	outdated := e.GET(songPath).
+		Expect().
+		Status(http.StatusOK)
+	outdated.JSON().Object().HasValue("wordCount", 0)
+	recounted, err := songs.RecountLyricsStats(ctx, log, pgx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recounted != 1 {
+		t.Fatalf("expected 1 recounted song, got %d", recounted)
+	}
+	recountedSong := e.GET(songPath).
+		Expect().
+		Status(http.StatusOK)
+	recountedSong.Header("ETag").IsEqual(outdated.Header("ETag").Raw())
+	recountedSong.JSON().Object().HasValue("wordCount", 3)
+
+	e.DELETE(lyricsPath + "/0").
+		Expect().
+		Status(http.StatusNoContent)
+
+	e.GET(songPath).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().
+		HasValue("verseCount", 2).
+		HasValue("wordCount", 2)
+
+	lrcPath := fmt.Sprintf("/songs/%d/lyrics.lrc", int64(createdId))
+	e.GET(lrcPath).
+		Expect().
+		Status(http.StatusNotFound)
+
+	timedVersion := e.PUT(lrcPath).
+		WithHeader("Content-Type", "text/plain").
+		WithBytes([]byte("[ti:Ignored]\n[offset:500]\n[00:12.50]Ooh\n[00:15.00]You set my soul alight\n[00:20.00]\n[00:21.00]Ooh")).
+		Expect().
+		Status(http.StatusNoContent).
+		Header("ETag").Raw()
+	timedRevisionPath := fmt.Sprintf("/songs/%d/revisions/%s", int64(createdId), strings.Trim(timedVersion, `"`))
+
+	e.GET(timedRevisionPath).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().
+		Value("changes").Object().
+		Value("lineTimes").Object().
+		HasValue("after", []int{12000, 14500, 20500})
+
+	lrc := e.GET(lrcPath).
+		Expect().
+		Status(http.StatusOK)
+	lrc.Header("Content-Disposition").IsEqual(fmt.Sprintf(`attachment; filename="%d.lrc"`, int64(createdId)))
+	lrc.Body().Contains("\n\n[00:12.00]Ooh\n[00:14.50]You set my soul alight\n\n[00:20.50]Ooh\n")
+
+	e.GET(lyricsPath).
+		Expect().
+		Status(http.StatusOK).
+		JSON().IsEqual([]string{"Ooh\nYou set my soul alight", "Ooh"})
+
+	e.PUT(lrcPath).
+		WithBytes([]byte("[00:12.50]Ooh\n[00:10.00]You set my soul alight")).
+		Expect().
+		Status(http.StatusUnprocessableEntity)
+
+	e.PUT(lrcPath).
+		WithBytes([]byte("[00:12.50]Ooh\nYou set my soul alight")).
+		Expect().
+		Status(http.StatusBadRequest)
+
+	e.PUT(lrcPath).
+		WithHeader("Content-Type", "application/json").
+		WithBytes([]byte(`"[00:12.50]Ooh"`)).
+		Expect().
+		Status(http.StatusUnsupportedMediaType)
+
+	e.DELETE(lyricsPath + "/0").
+		Expect().
+		Status(http.StatusNoContent)
+
+	e.GET(lrcPath).
+		Expect().
+		Status(http.StatusNotFound)
+
+	e.POST(timedRevisionPath + "/revert").
+		Expect().
+		Status(http.StatusNoContent)
+
+	e.GET(lrcPath).
+		Expect().
+		Status(http.StatusOK).
+		Body().Contains("\n\n[00:12.00]Ooh\n[00:14.50]You set my soul alight\n\n[00:20.50]Ooh\n")
 }
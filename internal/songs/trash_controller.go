@@ -0,0 +1,90 @@
+package songs
+
+import (
+	"errors"
+	"net/http"
+)
+
+type purgeDTO struct {
+	// Number of purged songs
+	Purged int64 `json:"purged"`
+}
+
+// RestoreSong godoc
+// @Summary      Restore song
+// @Description  Moves the deleted song out of the trash.
+// @Tags         songs
+// @Param        songId   path   int64   true   "Song id"
+// @Param        X-Author header string  false  "Author of the change"
+// @Success      204  {string}  string
+// @Failure      400  {string}  string
+// @Failure      404  {string}  string
+// @Failure      409  {string}  string
+// @Failure      500  {string}  string
+// @Router       /songs/{songId}/restore [post]
+func (c *songsController) RestoreSong(w http.ResponseWriter, r *http.Request) {
+	songId, err := c.parseSongId(r)
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	author, err := c.parseAuthor(r)
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	if err := c.songsService.RestoreSong(r.Context(), songId, author); errors.Is(err, ErrSongNotFound) {
+		c.notFound(w, r, err)
+		return
+	} else if errors.Is(err, ErrDuplicateSong) {
+		c.duplicateSong(w, r, err)
+		return
+	} else if errors.Is(err, ErrTrackIsTaken) {
+		c.conflict(w, r, err)
+		return
+	} else if err != nil {
+		c.serverError(w, r, err, "failed to restore song")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetTrash godoc
+// @Summary      Get deleted songs
+// @Tags         songs
+// @Produce      json
+// @Param        page     query  uint64  false  "Page number"
+// @Param        pageSize query  uint64  false  "Page size"
+// @Param        lastId   query  int64   false  "Last song id"
+// @Param        filter   query  string  false  "Filter"
+// @Success      200  {array}  songDTO
+// @Failure      400  {string}  string
+// @Failure      500  {string}  string
+// @Router       /songs/trash [get]
+func (c *songsController) GetTrash(w http.ResponseWriter, r *http.Request) {
+	sq, err := c.parseQuery(r)
+	if err != nil {
+		c.badRequest(w, r, err)
+		return
+	}
+	sq.Deleted = true
+	c.songs(w, r, sq)
+}
+
+// PurgeTrash godoc
+// @Summary      Purge deleted songs
+// @Description  Permanently deletes songs that have been in the trash
+// @Description  longer than the retention period.
+// @Tags         songs
+// @Produce      json
+// @Success      200  {object}  purgeDTO
+// @Failure      500  {string}  string
+// @Router       /songs/trash [delete]
+func (c *songsController) PurgeTrash(w http.ResponseWriter, r *http.Request) {
+	purged, err := c.songsService.PurgeTrash(r.Context())
+	if err != nil {
+		c.serverError(w, r, err, "failed to purge trash")
+		return
+	}
+	c.json(w, r, purgeDTO{Purged: purged}, http.StatusOK)
+}
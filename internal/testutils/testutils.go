@@ -6,7 +6,7 @@ import (
 	"testing"
 	"time"
 
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/modules/postgres"
 	"github.com/testcontainers/testcontainers-go/wait"
@@ -15,7 +15,7 @@ import (
 	microcks "microcks.io/testcontainers-go"
 )
 
-func SetupPgx(ctx context.Context, log *slog.Logger, t testing.TB) *pgx.Conn {
+func SetupPgx(ctx context.Context, log *slog.Logger, t testing.TB) *pgxpool.Pool {
 	pgContainer, err := postgres.Run(ctx,
 		"postgres:17.2-alpine3.20",
 		postgres.WithDatabase("songs"),
@@ -39,16 +39,12 @@ func SetupPgx(ctx context.Context, log *slog.Logger, t testing.TB) *pgx.Conn {
 	if err := pgx_adapter.Migrate(ctx, log, uri, "file://../../migrations"); err != nil {
 		t.Fatal(err)
 	}
-	conn, err := pgx.Connect(ctx, uri)
+	pool, err := pgxpool.New(ctx, uri)
 	if err != nil {
 		t.Fatal(err)
 	}
-	t.Cleanup(func() {
-		if err := conn.Close(ctx); err != nil {
-			log.LogAttrs(ctx, slog.LevelError, "cannot close connection", slog.String("error", err.Error()))
-		}
-	})
-	return conn
+	t.Cleanup(pool.Close)
+	return pool
 }
 
 func SetupMusicInfoClient(ctx context.Context, t testing.TB) *music_info.ClientWithResponses {
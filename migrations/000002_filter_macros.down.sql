@@ -0,0 +1 @@
+DROP TABLE filter_macro;
\ No newline at end of file
@@ -0,0 +1,5 @@
+CREATE TABLE
+  filter_macro (
+    name VARCHAR(64) PRIMARY KEY,
+    definition TEXT NOT NULL
+  );
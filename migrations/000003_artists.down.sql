@@ -0,0 +1,12 @@
+ALTER TABLE song ADD COLUMN artist VARCHAR(255);
+
+UPDATE song SET artist = artist.name
+FROM artist WHERE artist.id = song.artist_id;
+
+ALTER TABLE song ALTER COLUMN artist SET NOT NULL;
+
+ALTER TABLE song DROP COLUMN artist_id;
+
+DROP TABLE artist;
+
+CREATE INDEX idx_song_artist ON song (artist);
@@ -0,0 +1,21 @@
+CREATE TABLE
+  artist (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE
+  );
+
+INSERT INTO artist (name)
+SELECT DISTINCT TRIM(artist) FROM song;
+
+ALTER TABLE song ADD COLUMN artist_id BIGINT REFERENCES artist (id);
+
+UPDATE song SET artist_id = artist.id
+FROM artist WHERE artist.name = TRIM(song.artist);
+
+ALTER TABLE song ALTER COLUMN artist_id SET NOT NULL;
+
+DROP INDEX idx_song_artist;
+
+ALTER TABLE song DROP COLUMN artist;
+
+CREATE INDEX idx_song_artist_id ON song (artist_id);
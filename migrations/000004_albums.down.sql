@@ -0,0 +1,9 @@
+DROP INDEX idx_song_album_track;
+
+ALTER TABLE song
+DROP CONSTRAINT song_track_requires_album,
+DROP COLUMN track_number,
+DROP COLUMN disc_number,
+DROP COLUMN album_id;
+
+DROP TABLE album;
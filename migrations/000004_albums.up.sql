@@ -0,0 +1,24 @@
+CREATE TABLE
+  album (
+    id BIGSERIAL PRIMARY KEY,
+    title VARCHAR(255) NOT NULL,
+    artist_id BIGINT NOT NULL REFERENCES artist (id),
+    release_date DATE NOT NULL,
+    cover_link VARCHAR(255) NOT NULL
+  );
+
+CREATE INDEX idx_album_artist_id ON album (artist_id);
+
+ALTER TABLE song
+ADD COLUMN album_id BIGINT REFERENCES album (id),
+ADD COLUMN disc_number INTEGER CHECK (disc_number > 0),
+ADD COLUMN track_number INTEGER CHECK (track_number > 0),
+ADD CONSTRAINT song_track_requires_album CHECK (
+  album_id IS NOT NULL
+  OR (
+    disc_number IS NULL
+    AND track_number IS NULL
+  )
+);
+
+CREATE UNIQUE INDEX idx_song_album_track ON song (album_id, disc_number, track_number);
@@ -0,0 +1,14 @@
+-- Additional artists credited on the song,
+-- the song artist is always its primary artist
+CREATE TABLE
+  song_artist (
+    song_id BIGINT NOT NULL REFERENCES song (id) ON DELETE CASCADE,
+    artist_id BIGINT NOT NULL REFERENCES artist (id),
+    role VARCHAR(16) NOT NULL CHECK (
+      role IN ('primary', 'featured', 'composer', 'lyricist')
+    ),
+    position INTEGER NOT NULL,
+    PRIMARY KEY (song_id, artist_id, role)
+  );
+
+CREATE INDEX idx_song_artist_artist_id ON song_artist (artist_id);
@@ -0,0 +1,5 @@
+DROP FUNCTION merge_artist;
+
+DROP FUNCTION artist_id_by_name;
+
+DROP TABLE artist_alias;
@@ -0,0 +1,72 @@
+-- Names under which the artist can be found, the key is a normalized name.
+-- Every artist has an alias for its own name
+CREATE TABLE
+  artist_alias (
+    key VARCHAR(255) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    artist_id BIGINT NOT NULL REFERENCES artist (id) ON DELETE CASCADE
+  );
+
+CREATE INDEX idx_artist_alias_artist_id ON artist_alias (artist_id);
+
+-- Returns an id of the artist found by the alias key,
+-- the artist is created if there is no such alias
+CREATE FUNCTION artist_id_by_name (artist_name TEXT, artist_key TEXT) RETURNS BIGINT AS $$
+DECLARE
+  result BIGINT;
+BEGIN
+  SELECT artist_id INTO result FROM artist_alias WHERE key = artist_key;
+  IF FOUND THEN
+    RETURN result;
+  END IF;
+  INSERT INTO artist (name) VALUES (artist_name)
+  ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+  RETURNING id INTO result;
+  INSERT INTO artist_alias (key, name, artist_id) VALUES (artist_key, artist_name, result);
+  RETURN result;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Moves songs, albums, credits and aliases of the source artist
+-- to the target artist and deletes the source artist
+CREATE FUNCTION merge_artist (source_id BIGINT, target_id BIGINT) RETURNS VOID AS $$
+BEGIN
+  UPDATE song SET artist_id = target_id WHERE artist_id = source_id;
+  UPDATE album SET artist_id = target_id WHERE artist_id = source_id;
+  DELETE FROM song_artist AS s
+  WHERE s.artist_id = source_id AND EXISTS (
+    SELECT 1 FROM song_artist AS t
+    WHERE t.song_id = s.song_id AND t.role = s.role AND t.artist_id = target_id
+  );
+  UPDATE song_artist SET artist_id = target_id WHERE artist_id = source_id;
+  UPDATE artist_alias SET artist_id = target_id WHERE artist_id = source_id;
+  DELETE FROM artist WHERE id = source_id;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Keys of existing artists approximate the application normalization
+-- (NFKC, case folding, spacing and leading article)
+CREATE TEMPORARY TABLE artist_key AS
+SELECT
+  id,
+  name,
+  regexp_replace(
+    regexp_replace(btrim(lower(normalize(name, NFKC))), '\s+', ' ', 'g'),
+    '^(the|a|an) ',
+    ''
+  ) AS key
+FROM
+  artist;
+
+INSERT INTO artist_alias (key, name, artist_id)
+SELECT DISTINCT ON (key) key, name, id
+FROM artist_key
+ORDER BY key, id;
+
+-- Artists with the same key are merged into the oldest one
+SELECT merge_artist (artist_key.id, artist_alias.artist_id)
+FROM artist_key
+JOIN artist_alias ON artist_alias.key = artist_key.key
+WHERE artist_key.id <> artist_alias.artist_id;
+
+DROP TABLE artist_key;
@@ -0,0 +1,6 @@
+DROP TRIGGER song_version ON song;
+
+DROP FUNCTION increment_song_version;
+
+ALTER TABLE song
+DROP COLUMN version;
@@ -0,0 +1,15 @@
+-- Version of the song for optimistic concurrency,
+-- incremented on every update of the song row
+ALTER TABLE song
+ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
+
+CREATE FUNCTION increment_song_version () RETURNS TRIGGER AS $$
+BEGIN
+  NEW.version := OLD.version + 1;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER song_version BEFORE
+UPDATE ON song FOR EACH ROW
+EXECUTE FUNCTION increment_song_version ();
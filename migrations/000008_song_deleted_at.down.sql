@@ -0,0 +1,12 @@
+DELETE FROM song
+WHERE
+  deleted_at IS NOT NULL;
+
+DROP INDEX idx_song_album_track;
+
+CREATE UNIQUE INDEX idx_song_album_track ON song (album_id, disc_number, track_number);
+
+DROP INDEX idx_song_deleted_at;
+
+ALTER TABLE song
+DROP COLUMN deleted_at;
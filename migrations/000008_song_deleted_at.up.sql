@@ -0,0 +1,14 @@
+-- Soft deleted songs are kept in the trash until they are purged
+ALTER TABLE song
+ADD COLUMN deleted_at TIMESTAMPTZ;
+
+CREATE INDEX idx_song_deleted_at ON song (deleted_at)
+WHERE
+  deleted_at IS NOT NULL;
+
+-- Deleted songs do not occupy album tracks
+DROP INDEX idx_song_album_track;
+
+CREATE UNIQUE INDEX idx_song_album_track ON song (album_id, disc_number, track_number)
+WHERE
+  deleted_at IS NULL;
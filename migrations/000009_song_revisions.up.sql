@@ -0,0 +1,53 @@
+-- Changes of songs, the revision is the song version after the change
+-- and changes hold before and after values of the changed fields
+CREATE TABLE
+  song_revision (
+    song_id BIGINT NOT NULL REFERENCES song (id) ON DELETE CASCADE,
+    revision BIGINT NOT NULL,
+    author VARCHAR(255) NOT NULL,
+    action VARCHAR(16) NOT NULL CHECK (
+      action IN ('create', 'update', 'delete', 'restore', 'revert')
+    ),
+    changes JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (song_id, revision)
+  );
+
+-- Existing songs start their history from the current state
+INSERT INTO
+  song_revision (song_id, revision, author, action, changes)
+SELECT
+  song.id,
+  song.version,
+  '',
+  'create',
+  jsonb_build_object(
+    'song',
+    jsonb_build_object('before', NULL, 'after', song.title),
+    'group',
+    jsonb_build_object('before', NULL, 'after', artist.name),
+    'releaseDate',
+    jsonb_build_object(
+      'before',
+      NULL,
+      'after',
+      to_char(song.release_date, 'DD.MM.YYYY')
+    ),
+    'text',
+    jsonb_build_object('before', NULL, 'after', to_jsonb(song.lyrics)),
+    'link',
+    jsonb_build_object('before', NULL, 'after', song.link)
+  ) || CASE
+    WHEN song.album_id IS NOT NULL THEN jsonb_build_object(
+      'albumId',
+      jsonb_build_object('before', NULL, 'after', song.album_id),
+      'discNumber',
+      jsonb_build_object('before', NULL, 'after', song.disc_number),
+      'trackNumber',
+      jsonb_build_object('before', NULL, 'after', song.track_number)
+    )
+    ELSE '{}'::jsonb
+  END
+FROM
+  song
+  JOIN artist ON artist.id = song.artist_id;
@@ -0,0 +1,10 @@
+CREATE TABLE
+  idempotency_key (
+    key VARCHAR(255) PRIMARY KEY,
+    request_hash BYTEA NOT NULL,
+    -- Response columns are NULL while the request is processed
+    response_status INTEGER,
+    response_content_type VARCHAR(255),
+    response_body BYTEA,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+  );
@@ -0,0 +1,3 @@
+DROP INDEX idx_song_artist_title;
+
+DROP FUNCTION song_title_key;
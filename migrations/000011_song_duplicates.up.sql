@@ -0,0 +1,46 @@
+-- Key for comparison of titles that differ in case, spacing
+-- or Unicode representation
+CREATE FUNCTION song_title_key (title TEXT) RETURNS TEXT AS $$
+  SELECT regexp_replace(btrim(lower(normalize(title, NFKC))), '\s+', ' ', 'g')
+$$ LANGUAGE SQL IMMUTABLE PARALLEL SAFE;
+
+-- Existing duplicates are moved to the trash, the oldest song is kept
+WITH
+  trashed AS (
+    UPDATE song
+    SET
+      deleted_at = now()
+    WHERE
+      deleted_at IS NULL
+      AND EXISTS (
+        SELECT 1
+        FROM song AS original
+        WHERE
+          original.deleted_at IS NULL
+          AND original.artist_id = song.artist_id
+          AND song_title_key (original.title) = song_title_key (song.title)
+          AND original.id < song.id
+      )
+    RETURNING
+      id,
+      version,
+      deleted_at
+  )
+INSERT INTO
+  song_revision (song_id, revision, author, action, changes)
+SELECT
+  id,
+  version,
+  '',
+  'delete',
+  jsonb_build_object(
+    'deletedAt',
+    jsonb_build_object('before', NULL, 'after', deleted_at)
+  )
+FROM
+  trashed;
+
+-- Deleted songs are not considered duplicates
+CREATE UNIQUE INDEX idx_song_artist_title ON song (artist_id, song_title_key (title))
+WHERE
+  deleted_at IS NULL;
@@ -0,0 +1,3 @@
+DROP INDEX idx_song_lyrics_search;
+
+DROP FUNCTION lyrics_tsvector;
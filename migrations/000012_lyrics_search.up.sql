@@ -0,0 +1,7 @@
+-- Words of all verses, the `simple` configuration is used
+-- since the lyrics are in different languages
+CREATE FUNCTION lyrics_tsvector (lyrics TEXT[]) RETURNS tsvector AS $$
+  SELECT to_tsvector('simple', array_to_string(lyrics, E'\n'))
+$$ LANGUAGE SQL IMMUTABLE PARALLEL SAFE;
+
+CREATE INDEX idx_song_lyrics_search ON song USING GIN (lyrics_tsvector (lyrics));
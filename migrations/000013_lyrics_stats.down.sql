@@ -0,0 +1,5 @@
+ALTER TABLE song
+DROP COLUMN verse_count,
+DROP COLUMN line_count,
+DROP COLUMN word_count,
+DROP COLUMN unique_word_count;
@@ -0,0 +1,70 @@
+-- Statistics of the lyrics are computed by the service,
+-- existing songs are approximated here and recounted by the service (000016)
+ALTER TABLE song
+ADD COLUMN verse_count INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN line_count INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN word_count INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN unique_word_count INTEGER NOT NULL DEFAULT 0;
+
+-- The statistics are not a change of the song
+ALTER TABLE song
+DISABLE TRIGGER song_version;
+
+WITH
+  word AS (
+    SELECT
+      song.id,
+      lower(btrim(word.text, '''’')) AS text
+    FROM
+      song
+      CROSS JOIN unnest(song.lyrics) AS verse (text)
+      CROSS JOIN regexp_split_to_table(verse.text, '[^[:alnum:]''’]+') AS word (text)
+    WHERE
+      btrim(word.text, '''’') <> ''
+  ),
+  line AS (
+    SELECT
+      song.id,
+      count(*) AS count
+    FROM
+      song
+      CROSS JOIN unnest(song.lyrics) AS verse (text)
+      CROSS JOIN regexp_split_to_table(verse.text, '\n') AS line (text)
+    WHERE
+      btrim(line.text) <> ''
+    GROUP BY
+      song.id
+  )
+UPDATE song
+SET
+  verse_count = cardinality(song.lyrics),
+  line_count = coalesce(
+    (
+      SELECT
+        line.count
+      FROM
+        line
+      WHERE
+        line.id = song.id
+    ),
+    0
+  ),
+  word_count = (
+    SELECT
+      count(*)
+    FROM
+      word
+    WHERE
+      word.id = song.id
+  ),
+  unique_word_count = (
+    SELECT
+      count(DISTINCT word.text)
+    FROM
+      word
+    WHERE
+      word.id = song.id
+  );
+
+ALTER TABLE song
+ENABLE TRIGGER song_version;
@@ -0,0 +1,2 @@
+ALTER TABLE song
+DROP COLUMN lyrics_times;
@@ -0,0 +1,4 @@
+-- Start times of the lyrics lines in milliseconds, lines of all verses
+-- are numbered in order. NULL if the lyrics are not timed.
+ALTER TABLE song
+ADD COLUMN lyrics_times INTEGER[];
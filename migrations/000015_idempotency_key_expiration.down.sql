@@ -0,0 +1 @@
+DROP INDEX idx_idempotency_key_created_at;
@@ -0,0 +1,2 @@
+-- Keys expire after the configured TTL and are purged by their creation time
+CREATE INDEX idx_idempotency_key_created_at ON idempotency_key (created_at);
@@ -0,0 +1,8 @@
+CREATE OR REPLACE FUNCTION increment_song_version () RETURNS TRIGGER AS $$
+BEGIN
+  NEW.version := OLD.version + 1;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TABLE lyrics_stats_recount;
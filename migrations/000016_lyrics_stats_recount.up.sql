@@ -0,0 +1,26 @@
+-- Statistics of existing songs are only approximated by SQL in 000013,
+-- they are recounted by the service with the same rules as new songs
+CREATE TABLE
+  lyrics_stats_recount (
+    song_id BIGINT PRIMARY KEY REFERENCES song (id) ON DELETE CASCADE
+  );
+
+INSERT INTO
+  lyrics_stats_recount (song_id)
+SELECT
+  id
+FROM
+  song
+WHERE
+  cardinality(lyrics) > 0;
+
+-- Maintenance updates that are not changes of the song keep the version
+CREATE OR REPLACE FUNCTION increment_song_version () RETURNS TRIGGER AS $$
+BEGIN
+  IF current_setting('song.keep_version', TRUE) = 'on' THEN
+    RETURN NEW;
+  END IF;
+  NEW.version := OLD.version + 1;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,15 @@
+CREATE OR REPLACE FUNCTION artist_id_by_name (artist_name TEXT, artist_key TEXT) RETURNS BIGINT AS $$
+DECLARE
+  result BIGINT;
+BEGIN
+  SELECT artist_id INTO result FROM artist_alias WHERE key = artist_key;
+  IF FOUND THEN
+    RETURN result;
+  END IF;
+  INSERT INTO artist (name) VALUES (artist_name)
+  ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+  RETURNING id INTO result;
+  INSERT INTO artist_alias (key, name, artist_id) VALUES (artist_key, artist_name, result);
+  RETURN result;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,26 @@
+-- Concurrent creation of the same artist must not fail on the alias key,
+-- the loser of the race removes its artist and takes the created one
+CREATE OR REPLACE FUNCTION artist_id_by_name (artist_name TEXT, artist_key TEXT) RETURNS BIGINT AS $$
+DECLARE
+  result BIGINT;
+BEGIN
+  SELECT artist_id INTO result FROM artist_alias WHERE key = artist_key;
+  IF FOUND THEN
+    RETURN result;
+  END IF;
+  INSERT INTO artist (name) VALUES (artist_name)
+  ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+  RETURNING id INTO result;
+  INSERT INTO artist_alias (key, name, artist_id) VALUES (artist_key, artist_name, result)
+  ON CONFLICT (key) DO NOTHING;
+  IF FOUND THEN
+    RETURN result;
+  END IF;
+  -- Every artist has an alias, so the artist without aliases was created above
+  DELETE FROM artist WHERE id = result AND NOT EXISTS (
+    SELECT 1 FROM artist_alias WHERE artist_id = result
+  );
+  SELECT artist_id INTO STRICT result FROM artist_alias WHERE key = artist_key;
+  RETURN result;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,2 @@
+ALTER TABLE idempotency_key
+DROP COLUMN reserved_at;
@@ -0,0 +1,4 @@
+-- Keys of interrupted requests stay without a response, their reservation
+-- is taken over by a retry after the lease expires
+ALTER TABLE idempotency_key
+ADD COLUMN reserved_at TIMESTAMPTZ NOT NULL DEFAULT now();